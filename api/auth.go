@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jordanpotter/sitemapper/internal/auth"
+	"github.com/jordanpotter/sitemapper/internal/mapper"
+)
+
+type clientContextKey struct{}
+
+// loadKeyring returns the keyring read from the file at path, or else from
+// the JSON in the SITEMAPPER_API_KEYS environment variable. If neither is
+// set, authentication is disabled and the keyring is nil.
+func loadKeyring(path, env string) (*auth.Keyring, error) {
+	var c *auth.Config
+	var err error
+	if path != "" {
+		c, err = auth.LoadConfig(path)
+	} else if env != "" {
+		c, err = auth.DecodeConfig(strings.NewReader(env))
+	} else {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return auth.NewKeyring(c)
+}
+
+// authenticate wraps h so that it is only called for requests with a valid
+// API key, if authentication is enabled.
+func (s *server) authenticate(h http.HandlerFunc) http.HandlerFunc {
+	if s.keyring == nil {
+		return h
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, err := s.keyring.Authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sitemapper"`)
+			writeProblem(w, http.StatusUnauthorized, codeUnauthorized, err.Error())
+			return
+		}
+
+		writeBudgetHeaders(w, c.Budget())
+		h(w, r.WithContext(context.WithValue(r.Context(), clientContextKey{}, c)))
+	}
+}
+
+// requestOwner returns the name of the client that authenticated r, or the
+// empty string if authentication is disabled.
+func requestOwner(r *http.Request) string {
+	if c, _ := r.Context().Value(clientContextKey{}).(*auth.Client); c != nil {
+		return c.Name
+	}
+	return ""
+}
+
+// owns reports whether the client that authenticated r owns a resource
+// created by owner. Every resource is owned by every request if
+// authentication is disabled.
+func owns(r *http.Request, owner string) bool {
+	c, _ := r.Context().Value(clientContextKey{}).(*auth.Client)
+	return c == nil || c.Name == owner
+}
+
+// reserve applies the quota of the authenticated client to a crawl with the
+// specified options. The returned quota, which is nil if authentication is
+// disabled, must be passed on to the job of the crawl. If the client is over
+// quota, an error is written to w and ok is false.
+func (s *server) reserve(w http.ResponseWriter, r *http.Request, opts *mapper.Options) (q *quotaUse, ok bool) {
+	c, _ := r.Context().Value(clientContextKey{}).(*auth.Client)
+	if c == nil {
+		return nil, true
+	}
+
+	q, err := applyQuota(c, opts)
+	b := c.Budget()
+	writeBudgetHeaders(w, b)
+	if err == auth.ErrPageQuota {
+		retryAfter := int64(time.Until(b.PagesReset)/time.Second) + 1
+		w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+	}
+	if err != nil {
+		writeProblem(w, http.StatusTooManyRequests, codeQuotaExceeded, err.Error())
+		return nil, false
+	}
+	return q, true
+}
+
+// applyQuota reserves a crawl with the specified options against the quota
+// of c, counting every page it crawls towards the client's daily pages.
+func applyQuota(c *auth.Client, opts *mapper.Options) (*quotaUse, error) {
+	release, err := c.Reserve(opts.NumWorkers)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &quotaUse{client: c, release: release}
+	onPageMap := opts.OnPageMap
+	opts.OnPageMap = func(pm *mapper.PageMap) {
+		q.addPage()
+		if onPageMap != nil {
+			onPageMap(pm)
+		}
+	}
+	return q, nil
+}
+
+// A quotaUse is a crawl reserved against the quota of a client. Once the
+// client has used the pages of the day, the crawl is stopped.
+type quotaUse struct {
+	client  *auth.Client
+	release func()
+
+	m        sync.Mutex
+	stop     func()
+	exceeded bool
+}
+
+func (q *quotaUse) addPage() {
+	if q.client.AddPage() {
+		return
+	}
+
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	q.exceeded = true
+	if q.stop != nil {
+		q.stop()
+	}
+}
+
+// onExceeded sets the function that stops the crawl once the pages of the
+// day have been used, calling it at once if they already have been.
+func (q *quotaUse) onExceeded(stop func()) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	q.stop = stop
+	if q.exceeded {
+		stop()
+	}
+}
+
+func writeBudgetHeaders(w http.ResponseWriter, b *auth.Budget) {
+	if b.JobLimit > 0 {
+		w.Header().Set("X-Quota-Jobs-Limit", strconv.Itoa(b.JobLimit))
+		w.Header().Set("X-Quota-Jobs-Remaining", strconv.Itoa(b.JobsRemaining))
+	}
+	if b.PageLimit > 0 {
+		w.Header().Set("X-Quota-Pages-Limit", strconv.Itoa(b.PageLimit))
+		w.Header().Set("X-Quota-Pages-Remaining", strconv.Itoa(b.PagesRemaining))
+		w.Header().Set("X-Quota-Pages-Reset", strconv.FormatInt(b.PagesReset.Unix(), 10))
+	}
+	if b.MaxWorkers > 0 {
+		w.Header().Set("X-Quota-Max-Workers", strconv.Itoa(b.MaxWorkers))
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/jordanpotter/sitemapper/internal/export"
+	"github.com/jordanpotter/sitemapper/internal/mapper"
+)
+
+// An exporter writes a site map in a format other than json or jsonl.
+type exporter struct {
+	contentType string
+	filename    string
+	write       func(w io.Writer, sm *mapper.SiteMap) error
+}
+
+// exporters are the export formats, with every column of the csv tables and
+// every node of the graph formats.
+var exporters = map[string]*exporter{
+	"csv": {"application/zip", "sitemap.zip", func(w io.Writer, sm *mapper.SiteMap) error {
+		return export.WriteCSVZip(w, sm, nil)
+	}},
+	"graphml": {"application/graphml+xml", "sitemap.graphml", func(w io.Writer, sm *mapper.SiteMap) error {
+		return export.WriteGraphML(w, sm, nil)
+	}},
+	"gexf": {"application/xml", "sitemap.gexf", func(w io.Writer, sm *mapper.SiteMap) error {
+		return export.WriteGEXF(w, sm, nil)
+	}},
+	"dot": {"text/vnd.graphviz", "sitemap.dot", func(w io.Writer, sm *mapper.SiteMap) error {
+		return export.WriteDOT(w, sm, nil)
+	}},
+}
+
+// writeExport writes sm as an attachment in an export format. It returns
+// false if format is not an export format, in which case nothing is written.
+func writeExport(w http.ResponseWriter, sm *mapper.SiteMap, format string) bool {
+	e, ok := exporters[format]
+	if !ok {
+		return false
+	}
+
+	var buf bytes.Buffer
+	err := e.write(&buf, sm)
+	if err != nil {
+		writeProblem(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return true
+	}
+
+	w.Header().Set("Content-Type", e.contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+e.filename+`"`)
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(buf.Bytes())
+	if err != nil {
+		log.Println(err)
+	}
+	return true
+}
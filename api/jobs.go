@@ -0,0 +1,478 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jordanpotter/sitemapper/internal/auth"
+	"github.com/jordanpotter/sitemapper/internal/jobs"
+	"github.com/jordanpotter/sitemapper/internal/mapper"
+	"github.com/jordanpotter/sitemapper/internal/schedules"
+	"github.com/jordanpotter/sitemapper/internal/webhook"
+)
+
+// defaultListLimit and maxListLimit bound the number of jobs listed at once.
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+type server struct {
+	jobs *jobs.Manager
+
+	// client requests every crawled page, restricted by the network policy.
+	client *http.Client
+
+	// keyring authenticates requests and applies quotas to crawls. It is nil
+	// if authentication is disabled.
+	keyring *auth.Keyring
+
+	// schedules starts the runs of scheduled crawls.
+	schedules *schedules.Scheduler
+
+	// metrics records the measurements of every crawl.
+	metrics mapper.Metrics
+
+	// webhooks sends the webhooks of jobs started with a callback. It is nil
+	// if no webhook secret is configured.
+	webhooks *webhook.Sender
+
+	// publicURL is the base of links sent in webhooks. If empty, the host
+	// each job was started through is used.
+	publicURL string
+
+	// deliveries tracks webhooks waiting to be sent, which are abandoned
+	// once deliveryCtx is done.
+	deliveries     sync.WaitGroup
+	deliveryCtx    context.Context
+	stopDeliveries context.CancelFunc
+
+	// crawls limits how many site maps are created at once by GET /sitemap,
+	// which does not run as a job.
+	crawls chan struct{}
+
+	shuttingDown int32
+}
+
+func newServer(mgr *jobs.Manager, maxCrawls int, client *http.Client, keyring *auth.Keyring, metrics mapper.Metrics) *server {
+	deliveryCtx, stopDeliveries := context.WithCancel(context.Background())
+	return &server{
+		jobs:           mgr,
+		client:         client,
+		keyring:        keyring,
+		metrics:        metrics,
+		deliveryCtx:    deliveryCtx,
+		stopDeliveries: stopDeliveries,
+		crawls:         make(chan struct{}, maxCrawls),
+	}
+}
+
+// shutdown stops the server from accepting new crawls, then waits for
+// running jobs, the runs of schedules, their webhooks and open requests to
+// finish. Once ctx is done, running jobs and webhook deliveries are
+// interrupted and open connections are closed.
+func (s *server) shutdown(ctx context.Context, srv *http.Server) {
+	atomic.StoreInt32(&s.shuttingDown, 1)
+
+	err := s.jobs.Shutdown(ctx)
+	if err != nil {
+		log.Printf("Interrupted running jobs: %v", err)
+	}
+	s.schedules.Stop()
+
+	delivered := make(chan struct{})
+	go func() {
+		s.deliveries.Wait()
+		close(delivered)
+	}()
+	select {
+	case <-delivered:
+	case <-ctx.Done():
+		log.Println("Interrupted webhook deliveries")
+		s.stopDeliveries()
+		<-delivered
+	}
+
+	err = srv.Shutdown(ctx)
+	if err != nil {
+		log.Printf("Closing open connections: %v", err)
+		srv.Close()
+	}
+}
+
+// getHealth serves GET /healthz, which succeeds while the process is running.
+func (s *server) getHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, struct {
+		Status string `json:"status"`
+	}{"ok"})
+}
+
+// getReadiness serves GET /readyz, which succeeds while the server accepts
+// new crawls.
+func (s *server) getReadiness(w http.ResponseWriter, r *http.Request) {
+	if s.isShuttingDown() {
+		writeProblem(w, http.StatusServiceUnavailable, codeShuttingDown, "The server is shutting down")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Status string `json:"status"`
+	}{"ready"})
+}
+
+func (s *server) isShuttingDown() bool {
+	return atomic.LoadInt32(&s.shuttingDown) == 1
+}
+
+// handleJobs serves GET /jobs, which lists jobs newest first, and POST /jobs,
+// which starts a crawl job in the background.
+func (s *server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listJobs(w, r)
+	case http.MethodPost:
+		s.startJob(w, r)
+	default:
+		writeMethodNotAllowed(w, "GET, POST")
+	}
+}
+
+// listJobs writes a page of the statuses of the client's jobs. The limit
+// query parameter sets the size of the page, while the cursor parameter
+// continues from the next cursor of the previous page.
+func (s *server) listJobs(w http.ResponseWriter, r *http.Request) {
+	limit := defaultListLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			detail := fmt.Sprintf("Query parameter \"limit\" must be an integer between 1 and %d", maxListLimit)
+			writeProblem(w, http.StatusBadRequest, codeInvalidParameter, detail)
+			return
+		}
+	}
+
+	isOwned := func(js *jobs.JobStatus) bool { return owns(r, js.Owner) }
+	statuses, next, err := s.jobs.List(r.URL.Query().Get("cursor"), limit, isOwned)
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Jobs []*jobs.JobStatus `json:"jobs"`
+		Next string            `json:"next,omitempty"`
+	}{statuses, next})
+}
+
+func (s *server) startJob(w http.ResponseWriter, r *http.Request) {
+	if s.isShuttingDown() {
+		writeJobError(w, jobs.ErrShuttingDown)
+		return
+	}
+
+	cr, ok := parseCrawlRequest(w, r)
+	if !ok {
+		return
+	}
+	u, opts := cr.site, cr.opts
+	opts.Client = s.client
+	opts.Metrics = s.metrics
+
+	if cr.callback != "" && s.webhooks == nil {
+		writeProblem(w, http.StatusBadRequest, codeWebhooksDisabled, "Callbacks are disabled as no webhook secret is configured")
+		return
+	}
+
+	q, ok := s.reserve(w, r, opts)
+	if !ok {
+		return
+	}
+
+	j, err := s.startJobWithCallback(r, u, opts, requestOwner(r), q, cr.callback)
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/jobs/"+j.ID)
+	writeJSON(w, http.StatusAccepted, j.Status())
+}
+
+// startJobWithCallback starts a job on behalf of owner, counting it against
+// the quota q unless q is nil. If callback is not empty, it is notified once the job has
+// finished, with a link to the result based on r, which is nil for jobs
+// started by the server itself.
+func (s *server) startJobWithCallback(r *http.Request, u *url.URL, opts *mapper.Options, owner string, q *quotaUse, callback string) (*jobs.Job, error) {
+	if callback != "" {
+		s.deliveries.Add(1)
+	}
+	j, err := s.jobs.Start(u, opts, owner)
+	if err != nil {
+		if callback != "" {
+			s.deliveries.Done()
+		}
+		if q != nil {
+			q.release()
+		}
+		return nil, err
+	}
+	if q != nil {
+		q.onExceeded(func() { j.Stop(auth.ErrPageQuota) })
+		go func() {
+			<-j.Done()
+			q.release()
+		}()
+	}
+
+	if callback != "" {
+		s.setWebhook(j.ID, &jobs.WebhookStatus{URL: callback, State: jobs.WebhookPending})
+		go s.notify(j, callback, s.resultURL(r, j.ID))
+	}
+	return j, nil
+}
+
+// handleJob serves GET and DELETE /jobs/{id}, which return the status of a
+// job and cancel it respectively, along with GET /jobs/{id}/result,
+// GET /jobs/{id}/events and GET /jobs/{id}/diff. Jobs of other clients are
+// not found.
+func (s *server) handleJob(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
+	parts := strings.Split(path, "/")
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		s.getJob(w, r, parts[0])
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		s.cancelJob(w, r, parts[0])
+	case len(parts) == 1:
+		writeMethodNotAllowed(w, "GET, DELETE")
+	case len(parts) == 2 && parts[1] == "result" && r.Method == http.MethodGet:
+		s.getJobResult(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "events" && r.Method == http.MethodGet:
+		s.streamJobEvents(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "diff" && r.Method == http.MethodGet:
+		s.diffJobs(w, r, parts[0])
+	case len(parts) == 2 && (parts[1] == "result" || parts[1] == "events" || parts[1] == "diff"):
+		writeMethodNotAllowed(w, http.MethodGet)
+	default:
+		writeProblem(w, http.StatusNotFound, codeNotFound, "No resource at "+r.URL.Path)
+	}
+}
+
+func (s *server) getJob(w http.ResponseWriter, r *http.Request, id string) {
+	js, err := s.jobStatus(r, id)
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, js)
+}
+
+func (s *server) cancelJob(w http.ResponseWriter, r *http.Request, id string) {
+	_, err := s.jobStatus(r, id)
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+
+	j, err := s.jobs.Cancel(id)
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, j.Status())
+}
+
+// getJobResult writes the site map of a job, in the format given by the
+// format query parameter.
+func (s *server) getJobResult(w http.ResponseWriter, r *http.Request, id string) {
+	format, ok := parseFormatQuery(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := s.jobResult(r, id)
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+
+	if format == "jsonl" {
+		writeJSONLines(w, result)
+		return
+	} else if format == "json" {
+		writeJSONBytes(w, http.StatusOK, result)
+		return
+	}
+
+	var sm mapper.SiteMap
+	err = json.Unmarshal(result, &sm)
+	if err != nil {
+		writeProblem(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	writeExport(w, &sm, format)
+}
+
+// diffJobs compares the result of the job in the base query parameter with
+// that of the job with the specified id.
+func (s *server) diffJobs(w http.ResponseWriter, r *http.Request, id string) {
+	base := r.URL.Query().Get("base")
+	if base == "" {
+		writeProblem(w, http.StatusBadRequest, codeMissingParameter, "Missing query parameter \"base\"")
+		return
+	}
+
+	old, err := s.jobSiteMap(r, base)
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	newer, err := s.jobSiteMap(r, id)
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, mapper.CreateSiteMapDiff(old, newer))
+}
+
+// jobStatus returns the status of the job with the specified id, as long as
+// it is owned by the client that authenticated r.
+func (s *server) jobStatus(r *http.Request, id string) (*jobs.JobStatus, error) {
+	js, err := s.jobs.Status(id)
+	if err != nil {
+		return nil, err
+	} else if !owns(r, js.Owner) {
+		return nil, jobs.ErrJobNotFound
+	}
+	return js, nil
+}
+
+// jobResult returns the result of the job with the specified id, as long as
+// it is owned by the client that authenticated r.
+func (s *server) jobResult(r *http.Request, id string) ([]byte, error) {
+	_, err := s.jobStatus(r, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.jobs.Result(id)
+}
+
+func (s *server) jobSiteMap(r *http.Request, id string) (*mapper.SiteMap, error) {
+	result, err := s.jobResult(r, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var sm mapper.SiteMap
+	err = json.Unmarshal(result, &sm)
+	if err != nil {
+		return nil, err
+	}
+	return &sm, nil
+}
+
+// streamJobEvents streams the crawl events of a job as Server-Sent Events.
+// The current status of the job is sent first, and again once the job
+// finishes, after which the stream is closed. A job that finished before the
+// server last started only has its status sent.
+func (s *server) streamJobEvents(w http.ResponseWriter, r *http.Request, id string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeProblem(w, http.StatusInternalServerError, codeStreamingUnsupported, "Streaming unsupported")
+		return
+	}
+
+	var events <-chan *mapper.Event
+	if j, err := s.jobs.Get(id); err == nil {
+		var unsubscribe func()
+		events, unsubscribe = j.Subscribe()
+		defer unsubscribe()
+	}
+
+	status, err := s.jobStatus(r, id)
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	sse := &sseWriter{w: w}
+	sse.write("status", status)
+	flusher.Flush()
+	if status.Status.IsFinished() {
+		return
+	}
+
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				status, err = s.jobs.Status(id)
+				if err != nil {
+					log.Println(err)
+					return
+				}
+				sse.write("status", status)
+				flusher.Flush()
+				return
+			}
+			sse.write(string(e.Type), e)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+type sseWriter struct {
+	w      io.Writer
+	nextID int
+}
+
+func (sse *sseWriter) write(event string, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	sse.nextID++
+	_, err = fmt.Fprintf(sse.w, "id: %d\nevent: %s\ndata: %s\n\n", sse.nextID, event, b)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func writeJobError(w http.ResponseWriter, err error) {
+	switch err {
+	case jobs.ErrJobNotFound:
+		writeProblem(w, http.StatusNotFound, codeJobNotFound, err.Error())
+	case jobs.ErrJobFinished:
+		writeProblem(w, http.StatusConflict, codeJobFinished, err.Error())
+	case jobs.ErrResultNotReady:
+		writeProblem(w, http.StatusConflict, codeResultNotReady, err.Error())
+	case jobs.ErrInvalidCursor:
+		writeProblem(w, http.StatusBadRequest, codeInvalidParameter, err.Error())
+	case jobs.ErrAtCapacity:
+		writeProblem(w, http.StatusTooManyRequests, codeAtCapacity, err.Error())
+	case jobs.ErrShuttingDown:
+		writeProblem(w, http.StatusServiceUnavailable, codeShuttingDown, err.Error())
+	default:
+		writeProblem(w, http.StatusInternalServerError, codeInternal, err.Error())
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/jordanpotter/sitemapper/internal/mapper"
+)
+
+// jsonLinesContentType is the media type of JSON Lines responses.
+const jsonLinesContentType = "application/jsonl"
+
+// A lineWriter writes page maps to a response as JSON Lines, flushing each
+// line as it is written so that the response is sent in chunks. The status
+// and headers are sent with the first line.
+type lineWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	enc     *json.Encoder
+	started bool
+	err     error
+}
+
+func newLineWriter(w http.ResponseWriter) (*lineWriter, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, false
+	}
+	return &lineWriter{w: w, flusher: flusher, enc: json.NewEncoder(w)}, true
+}
+
+func (lw *lineWriter) start() {
+	if !lw.started {
+		lw.w.Header().Set("Content-Type", jsonLinesContentType)
+		lw.w.WriteHeader(http.StatusOK)
+		lw.started = true
+	}
+}
+
+// write writes pm as a line, after which writes are skipped if it failed.
+func (lw *lineWriter) write(pm *mapper.PageMap) {
+	lw.start()
+	if lw.err == nil {
+		lw.err = lw.enc.Encode(pm)
+		lw.flusher.Flush()
+	}
+}
+
+// streamSiteMap crawls the site at u, writing each page map to w as a line
+// of JSON as soon as its page has been processed. If the crawl fails before
+// any page has been written, the error is written as usual. Once the
+// response has started, a failure aborts it, so that the client does not
+// receive the final chunk and can tell the site map is incomplete.
+func streamSiteMap(w http.ResponseWriter, r *http.Request, u *url.URL, opts *mapper.Options) {
+	lw, ok := newLineWriter(w)
+	if !ok {
+		writeProblem(w, http.StatusInternalServerError, codeStreamingUnsupported, "Streaming unsupported")
+		return
+	}
+
+	onPageMap := opts.OnPageMap
+	opts.OnPageMap = func(pm *mapper.PageMap) {
+		if onPageMap != nil {
+			onPageMap(pm)
+		}
+		lw.write(pm)
+	}
+	opts.DiscardPageMaps = true
+
+	_, err := mapper.CreateSiteMapWithOptions(r.Context(), u, opts)
+	if err != nil && !lw.started {
+		writeCrawlError(w, r, err, append([]*url.URL{u}, opts.Seeds...))
+		return
+	} else if err != nil {
+		log.Printf("Aborted site map of %s: %v", u, err)
+		panic(http.ErrAbortHandler)
+	}
+
+	lw.start()
+	if lw.err != nil {
+		log.Println(lw.err)
+	}
+}
+
+// writeJSONLines writes the page maps of the site map in result as JSON
+// Lines.
+func writeJSONLines(w http.ResponseWriter, result []byte) {
+	var sm mapper.SiteMap
+	err := json.Unmarshal(result, &sm)
+	if err != nil {
+		writeProblem(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+
+	lw, ok := newLineWriter(w)
+	if !ok {
+		writeProblem(w, http.StatusInternalServerError, codeStreamingUnsupported, "Streaming unsupported")
+		return
+	}
+
+	lw.start()
+	for _, pm := range sm.PageMaps {
+		lw.write(pm)
+	}
+	if lw.err != nil {
+		log.Println(lw.err)
+	}
+}
@@ -1,68 +1,461 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"mime"
 	"net/http"
 	"net/url"
+	"os"
+	"os/signal"
+	"runtime"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/jordanpotter/sitemapper/internal/auth"
+	"github.com/jordanpotter/sitemapper/internal/crawlconfig"
+	"github.com/jordanpotter/sitemapper/internal/jobs"
 	"github.com/jordanpotter/sitemapper/internal/mapper"
+	"github.com/jordanpotter/sitemapper/internal/netpolicy"
+	"github.com/jordanpotter/sitemapper/internal/schedules"
+	"github.com/jordanpotter/sitemapper/internal/store"
+	"github.com/jordanpotter/sitemapper/internal/webhook"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
 	port := flag.Int("port", 8000, "port to serve the API")
 	staticPath := flag.String("static", "gui", "path to static files to serve")
+	maxJobs := flag.Int("max-jobs", runtime.NumCPU(), "maximum number of crawl jobs to run at once")
+	maxQueued := flag.Int("max-queued", 100, "maximum number of crawl jobs waiting to run")
+	allowNets := flag.String("allow-cidrs", "", "comma separated CIDRs that may be crawled, even if internal")
+	denyNets := flag.String("deny-cidrs", "", "comma separated CIDRs that may never be crawled")
+	allowHosts := flag.String("allow-hosts", "", "comma separated hosts that may be crawled, with *. matching subdomains")
+	denyHosts := flag.String("deny-hosts", "", "comma separated hosts that may never be crawled, with *. matching subdomains")
+	keysPath := flag.String("keys-file", "", "path to a JSON file of API keys and quotas, instead of $SITEMAPPER_API_KEYS")
+	storeType := flag.String("store", "memory", "where jobs are stored, one of memory, file or bolt")
+	storePath := flag.String("store-path", "jobs", "directory of the file store, or database file of the bolt store")
+	retentionAge := flag.Duration("retention-age", 0, "how long finished jobs are kept, or 0 to keep them forever")
+	retentionSize := flag.Int64("retention-size", 0, "total bytes of results kept, or 0 for no limit")
+	readTimeout := flag.Duration("read-timeout", 30*time.Second, "maximum duration for reading a request")
+	writeTimeout := flag.Duration("write-timeout", 0, "maximum duration for writing a response, or 0 for no limit as crawls and event streams can be long")
+	idleTimeout := flag.Duration("idle-timeout", 2*time.Minute, "maximum duration an idle keep-alive connection is kept open")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "how long running crawls may take to finish once the server is stopped")
+	webhookSecret := flag.String("webhook-secret", "", "secret signing job webhooks, instead of $SITEMAPPER_WEBHOOK_SECRET, or empty to disable callbacks")
+	webhookAttempts := flag.Int("webhook-attempts", 5, "maximum number of times a job webhook is sent")
+	publicURL := flag.String("public-url", "", "base url of the server in links sent by webhooks, or empty to use the host of each request")
 	flag.Parse()
 
-	log.Printf("Starting server on port %d", *port)
-	http.HandleFunc("/sitemap", getSiteMap)
+	keyring, err := loadKeyring(*keysPath, os.Getenv("SITEMAPPER_API_KEYS"))
+	if err != nil {
+		log.Fatalln(err)
+	} else if keyring == nil {
+		log.Println("No API keys configured, authentication is disabled")
+	}
+
+	allowed, err := netpolicy.ParseNets(splitList(*allowNets))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	denied, err := netpolicy.ParseNets(splitList(*denyNets))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	policy := &netpolicy.Policy{
+		AllowNets:  allowed,
+		DenyNets:   denied,
+		AllowHosts: splitList(*allowHosts),
+		DenyHosts:  splitList(*denyHosts),
+	}
+
+	jobStore, err := openStore(*storeType, *storePath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	mgr, err := jobs.NewManager(*maxJobs, *maxQueued, jobStore)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	reg, crawlMetrics, err := newMetricsRegistry(mgr)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	s := newServer(mgr, *maxJobs, policy.Client(), keyring, crawlMetrics)
+	s.publicURL = strings.TrimSuffix(*publicURL, "/")
+	if *webhookSecret == "" {
+		*webhookSecret = os.Getenv("SITEMAPPER_WEBHOOK_SECRET")
+	}
+	if *webhookSecret != "" {
+		s.webhooks = &webhook.Sender{
+			Client:      policy.Client(),
+			Secret:      []byte(*webhookSecret),
+			MaxAttempts: *webhookAttempts,
+			Backoff:     webhookBackoff,
+		}
+	} else {
+		log.Println("No webhook secret configured, callbacks are disabled")
+	}
+
+	scheduleStore, _ := jobStore.(schedules.Store)
+	s.schedules, err = schedules.NewScheduler(scheduleStore, mgr, s.startScheduledJob)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if *retentionAge > 0 || *retentionSize > 0 {
+		go pruneJobs(mgr, *retentionAge, *retentionSize, s.schedules.Retains)
+	}
+
+	http.HandleFunc("/healthz", s.getHealth)
+	http.HandleFunc("/readyz", s.getReadiness)
+	http.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	http.HandleFunc("/sitemap", s.authenticate(s.getSiteMap))
+	http.HandleFunc("/jobs", s.authenticate(s.handleJobs))
+	http.HandleFunc("/jobs/", s.authenticate(s.handleJob))
+	http.HandleFunc("/schedules", s.authenticate(s.handleSchedules))
+	http.HandleFunc("/schedules/", s.authenticate(s.handleSchedule))
 	http.Handle("/", http.FileServer(http.Dir(*staticPath)))
-	http.ListenAndServe(fmt.Sprintf(":%d", *port), nil)
+
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%d", *port),
+		ReadHeaderTimeout: *readTimeout,
+		ReadTimeout:       *readTimeout,
+		WriteTimeout:      *writeTimeout,
+		IdleTimeout:       *idleTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	stopped := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		stop()
+
+		log.Printf("Shutting down, waiting up to %v for crawls to finish", *shutdownTimeout)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer cancel()
+		s.shutdown(shutdownCtx, srv)
+		close(stopped)
+	}()
+
+	log.Printf("Starting server on port %d", *port)
+	err = srv.ListenAndServe()
+	if err != http.ErrServerClosed {
+		log.Fatalln(err)
+	}
+	<-stopped
+
+	if closer, ok := jobStore.(io.Closer); ok {
+		err = closer.Close()
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	log.Println("Server stopped")
 }
 
-func getSiteMap(w http.ResponseWriter, r *http.Request) {
+func (s *server) getSiteMap(w http.ResponseWriter, r *http.Request) {
+	if s.isShuttingDown() {
+		writeProblem(w, http.StatusServiceUnavailable, codeShuttingDown, "The server is shutting down")
+		return
+	}
+
+	cr, ok := parseCrawlRequest(w, r)
+	if !ok {
+		return
+	}
+	if cr.callback != "" {
+		writeProblem(w, http.StatusBadRequest, codeInvalidParameter, "Callbacks are only sent for jobs started with POST /jobs")
+		return
+	}
+	u, opts := cr.site, cr.opts
+	opts.Client = s.client
+	opts.Metrics = s.metrics
+
+	select {
+	case s.crawls <- struct{}{}:
+		defer func() { <-s.crawls }()
+	default:
+		writeProblem(w, http.StatusTooManyRequests, codeAtCapacity, "Too many site maps are being created")
+		return
+	}
+
+	q, ok := s.reserve(w, r, opts)
+	if !ok {
+		return
+	} else if q != nil {
+		defer q.release()
+		ctx, cancel := context.WithCancelCause(r.Context())
+		defer cancel(nil)
+		q.onExceeded(func() { cancel(auth.ErrPageQuota) })
+		r = r.WithContext(ctx)
+	}
+
+	if cr.format == "jsonl" {
+		streamSiteMap(w, r, u, opts)
+		return
+	}
+
+	sm, err := mapper.CreateSiteMapWithOptions(r.Context(), u, opts)
+	if err != nil {
+		writeCrawlError(w, r, err, append([]*url.URL{u}, opts.Seeds...))
+		return
+	}
+
+	if writeExport(w, sm, cr.format) {
+		return
+	}
+	writeJSON(w, http.StatusOK, sm)
+}
+
+// writeCrawlError writes the reason a crawl from seeds failed. A seed that
+// could not be fetched or is blocked by the network policy is the caller's
+// problem, while any other page is the fault of the crawled site. A crawl
+// stopped because the client used the pages of the day is over quota.
+func writeCrawlError(w http.ResponseWriter, r *http.Request, err error, seeds []*url.URL) {
+	if context.Cause(r.Context()) == auth.ErrPageQuota {
+		writeProblem(w, http.StatusTooManyRequests, codeQuotaExceeded, auth.ErrPageQuota.Error())
+		return
+	}
+
+	var pe *mapper.PageError
+	if !errors.As(err, &pe) {
+		writeProblem(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+
+	for _, seed := range seeds {
+		if seed.String() != pe.URL.String() {
+			continue
+		}
+
+		var be *netpolicy.BlockedError
+		if errors.As(err, &be) {
+			writeProblem(w, http.StatusUnprocessableEntity, codeSeedBlocked, err.Error())
+		} else {
+			writeProblem(w, http.StatusUnprocessableEntity, codeSeedUnreachable, err.Error())
+		}
+		return
+	}
+	writeProblem(w, http.StatusBadGateway, codeCrawlFailed, err.Error())
+}
+
+// A crawlRequest is a crawl described by an API request.
+type crawlRequest struct {
+	site *url.URL
+	opts *mapper.Options
+
+	// callback is the url notified once a job finishes, if any.
+	callback string
+
+	// format is the format of the site map returned by /sitemap.
+	format string
+}
+
+// parseCrawlRequest returns the crawl described by r. A JSON body is decoded
+// as a crawl config, otherwise the site, workers, callback and format query
+// parameters are used. If the request is invalid, an error is written to w
+// and ok is false.
+func parseCrawlRequest(w http.ResponseWriter, r *http.Request) (cr *crawlRequest, ok bool) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		u, numWorkers, ok := parseSiteQuery(w, r)
+		if !ok {
+			return nil, false
+		}
+		callback, ok := parseCallbackQuery(w, r)
+		if !ok {
+			return nil, false
+		}
+		format, ok := parseFormatQuery(w, r)
+		if !ok {
+			return nil, false
+		}
+		return &crawlRequest{site: u, opts: mapper.DefaultOptions(numWorkers), callback: callback, format: format}, true
+	}
+
+	cr = &crawlRequest{format: "json"}
+	c, err := crawlconfig.Decode(r.Body)
+	if err == nil {
+		cr.site, cr.opts, err = c.Options()
+		cr.callback = c.Callback
+		if c.Format != "" {
+			cr.format = c.Format
+		}
+	}
+
+	if ve, isValidationErr := err.(*crawlconfig.ValidationError); isValidationErr {
+		p := &problem{
+			Status: http.StatusBadRequest,
+			Code:   codeInvalidConfig,
+			Detail: "The crawl config is invalid",
+			Fields: ve.Fields,
+		}
+		if isSeedValidationError(ve) {
+			p.Status = http.StatusUnprocessableEntity
+			p.Code = codeInvalidSeed
+			p.Detail = "The crawl config has invalid seeds"
+		}
+		writeProblemDocument(w, p)
+		return nil, false
+	} else if err != nil {
+		writeProblem(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return nil, false
+	}
+	return cr, true
+}
+
+// isSeedValidationError reports whether the seeds are the only invalid fields
+// of a crawl config.
+func isSeedValidationError(ve *crawlconfig.ValidationError) bool {
+	for _, fe := range ve.Fields {
+		if fe.Field != "seeds" && !strings.HasPrefix(fe.Field, "seeds[") {
+			return false
+		}
+	}
+	return len(ve.Fields) > 0
+}
+
+// parseSiteQuery returns the site and number of workers from the query
+// parameters of r. If either is missing or malformed, an error is written to
+// w and ok is false.
+func parseSiteQuery(w http.ResponseWriter, r *http.Request) (u *url.URL, numWorkers int, ok bool) {
 	_, siteProvided := r.URL.Query()["site"]
 	if !siteProvided {
-		http.Error(w, "Missing query parameter \"site\"", 412)
-		return
+		writeProblem(w, http.StatusBadRequest, codeMissingParameter, "Missing query parameter \"site\"")
+		return nil, 0, false
 	}
 
 	_, workersProvided := r.URL.Query()["workers"]
 	if !workersProvided {
-		http.Error(w, "Missing query parameter \"workers\"", 412)
-		return
+		writeProblem(w, http.StatusBadRequest, codeMissingParameter, "Missing query parameter \"workers\"")
+		return nil, 0, false
 	}
 
 	siteStr := r.URL.Query()["site"][0]
 	u, err := url.Parse(siteStr)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
-		return
+		writeProblem(w, http.StatusUnprocessableEntity, codeInvalidSeed, err.Error())
+		return nil, 0, false
+	} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		writeProblem(w, http.StatusUnprocessableEntity, codeInvalidSeed, "Query parameter \"site\" must be an absolute http or https url")
+		return nil, 0, false
 	}
 
 	numWorkersStr := r.URL.Query()["workers"][0]
-	numWorkers, err := strconv.Atoi(numWorkersStr)
-	if err != nil {
-		http.Error(w, err.Error(), 500)
-		return
+	numWorkers, err = strconv.Atoi(numWorkersStr)
+	if err != nil || numWorkers < 1 || numWorkers > crawlconfig.MaxWorkers {
+		detail := fmt.Sprintf("Query parameter \"workers\" must be an integer between 1 and %d", crawlconfig.MaxWorkers)
+		writeProblem(w, http.StatusBadRequest, codeInvalidParameter, detail)
+		return nil, 0, false
 	}
 
-	sm, err := mapper.CreateSiteMap(u, numWorkers)
-	if err != nil {
-		http.Error(w, err.Error(), 500)
-		return
+	return u, numWorkers, true
+}
+
+// parseCallbackQuery returns the optional callback query parameter of r. If
+// it is not an absolute http or https url, an error is written to w and ok
+// is false.
+func parseCallbackQuery(w http.ResponseWriter, r *http.Request) (callback string, ok bool) {
+	callback = r.URL.Query().Get("callback")
+	if callback == "" {
+		return "", true
+	}
+
+	u, err := url.Parse(callback)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		writeProblem(w, http.StatusBadRequest, codeInvalidParameter, "Query parameter \"callback\" must be an absolute http or https url")
+		return "", false
+	}
+	return callback, true
+}
+
+// parseFormatQuery returns the format query parameter of r, which defaults
+// to json. If it is not a supported format, an error is written to w and ok
+// is false.
+func parseFormatQuery(w http.ResponseWriter, r *http.Request) (format string, ok bool) {
+	format = r.URL.Query().Get("format")
+	if format == "" {
+		return "json", true
+	}
+
+	for _, f := range crawlconfig.Formats {
+		if f == format {
+			return format, true
+		}
+	}
+	detail := fmt.Sprintf("Query parameter \"format\" must be one of %s", strings.Join(crawlconfig.Formats, ", "))
+	writeProblem(w, http.StatusBadRequest, codeInvalidParameter, detail)
+	return "", false
+}
+
+// openStore returns the job store of the specified type, saving to path.
+func openStore(storeType, path string) (jobs.Store, error) {
+	switch storeType {
+	case "memory":
+		return nil, nil
+	case "file":
+		return store.NewFileStore(path)
+	case "bolt":
+		return store.NewBoltStore(path)
+	default:
+		return nil, fmt.Errorf("unknown store %q", storeType)
+	}
+}
+
+// webhookBackoff is the delay before a failed webhook is first retried,
+// doubled for every retry after.
+const webhookBackoff = time.Second
+
+// pruneInterval is how often finished jobs are pruned by the retention
+// policy.
+const pruneInterval = 10 * time.Minute
+
+// pruneJobs periodically deletes jobs by the retention policy, except those
+// kept by keep.
+func pruneJobs(mgr *jobs.Manager, maxAge time.Duration, maxBytes int64, keep func(js *jobs.JobStatus) bool) {
+	for {
+		deleted, err := mgr.Prune(maxAge, maxBytes, keep)
+		if err != nil {
+			log.Printf("Failed to prune jobs: %v", err)
+		} else if deleted > 0 {
+			log.Printf("Pruned %d jobs", deleted)
+		}
+		time.Sleep(pruneInterval)
 	}
+}
 
-	b, err := json.Marshal(sm)
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		writeProblem(w, http.StatusInternalServerError, codeInternal, err.Error())
 		return
 	}
+	writeJSONBytes(w, status, b)
+}
 
-	_, err = w.Write(b)
+func writeJSONBytes(w http.ResponseWriter, status int, b []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err := w.Write(b)
 	if err != nil {
 		log.Println(err)
 	}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"github.com/jordanpotter/sitemapper/internal/jobs"
+	"github.com/jordanpotter/sitemapper/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// newMetricsRegistry returns a registry of the process, crawl and job
+// metrics served at /metrics, along with the crawl metrics to record.
+func newMetricsRegistry(mgr *jobs.Manager) (*prometheus.Registry, *metrics.Crawl, error) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "sitemapper_running_jobs",
+			Help: "Crawl jobs currently running.",
+		}, func() float64 { return float64(mgr.Running()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "sitemapper_queued_jobs",
+			Help: "Crawl jobs waiting to run.",
+		}, func() float64 { return float64(mgr.Queued()) }),
+	)
+
+	crawlMetrics, err := metrics.NewCrawl(reg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return reg, crawlMetrics, nil
+}
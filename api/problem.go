@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/jordanpotter/sitemapper/internal/crawlconfig"
+)
+
+// Machine-readable codes identifying why a request failed.
+const (
+	codeMissingParameter     = "missing-parameter"
+	codeInvalidParameter     = "invalid-parameter"
+	codeInvalidConfig        = "invalid-config"
+	codeInvalidSeed          = "invalid-seed"
+	codeSeedUnreachable      = "seed-unreachable"
+	codeSeedBlocked          = "seed-blocked"
+	codeCrawlFailed          = "crawl-failed"
+	codeAtCapacity           = "at-capacity"
+	codeUnauthorized         = "unauthorized"
+	codeQuotaExceeded        = "quota-exceeded"
+	codeShuttingDown         = "shutting-down"
+	codeJobNotFound          = "job-not-found"
+	codeScheduleNotFound     = "schedule-not-found"
+	codeJobFinished          = "job-finished"
+	codeResultNotReady       = "result-not-ready"
+	codeNotFound             = "not-found"
+	codeMethodNotAllowed     = "method-not-allowed"
+	codeStreamingUnsupported = "streaming-unsupported"
+	codeWebhooksDisabled     = "webhooks-disabled"
+	codeInternal             = "internal-error"
+)
+
+// retryAfterSeconds is the delay suggested to clients turned away because
+// the server is at capacity or shutting down.
+const retryAfterSeconds = "30"
+
+// A problem is an RFC 7807 problem details document describing why a request
+// failed. Code identifies the problem, while Fields lists the invalid fields
+// of a crawl config.
+type problem struct {
+	Type   string                    `json:"type"`
+	Title  string                    `json:"title"`
+	Status int                       `json:"status"`
+	Detail string                    `json:"detail,omitempty"`
+	Code   string                    `json:"code"`
+	Fields []*crawlconfig.FieldError `json:"fields,omitempty"`
+}
+
+func writeProblem(w http.ResponseWriter, status int, code, detail string) {
+	writeProblemDocument(w, &problem{Status: status, Code: code, Detail: detail})
+}
+
+func writeProblemDocument(w http.ResponseWriter, p *problem) {
+	p.Type = "about:blank"
+	p.Title = http.StatusText(p.Status)
+	isRetryable := p.Status == http.StatusTooManyRequests || p.Status == http.StatusServiceUnavailable
+	if isRetryable && w.Header().Get("Retry-After") == "" {
+		w.Header().Set("Retry-After", retryAfterSeconds)
+	}
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	_, err = w.Write(b)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	writeProblem(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Allowed methods are "+allow)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/jordanpotter/sitemapper/internal/crawlconfig"
+	"github.com/jordanpotter/sitemapper/internal/jobs"
+	"github.com/jordanpotter/sitemapper/internal/schedules"
+)
+
+// A scheduleRequest is the body of POST /schedules. Keep defaults to
+// schedules.DefaultKeep.
+type scheduleRequest struct {
+	Cron   string          `json:"cron"`
+	Keep   int             `json:"keep"`
+	Config json.RawMessage `json:"config"`
+}
+
+// handleSchedules serves GET /schedules, which lists the schedules of the
+// client oldest first, and POST /schedules, which creates a schedule.
+func (s *server) handleSchedules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		owned := []*schedules.Schedule{}
+		for _, sch := range s.schedules.List() {
+			if owns(r, sch.Owner) {
+				owned = append(owned, redactSchedule(sch))
+			}
+		}
+		writeJSON(w, http.StatusOK, struct {
+			Schedules []*schedules.Schedule `json:"schedules"`
+		}{owned})
+	case http.MethodPost:
+		s.createSchedule(w, r)
+	default:
+		writeMethodNotAllowed(w, "GET, POST")
+	}
+}
+
+// handleSchedule serves GET and DELETE /schedules/{id}, which return and
+// delete a schedule respectively. Schedules of other clients are not found.
+func (s *server) handleSchedule(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/schedules/"), "/")
+	if id == "" || strings.Contains(id, "/") {
+		writeProblem(w, http.StatusNotFound, codeNotFound, "No resource at "+r.URL.Path)
+		return
+	}
+
+	sch, err := s.schedules.Get(id)
+	if err == nil && !owns(r, sch.Owner) {
+		err = schedules.ErrScheduleNotFound
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if err != nil {
+			writeScheduleError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, redactSchedule(sch))
+	case http.MethodDelete:
+		if err == nil {
+			err = s.schedules.Delete(id)
+		}
+		if err != nil {
+			writeScheduleError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeMethodNotAllowed(w, "GET, DELETE")
+	}
+}
+
+func (s *server) createSchedule(w http.ResponseWriter, r *http.Request) {
+	if s.isShuttingDown() {
+		writeProblem(w, http.StatusServiceUnavailable, codeShuttingDown, "The server is shutting down")
+		return
+	}
+
+	var req scheduleRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&req)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, codeInvalidConfig, "Malformed schedule: "+err.Error())
+		return
+	}
+
+	c, fields, err := validateScheduleRequest(&req)
+	if err != nil {
+		writeProblem(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	} else if len(fields) > 0 {
+		writeProblemDocument(w, &problem{
+			Status: http.StatusBadRequest,
+			Code:   codeInvalidConfig,
+			Detail: "The schedule is invalid",
+			Fields: fields,
+		})
+		return
+	} else if c.Callback != "" && s.webhooks == nil {
+		writeProblem(w, http.StatusBadRequest, codeWebhooksDisabled, "Callbacks are disabled as no webhook secret is configured")
+		return
+	}
+
+	sch := &schedules.Schedule{Cron: req.Cron, Keep: req.Keep, Config: c, Owner: requestOwner(r)}
+
+	sch, err = s.schedules.Create(sch)
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/schedules/"+sch.ID)
+	writeJSON(w, http.StatusCreated, redactSchedule(sch))
+}
+
+// redactSchedule returns sch with the credentials of its crawl config
+// redacted, as schedules are returned to their owner long after they were
+// created.
+func redactSchedule(sch *schedules.Schedule) *schedules.Schedule {
+	rs := *sch
+	rs.Config = sch.Config.Redacted()
+	return &rs
+}
+
+// validateScheduleRequest returns the crawl config of a schedule, along with
+// every invalid field of the request. Fields of the crawl config are
+// prefixed with "config.".
+func validateScheduleRequest(req *scheduleRequest) (*crawlconfig.Config, []*crawlconfig.FieldError, error) {
+	var fields []*crawlconfig.FieldError
+	addField := func(field, format string, args ...interface{}) {
+		fields = append(fields, &crawlconfig.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	_, err := schedules.ParseCron(req.Cron)
+	if err != nil {
+		addField("cron", "%v", err)
+	}
+
+	if req.Keep == 0 {
+		req.Keep = schedules.DefaultKeep
+	} else if req.Keep < 1 || req.Keep > schedules.MaxKeep {
+		addField("keep", "must be between 1 and %d, or 0 for the default", schedules.MaxKeep)
+	}
+
+	if len(req.Config) == 0 {
+		addField("config", "required")
+		return nil, fields, nil
+	}
+
+	c, err := crawlconfig.Decode(bytes.NewReader(req.Config))
+	if ve, ok := err.(*crawlconfig.ValidationError); ok {
+		for _, fe := range ve.Fields {
+			field := "config"
+			if fe.Field != "" {
+				field += "." + fe.Field
+			}
+			addField(field, "%s", fe.Message)
+		}
+	} else if err != nil {
+		return nil, nil, err
+	}
+	return c, fields, nil
+}
+
+// startScheduledJob starts the job of a run of a schedule, against the quota
+// of the client that created the schedule.
+func (s *server) startScheduledJob(sch *schedules.Schedule) (*jobs.Job, error) {
+	u, opts, err := sch.Config.Options()
+	if err != nil {
+		return nil, err
+	}
+	opts.Client = s.client
+	opts.Metrics = s.metrics
+
+	var q *quotaUse
+	if s.keyring != nil && sch.Owner != "" {
+		c, ok := s.keyring.Client(sch.Owner)
+		if !ok {
+			return nil, fmt.Errorf("no API key is named %q", sch.Owner)
+		}
+		q, err = applyQuota(c, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	callback := sch.Config.Callback
+	if callback != "" && s.webhooks == nil {
+		log.Printf("Not notifying callback of schedule %s, as no webhook secret is configured", sch.ID)
+		callback = ""
+	}
+	return s.startJobWithCallback(nil, u, opts, sch.Owner, q, callback)
+}
+
+func writeScheduleError(w http.ResponseWriter, err error) {
+	switch err {
+	case schedules.ErrScheduleNotFound:
+		writeProblem(w, http.StatusNotFound, codeScheduleNotFound, err.Error())
+	default:
+		writeProblem(w, http.StatusInternalServerError, codeInternal, err.Error())
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jordanpotter/sitemapper/internal/jobs"
+)
+
+// A webhookPayload is the body of the webhook sent once a job has finished.
+// Event is "job." followed by the job's final status, while Result links to
+// the site map of a job that completed successfully.
+type webhookPayload struct {
+	Event  string          `json:"event"`
+	Job    *jobs.JobStatus `json:"job"`
+	Result string          `json:"result,omitempty"`
+}
+
+// errDeliveryInterrupted is recorded for webhooks not delivered before the
+// server shut down.
+const errDeliveryInterrupted = "delivery interrupted by server shutdown"
+
+// notify sends the webhook of job j to callback once the job has finished,
+// recording every attempt in the job's status. It must be called after
+// s.deliveries.Add.
+func (s *server) notify(j *jobs.Job, callback, resultURL string) {
+	defer s.deliveries.Done()
+
+	ws := &jobs.WebhookStatus{URL: callback, State: jobs.WebhookPending}
+	<-j.Done()
+
+	js := j.Status()
+	js.Webhook = nil
+	payload := &webhookPayload{Event: "job." + string(js.Status), Job: js}
+	if js.Status == jobs.Done {
+		payload.Result = resultURL
+	}
+
+	body, err := json.Marshal(payload)
+	if err == nil {
+		err = s.webhooks.Send(s.deliveryCtx, callback, payload.Event, body, func(attempt int, err error) {
+			ws.Attempts = attempt
+			if err != nil {
+				ws.LastError = err.Error()
+			} else {
+				delivered := time.Now()
+				ws.State = jobs.WebhookDelivered
+				ws.LastError = ""
+				ws.Delivered = &delivered
+			}
+			s.setWebhook(j.ID, ws)
+		})
+	}
+
+	if err != nil {
+		ws.State = jobs.WebhookFailed
+		ws.LastError = err.Error()
+		if s.deliveryCtx.Err() != nil {
+			ws.LastError = errDeliveryInterrupted
+		}
+		s.setWebhook(j.ID, ws)
+	}
+}
+
+// setWebhook records the delivery of a job's webhook. A failure is logged
+// rather than returned, as the delivery itself is unaffected.
+func (s *server) setWebhook(id string, ws *jobs.WebhookStatus) {
+	err := s.jobs.SetWebhook(id, ws)
+	if err != nil {
+		log.Printf("Failed to save webhook of job %s: %v", id, err)
+	}
+}
+
+// resultURL returns the url of the result of the job with the specified id,
+// based on the public url of the server or else the host r was sent to. If
+// neither is known, the url is relative to the server.
+func (s *server) resultURL(r *http.Request, id string) string {
+	base := s.publicURL
+	if base == "" && r != nil {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		base = scheme + "://" + r.Host
+	}
+	return base + "/jobs/" + id + "/result"
+}
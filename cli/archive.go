@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jordanpotter/sitemapper/internal/mapper"
+	"github.com/jordanpotter/sitemapper/internal/warc"
+)
+
+// An archive records every request made by a crawl to a WARC file, along
+// with the assets of each page if they are archived too.
+type archive struct {
+	filename string
+	f        *os.File
+	w        *warc.Writer
+	assets   *warc.AssetFetcher
+}
+
+// createArchive creates the WARC file filename and sets opts to archive the
+// crawl to it, fetching the assets of each page with numWorkers workers if
+// withAssets is set.
+func createArchive(ctx context.Context, filename string, opts *mapper.Options, withAssets bool, numWorkers int) (*archive, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := warc.NewWriter(f, filepath.Base(filename))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	a := &archive{filename: filename, f: f, w: w}
+	opts.Client = &http.Client{Transport: &warc.Transport{Writer: w}}
+	if withAssets {
+		a.assets = warc.NewAssetFetcher(ctx, opts.Client, opts.Headers, numWorkers)
+		onPageMap := opts.OnPageMap
+		opts.OnPageMap = func(pm *mapper.PageMap) {
+			if onPageMap != nil {
+				onPageMap(pm)
+			}
+			a.assets.Fetch(pm.Assets)
+		}
+	}
+	return a, nil
+}
+
+// Close waits for the assets to be archived, then closes the WARC file and
+// writes its CDX index.
+func (a *archive) Close() error {
+	if a.assets != nil {
+		a.assets.Close()
+	}
+
+	err := a.f.Close()
+	if err != nil {
+		return err
+	} else if a.w.Err() != nil {
+		return a.w.Err()
+	}
+
+	return writeFile(a.cdxFilename(), a.w.WriteCDX)
+}
+
+// cdxFilename returns the name of the CDX index of the archive, which
+// replaces the .warc.gz extension of the archive with .cdx.
+func (a *archive) cdxFilename() string {
+	name := strings.TrimSuffix(a.filename, ".gz")
+	name = strings.TrimSuffix(name, ".warc")
+	return name + ".cdx"
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/jordanpotter/sitemapper/internal/mapper"
+)
+
+// runDiff runs the diff command, which compares two site maps written by
+// earlier crawls. Like diff(1), it exits with status 0 if the site maps are
+// the same, 1 if they differ and 2 if they could not be compared.
+func runDiff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: cli diff [flags] old.json new.json")
+		fs.PrintDefaults()
+	}
+	format := fs.String("format", "text", "output format, either text or json")
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	} else if *format != "text" && *format != "json" {
+		log.Printf("Unknown format %q", *format)
+		os.Exit(2)
+	}
+
+	old, err := readSiteMap(fs.Arg(0))
+	if err != nil {
+		log.Println(err)
+		os.Exit(2)
+	}
+	newer, err := readSiteMap(fs.Arg(1))
+	if err != nil {
+		log.Println(err)
+		os.Exit(2)
+	}
+
+	d := mapper.CreateSiteMapDiff(old, newer)
+	if *format == "json" {
+		err = json.NewEncoder(os.Stdout).Encode(d)
+	} else {
+		err = writeDiffText(os.Stdout, d)
+	}
+	if err != nil {
+		log.Println(err)
+		os.Exit(2)
+	}
+
+	if !d.IsEmpty() {
+		os.Exit(1)
+	}
+}
+
+func readSiteMap(filename string) (*mapper.SiteMap, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var sm mapper.SiteMap
+	err = json.Unmarshal(b, &sm)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return &sm, nil
+}
+
+// writeDiffText writes d in a format similar to a unified diff, with added
+// pages, links and assets prefixed by + and removed ones by -.
+func writeDiffText(w io.Writer, d *mapper.SiteMapDiff) error {
+	ew := &errWriter{w: w}
+	for _, u := range d.Added {
+		ew.printf("+ %s\n", u)
+	}
+	for _, u := range d.Removed {
+		ew.printf("- %s\n", u)
+	}
+	for _, pd := range d.Changed {
+		ew.printf("~ %s\n", pd.URL)
+		if pd.StatusChanged() {
+			ew.printf("    status %d -> %d\n", pd.OldStatus, pd.NewStatus)
+		}
+		for _, u := range pd.LinksAdded {
+			ew.printf("    + link %s\n", u)
+		}
+		for _, u := range pd.LinksRemoved {
+			ew.printf("    - link %s\n", u)
+		}
+		for _, u := range pd.AssetsAdded {
+			ew.printf("    + asset %s\n", u)
+		}
+		for _, u := range pd.AssetsRemoved {
+			ew.printf("    - asset %s\n", u)
+		}
+	}
+	ew.printf("%d added, %d removed, %d changed\n", len(d.Added), len(d.Removed), len(d.Changed))
+	return ew.err
+}
+
+// errWriter records the first error writing to w, after which writes are
+// skipped.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...interface{}) {
+	if ew.err == nil {
+		_, ew.err = fmt.Fprintf(ew.w, format, args...)
+	}
+}
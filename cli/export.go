@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jordanpotter/sitemapper/internal/export"
+	"github.com/jordanpotter/sitemapper/internal/mapper"
+)
+
+// formats lists the supported output formats.
+var formats = []string{"json", "jsonl", "csv", "graphml", "gexf", "dot"}
+
+// graphWriters write the link graph of a site map in each graph format.
+var graphWriters = map[string]func(io.Writer, *mapper.SiteMap, *export.GraphOptions) error{
+	"graphml": export.WriteGraphML,
+	"gexf":    export.WriteGEXF,
+	"dot":     export.WriteDOT,
+}
+
+func isFormat(format string) bool {
+	for _, f := range formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultFilename returns the file written to with format when --file is not
+// set.
+func defaultFilename(format string) string {
+	switch format {
+	case "csv":
+		return "sitemap.zip"
+	case "graphml", "gexf", "dot":
+		return "sitemap." + format
+	}
+	return "sitemap.json"
+}
+
+// writeCSV writes the csv tables of sm to a zip file if filename ends in
+// .zip, or to the directory filename otherwise.
+func writeCSV(filename string, sm *mapper.SiteMap, opts *export.CSVOptions) error {
+	if !strings.HasSuffix(filename, ".zip") {
+		return export.WriteCSVDir(filename, sm, opts)
+	}
+	return writeFile(filename, func(w io.Writer) error {
+		return export.WriteCSVZip(w, sm, opts)
+	})
+}
+
+// writeGraph writes the link graph of sm to filename in a graph format.
+func writeGraph(filename, format string, sm *mapper.SiteMap, opts *export.GraphOptions) error {
+	return writeFile(filename, func(w io.Writer) error {
+		return graphWriters[format](w, sm, opts)
+	})
+}
+
+func writeFile(filename string, write func(io.Writer) error) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	err = write(f)
+	closeErr := f.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
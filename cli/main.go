@@ -1,41 +1,282 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net/url"
+	"os"
+	"os/signal"
 	"runtime"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/jordanpotter/sitemapper/internal/export"
 	"github.com/jordanpotter/sitemapper/internal/mapper"
+	"github.com/jordanpotter/sitemapper/internal/metrics"
+	"github.com/jordanpotter/sitemapper/internal/store"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "diff":
+			runDiff(os.Args[2:])
+			return
+		case "report":
+			runReport(os.Args[2:])
+			return
+		}
+	}
+
 	site := flag.String("site", "", "entry point into site to scan")
 	numWorkers := flag.Int("workers", runtime.NumCPU(), "number of workers")
-	filename := flag.String("file", "sitemap.json", "file to write to")
+	filename := flag.String("file", "sitemap.json", "file to write to, or - for standard output with the jsonl format, defaulting to sitemap.zip with the csv format and sitemap.FORMAT with graph formats")
+	format := flag.String("format", "json", "output format, either json, jsonl to write each page map as it is processed, csv to write pages, links and assets tables to a zip file or directory, or graphml, gexf or dot to write the link graph")
+	pageColumns := flag.String("page-columns", strings.Join(export.PageColumns, ","), "comma separated columns of the csv pages table")
+	linkColumns := flag.String("link-columns", strings.Join(export.LinkColumns, ","), "comma separated columns of the csv links table")
+	assetColumns := flag.String("asset-columns", strings.Join(export.AssetColumns, ","), "comma separated columns of the csv assets table")
+	dropAssets := flag.Bool("drop-assets", false, "leave assets out of graph formats")
+	dropExternal := flag.Bool("drop-external", false, "leave pages on other hosts out of graph formats")
+	frontierFile := flag.String("frontier", "", "temporary BoltDB file to keep the queue of pages to crawl in, instead of memory")
+	lazyAttrs := flag.String("lazy-attrs", strings.Join(mapper.DefaultLazyAssetAttrs, ","), "comma separated attributes holding lazy-loaded asset urls")
+	checkFragments := flag.Bool("check-fragments", false, "report links to missing anchors")
+	schemeReport := flag.String("scheme-report", "", "file to write exposed emails, phone numbers and javascript links to")
+	showProgress := flag.Bool("progress", true, "show a progress line instead of logging each page")
+	showMetrics := flag.Bool("metrics", false, "print a summary of crawl metrics once the crawl ends")
+	previous := flag.String("previous", "", "site map of an earlier crawl, whose unmodified pages are reused")
+	checkpointFile := flag.String("checkpoint", "", "file to periodically save the state of the crawl to")
+	checkpointInterval := flag.Duration("checkpoint-interval", 30*time.Second, "how often to save the state of the crawl")
+	resume := flag.String("resume", "", "checkpoint file to resume an interrupted crawl from")
+	warcFile := flag.String("warc", "", "WARC file to archive every request and response to, with a CDX index alongside")
+	warcAssets := flag.Bool("warc-assets", false, "also fetch and archive the assets of each page")
 	flag.Parse()
 
+	if !isFormat(*format) {
+		log.Fatalf("Unknown format %q", *format)
+	} else if *format == "jsonl" && (*checkpointFile != "" || *resume != "") {
+		log.Fatalln("Checkpoints are not supported with the jsonl format")
+	} else if *format != "jsonl" && *filename == "-" {
+		log.Fatalln("Standard output requires the jsonl format")
+	} else if *warcFile != "" && *resume != "" {
+		log.Fatalln("Archiving is not supported when resuming, as the pages already crawled would be missing from the archive")
+	}
+	if !isFlagSet("file") {
+		*filename = defaultFilename(*format)
+	}
+	csvOpts := &export.CSVOptions{
+		PageColumns:  splitList(*pageColumns),
+		LinkColumns:  splitList(*linkColumns),
+		AssetColumns: splitList(*assetColumns),
+	}
+	if err := csvOpts.Validate(); *format == "csv" && err != nil {
+		log.Fatalln(err)
+	}
+	graphOpts := &export.GraphOptions{DropAssets: *dropAssets, DropExternal: *dropExternal}
+
+	var cp *mapper.Checkpoint
+	var err error
+	if *resume != "" {
+		cp, err = readCheckpoint(*resume)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if *site == "" {
+			*site = cp.URL.String()
+		}
+		if *checkpointFile == "" {
+			*checkpointFile = *resume
+		}
+	}
+
 	siteURL, err := url.Parse(*site)
 	if err != nil {
 		log.Fatalln(err)
 	}
 
-	sm, err := mapper.CreateSiteMap(siteURL, *numWorkers)
-	if err != nil {
+	opts := mapper.DefaultOptions(*numWorkers)
+	opts.LazyAssetAttrs = splitList(*lazyAttrs)
+	opts.CheckFragments = *checkFragments
+	opts.Resume = cp
+	if *checkpointFile != "" {
+		opts.CheckpointInterval = *checkpointInterval
+		opts.OnCheckpoint = func(cp *mapper.Checkpoint) {
+			err := writeCheckpoint(*checkpointFile, cp)
+			if err != nil {
+				log.Printf("Failed to save checkpoint: %v", err)
+			}
+		}
+	}
+	if *previous != "" {
+		opts.Previous, err = readSiteMap(*previous)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+	var pw *pageWriter
+	if *format == "jsonl" {
+		pw, err = createPageWriter(*filename)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		opts.DiscardPageMaps = true
+		opts.OnPageMap = pw.write
+	}
+	var frontier *store.BoltFrontier
+	if *frontierFile != "" {
+		frontier, err = store.NewBoltFrontier(*frontierFile)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		opts.Frontier = frontier
+	}
+	if *showProgress {
+		p := &progress{w: os.Stderr}
+		opts.OnEvent = p.onEvent
+		log.SetOutput(p)
+	}
+	reg := prometheus.NewRegistry()
+	if *showMetrics {
+		opts.Metrics, err = metrics.NewCrawl(reg)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var a *archive
+	if *warcFile != "" {
+		a, err = createArchive(ctx, *warcFile, opts, *warcAssets, *numWorkers)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	sm, err := mapper.CreateSiteMapWithOptions(ctx, siteURL, opts)
+	log.SetOutput(os.Stderr)
+	if a != nil {
+		archiveErr := a.Close()
+		if archiveErr != nil {
+			log.Fatalln(archiveErr)
+		}
+		log.Printf("Archive written to %s", *warcFile)
+	}
+	if frontier != nil {
+		frontier.Close()
+		os.Remove(*frontierFile)
+	}
+	if pw != nil {
+		writeErr := pw.Close()
+		if writeErr != nil {
+			log.Fatalln(writeErr)
+		}
+	}
+	if *showMetrics {
+		metricsErr := metrics.WriteSummary(os.Stderr, reg)
+		if metricsErr != nil {
+			log.Println(metricsErr)
+		}
+	}
+	if err != nil && *checkpointFile != "" {
+		log.Fatalf("%v, resume with --resume %s", err, *checkpointFile)
+	} else if err != nil {
 		log.Fatalln(err)
 	}
 
-	b, err := json.Marshal(sm)
+	for _, bf := range sm.BrokenFragments {
+		log.Printf("Broken fragment link %s on %s", bf.Link, bf.Page)
+	}
+
+	switch *format {
+	case "json":
+		err = writeJSON(*filename, sm)
+	case "csv":
+		err = writeCSV(*filename, sm, csvOpts)
+	case "graphml", "gexf", "dot":
+		err = writeGraph(*filename, *format, sm, graphOpts)
+	}
 	if err != nil {
 		log.Fatalln(err)
 	}
+	if *filename != "-" {
+		log.Printf("Site map written to %s", *filename)
+	}
 
-	err = ioutil.WriteFile(*filename, b, 400)
+	if *checkpointFile != "" {
+		err = os.Remove(*checkpointFile)
+		if err != nil && !os.IsNotExist(err) {
+			log.Println(err)
+		}
+	}
+
+	if *schemeReport != "" {
+		if pw != nil {
+			sm = pw.schemePages
+		}
+		err = writeJSON(*schemeReport, mapper.CreateSchemeLinkReport(sm))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		log.Printf("Scheme link report written to %s", *schemeReport)
+	}
+}
+
+func writeJSON(filename string, v interface{}) error {
+	b, err := json.Marshal(v)
 	if err != nil {
-		log.Fatalln(err)
+		return err
 	}
+	return ioutil.WriteFile(filename, b, 400)
+}
 
-	log.Printf("Site map written to %s", *filename)
+func readCheckpoint(filename string) (*mapper.Checkpoint, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var cp mapper.Checkpoint
+	err = json.Unmarshal(b, &cp)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return &cp, nil
+}
+
+// writeCheckpoint replaces the checkpoint at filename, so that a crawl killed
+// while saving a checkpoint can still resume from the previous one.
+func writeCheckpoint(filename string, cp *mapper.Checkpoint) error {
+	tmp := filename + ".tmp"
+	err := writeJSON(tmp, cp)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
 }
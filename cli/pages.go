@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/jordanpotter/sitemapper/internal/mapper"
+)
+
+// A pageWriter writes each page map to a file as a line of JSON as soon as
+// its page has been processed, so that page maps need not be kept in memory.
+// Lines are written unbuffered, so the file holds every page processed even
+// if the crawl is killed. Only the pages with scheme links are kept, for the
+// scheme link report.
+type pageWriter struct {
+	w   io.WriteCloser
+	enc *json.Encoder
+	err error
+
+	schemePages *mapper.SiteMap
+}
+
+// createPageWriter returns a page writer for the file at filename, or for
+// standard output if filename is "-".
+func createPageWriter(filename string) (*pageWriter, error) {
+	var w io.WriteCloser = os.Stdout
+	if filename != "-" {
+		f, err := os.Create(filename)
+		if err != nil {
+			return nil, err
+		}
+		w = f
+	}
+
+	return &pageWriter{
+		w:           w,
+		enc:         json.NewEncoder(w),
+		schemePages: &mapper.SiteMap{},
+	}, nil
+}
+
+// write writes pm, after which writes are skipped if it failed.
+func (pw *pageWriter) write(pm *mapper.PageMap) {
+	if len(pm.SchemeLinks) > 0 {
+		pw.schemePages.PageMaps = append(pw.schemePages.PageMaps, &mapper.PageMap{URL: pm.URL, SchemeLinks: pm.SchemeLinks})
+	}
+	if pw.err == nil {
+		pw.err = pw.enc.Encode(pm)
+	}
+}
+
+// Close closes the file, returning the first error writing to it.
+func (pw *pageWriter) Close() error {
+	if pw.w == os.Stdout {
+		return pw.err
+	}
+
+	err := pw.w.Close()
+	if pw.err == nil {
+		pw.err = err
+	}
+	return pw.err
+}
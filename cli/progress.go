@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jordanpotter/sitemapper/internal/mapper"
+)
+
+// progressInterval limits how often the progress line is redrawn.
+const progressInterval = 100 * time.Millisecond
+
+// pageLogPrefixes start the messages logged for each page, which the
+// progress line replaces.
+var pageLogPrefixes = []string{"Creating site map ", "Processed "}
+
+// progress prints a single line, redrawn in place, describing how far a
+// crawl has progressed. As the destination of the log, it drops the messages
+// logged for each page and prints any other message above the line.
+type progress struct {
+	m                              sync.Mutex
+	w                              io.Writer
+	queued, fetched, failed, links int
+	drawn                          time.Time
+}
+
+func (p *progress) Write(b []byte) (int, error) {
+	msg := string(b)
+	if prefix := len("2006/01/02 15:04:05 "); log.Flags() == log.LstdFlags && len(msg) > prefix {
+		msg = msg[prefix:]
+	}
+	for _, prefix := range pageLogPrefixes {
+		if strings.HasPrefix(msg, prefix) {
+			return len(b), nil
+		}
+	}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+	fmt.Fprintf(p.w, "\r\033[K%s", b)
+	p.draw()
+	return len(b), nil
+}
+
+func (p *progress) onEvent(e *mapper.Event) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	switch e.Type {
+	case mapper.PageQueued:
+		p.queued++
+	case mapper.PageFetched:
+		p.fetched++
+	case mapper.PageFailed:
+		p.failed++
+	case mapper.LinkDiscovered:
+		p.links++
+	}
+
+	finished := e.Type == mapper.CrawlFinished
+	if !finished && time.Since(p.drawn) < progressInterval {
+		return
+	}
+	p.drawn = time.Now()
+
+	p.draw()
+	if finished {
+		fmt.Fprintln(p.w)
+	}
+}
+
+func (p *progress) draw() {
+	pending := p.queued - p.fetched - p.failed
+	fmt.Fprintf(p.w, "\r%d fetched, %d pending, %d failed, %d links", p.fetched, pending, p.failed, p.links)
+}
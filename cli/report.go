@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jordanpotter/sitemapper/internal/report"
+)
+
+// runReport runs the report command, which writes a static HTML report of a
+// site map written by an earlier crawl.
+func runReport(args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: cli report [flags] sitemap.json")
+		fs.PrintDefaults()
+	}
+	out := fs.String("out", "report", "directory to write the report to")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	sm, err := readSiteMap(fs.Arg(0))
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	err = report.Write(*out, sm)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	log.Printf("Report written to %s/index.html", *out)
+}
@@ -0,0 +1,252 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrMissingKey is returned when a request does not include an API key.
+	ErrMissingKey = errors.New("missing api key")
+
+	// ErrInvalidKey is returned when a request includes an unknown API key.
+	ErrInvalidKey = errors.New("invalid api key")
+
+	// ErrJobQuota is returned when a client already has as many concurrent
+	// jobs as its quota allows.
+	ErrJobQuota = errors.New("concurrent job quota exceeded")
+
+	// ErrPageQuota is returned when a client has crawled as many pages today
+	// as its quota allows.
+	ErrPageQuota = errors.New("daily page quota exceeded")
+
+	// ErrWorkerQuota is returned when a request uses more workers than the
+	// client's quota allows.
+	ErrWorkerQuota = errors.New("worker quota exceeded")
+)
+
+// A Quota limits the crawling done by a client. Zero means no limit.
+type Quota struct {
+	ConcurrentJobs int `json:"concurrentJobs"`
+	PagesPerDay    int `json:"pagesPerDay"`
+	MaxWorkers     int `json:"maxWorkers"`
+}
+
+// A Key is an API key along with the name and quota of its client.
+type Key struct {
+	Key   string `json:"key"`
+	Name  string `json:"name"`
+	Quota Quota  `json:"quota"`
+}
+
+// A Config lists the API keys accepted by the server.
+type Config struct {
+	Keys []*Key `json:"keys"`
+}
+
+// LoadConfig reads a config from the JSON file at path.
+func LoadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return DecodeConfig(f)
+}
+
+// DecodeConfig reads a JSON config from r.
+func DecodeConfig(r io.Reader) (*Config, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	var c Config
+	err := dec.Decode(&c)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// A Keyring authenticates requests by their API key and tracks the quota
+// usage of each client.
+type Keyring struct {
+	keys    [][]byte
+	clients []*Client
+}
+
+// NewKeyring returns a keyring accepting the keys of c.
+func NewKeyring(c *Config) (*Keyring, error) {
+	kr := &Keyring{}
+	seen := make(map[string]bool)
+	names := make(map[string]bool)
+	for i, k := range c.Keys {
+		if k.Key == "" {
+			return nil, fmt.Errorf("key %d is empty", i)
+		} else if seen[k.Key] {
+			return nil, fmt.Errorf("key %d is a duplicate", i)
+		} else if k.Quota.ConcurrentJobs < 0 || k.Quota.PagesPerDay < 0 || k.Quota.MaxWorkers < 0 {
+			return nil, fmt.Errorf("key %d has a negative quota", i)
+		}
+		seen[k.Key] = true
+
+		name := k.Name
+		if name == "" {
+			name = fmt.Sprintf("key %d", i)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("key %d has a duplicate name %q", i, name)
+		}
+		names[name] = true
+
+		kr.keys = append(kr.keys, []byte(k.Key))
+		kr.clients = append(kr.clients, &Client{Name: name, quota: k.Quota, now: time.Now})
+	}
+	return kr, nil
+}
+
+// Authenticate returns the client whose API key is sent with r, either as a
+// bearer token or in the X-API-Key header.
+func (kr *Keyring) Authenticate(r *http.Request) (*Client, error) {
+	key := r.Header.Get("X-API-Key")
+	if authz := r.Header.Get("Authorization"); key == "" && authz != "" {
+		const prefix = "Bearer "
+		if len(authz) < len(prefix) || !strings.EqualFold(authz[:len(prefix)], prefix) {
+			return nil, ErrInvalidKey
+		}
+		key = strings.TrimSpace(authz[len(prefix):])
+	}
+	if key == "" {
+		return nil, ErrMissingKey
+	}
+
+	var found *Client
+	for i, k := range kr.keys {
+		if subtle.ConstantTimeCompare(k, []byte(key)) == 1 {
+			found = kr.clients[i]
+		}
+	}
+	if found == nil {
+		return nil, ErrInvalidKey
+	}
+	return found, nil
+}
+
+// Client returns the client with the specified name, if any, so that crawls
+// started on its behalf outside of a request count towards its quota.
+func (kr *Keyring) Client(name string) (*Client, bool) {
+	for _, c := range kr.clients {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// A Client is the holder of an API key, whose usage is limited by a quota.
+type Client struct {
+	Name string
+
+	quota Quota
+	now   func() time.Time
+
+	m     sync.Mutex
+	jobs  int
+	pages int
+	day   time.Time
+}
+
+// A Budget is the remaining quota of a client. A limit of zero means there
+// is no limit, in which case the remaining amount is meaningless.
+type Budget struct {
+	JobLimit      int
+	JobsRemaining int
+
+	PageLimit      int
+	PagesRemaining int
+	PagesReset     time.Time
+
+	MaxWorkers int
+}
+
+// Reserve starts a crawl using the specified number of workers, returning a
+// function that must be called once the crawl has finished. Pages are only
+// counted as they are crawled, with AddPage.
+func (c *Client) Reserve(workers int) (release func(), err error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.resetDay()
+	if c.quota.MaxWorkers > 0 && workers > c.quota.MaxWorkers {
+		return nil, ErrWorkerQuota
+	} else if c.quota.ConcurrentJobs > 0 && c.jobs >= c.quota.ConcurrentJobs {
+		return nil, ErrJobQuota
+	} else if c.quota.PagesPerDay > 0 && c.pages >= c.quota.PagesPerDay {
+		return nil, ErrPageQuota
+	}
+
+	c.jobs++
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			c.m.Lock()
+			defer c.m.Unlock()
+			c.jobs--
+		})
+	}
+	return release, nil
+}
+
+// AddPage records that a page has been crawled by the client, counting it
+// towards the day it was crawled on, and reports whether the client may
+// crawl further pages that day.
+func (c *Client) AddPage() bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.resetDay()
+	c.pages++
+	return c.quota.PagesPerDay == 0 || c.pages < c.quota.PagesPerDay
+}
+
+// Budget returns the remaining quota of the client.
+func (c *Client) Budget() *Budget {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.resetDay()
+	return &Budget{
+		JobLimit:       c.quota.ConcurrentJobs,
+		JobsRemaining:  remaining(c.quota.ConcurrentJobs, c.jobs),
+		PageLimit:      c.quota.PagesPerDay,
+		PagesRemaining: remaining(c.quota.PagesPerDay, c.pages),
+		PagesReset:     c.day.AddDate(0, 0, 1),
+		MaxWorkers:     c.quota.MaxWorkers,
+	}
+}
+
+// resetDay clears the daily page count at midnight UTC. It must be called
+// with c.m held.
+func (c *Client) resetDay() {
+	now := c.now().UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if !day.Equal(c.day) {
+		c.day = day
+		c.pages = 0
+	}
+}
+
+func remaining(limit, used int) int {
+	if used >= limit {
+		return 0
+	}
+	return limit - used
+}
@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func createTestKeyring(t *testing.T, keys ...*Key) *Keyring {
+	kr, err := NewKeyring(&Config{Keys: keys})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return kr
+}
+
+func TestDecodeConfig(t *testing.T) {
+	c, err := DecodeConfig(strings.NewReader(`{
+		"keys": [{"key": "secret", "name": "foo", "quota": {"concurrentJobs": 2, "pagesPerDay": 1000, "maxWorkers": 10}}]
+	}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(c.Keys) != 1 {
+		t.Fatalf("Expected 1 key, got %d", len(c.Keys))
+	}
+	k := c.Keys[0]
+	if k.Key != "secret" || k.Name != "foo" {
+		t.Errorf("Unexpected key %+v", k)
+	} else if k.Quota != (Quota{ConcurrentJobs: 2, PagesPerDay: 1000, MaxWorkers: 10}) {
+		t.Errorf("Unexpected quota %+v", k.Quota)
+	}
+
+	_, err = DecodeConfig(strings.NewReader(`{"keys": [{"token": "secret"}]}`))
+	if err == nil {
+		t.Errorf("Expected error for unknown field")
+	}
+}
+
+func TestNewKeyringInvalid(t *testing.T) {
+	testInvalid := func(keys ...*Key) {
+		_, err := NewKeyring(&Config{Keys: keys})
+		if err == nil {
+			t.Errorf("Expected error for keys %+v", keys)
+		}
+	}
+
+	testInvalid(&Key{})
+	testInvalid(&Key{Key: "foo"}, &Key{Key: "foo"})
+	testInvalid(&Key{Key: "foo", Quota: Quota{PagesPerDay: -1}})
+	testInvalid(&Key{Key: "foo", Name: "ci"}, &Key{Key: "bar", Name: "ci"})
+}
+
+func TestKeyringClient(t *testing.T) {
+	kr := createTestKeyring(t, &Key{Key: "foo", Name: "Foo"}, &Key{Key: "bar"})
+
+	c, ok := kr.Client("Foo")
+	if !ok || c.Name != "Foo" {
+		t.Errorf("Expected to find client Foo, got %v", c)
+	}
+	c, ok = kr.Client("key 1")
+	if !ok || c.Name != "key 1" {
+		t.Errorf("Expected to find client key 1, got %v", c)
+	}
+	_, ok = kr.Client("Baz")
+	if ok {
+		t.Errorf("Expected not to find client Baz")
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	kr := createTestKeyring(t, &Key{Key: "foo", Name: "Foo"}, &Key{Key: "bar"})
+
+	testAuthenticate := func(header, value, expectedName string, expectedErr error) {
+		r, err := http.NewRequest(http.MethodGet, "http://localhost/sitemap", nil)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+
+		c, err := kr.Authenticate(r)
+		if err != expectedErr {
+			t.Errorf("Expected error %v for %s %q, got %v", expectedErr, header, value, err)
+		} else if err == nil && c.Name != expectedName {
+			t.Errorf("Expected client %q for %s %q, got %q", expectedName, header, value, c.Name)
+		}
+	}
+
+	testAuthenticate("X-API-Key", "foo", "Foo", nil)
+	testAuthenticate("Authorization", "Bearer foo", "Foo", nil)
+	testAuthenticate("Authorization", "bearer bar", "key 1", nil)
+	testAuthenticate("Authorization", "Basic Zm9vOmJhcg==", "", ErrInvalidKey)
+	testAuthenticate("X-API-Key", "baz", "", ErrInvalidKey)
+	testAuthenticate("", "", "", ErrMissingKey)
+}
+
+func TestClientReserve(t *testing.T) {
+	kr := createTestKeyring(t, &Key{Key: "foo", Quota: Quota{ConcurrentJobs: 2, PagesPerDay: 10, MaxWorkers: 5}})
+	c := kr.clients[0]
+
+	now := time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	_, err := c.Reserve(6)
+	if err != ErrWorkerQuota {
+		t.Errorf("Expected error %v, got %v", ErrWorkerQuota, err)
+	}
+
+	release, err := c.Reserve(5)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	otherRelease, err := c.Reserve(1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = c.Reserve(1)
+	if err != ErrJobQuota {
+		t.Errorf("Expected error %v, got %v", ErrJobQuota, err)
+	}
+
+	b := c.Budget()
+	if b.JobsRemaining != 0 || b.PagesRemaining != 10 || b.MaxWorkers != 5 {
+		t.Errorf("Unexpected budget %+v", b)
+	} else if !b.PagesReset.Equal(time.Date(2016, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected page reset time %v", b.PagesReset)
+	}
+
+	release()
+	release()
+	if b := c.Budget(); b.JobsRemaining != 1 {
+		t.Errorf("Expected 1 job to remain, got %d", b.JobsRemaining)
+	}
+	otherRelease()
+
+	for i := 0; i < 9; i++ {
+		if !c.AddPage() {
+			t.Fatalf("Expected page %d to be within quota", i+1)
+		}
+	}
+	if c.AddPage() {
+		t.Errorf("Expected quota to be used by the last page")
+	}
+	_, err = c.Reserve(1)
+	if err != ErrPageQuota {
+		t.Errorf("Expected error %v, got %v", ErrPageQuota, err)
+	}
+
+	now = now.Add(12 * time.Hour)
+	release, err = c.Reserve(1)
+	if err != nil {
+		t.Fatalf("Expected page quota to reset the next day, got %v", err)
+	}
+	release()
+}
+
+func TestClientAddPageConcurrent(t *testing.T) {
+	kr := createTestKeyring(t, &Key{Key: "foo", Quota: Quota{ConcurrentJobs: 2, PagesPerDay: 10}})
+	c := kr.clients[0]
+
+	now := time.Date(2016, 1, 1, 23, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	// Two crawls without a page limit run at once, sharing the pages of the
+	// day as they crawl them.
+	var releases []func()
+	for i := 0; i < 2; i++ {
+		release, err := c.Reserve(1)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		releases = append(releases, release)
+	}
+	if b := c.Budget(); b.PagesRemaining != 10 {
+		t.Errorf("Expected 10 pages to remain before crawling, got %d", b.PagesRemaining)
+	}
+
+	for i := 0; i < 3; i++ {
+		c.AddPage()
+		c.AddPage()
+	}
+	if b := c.Budget(); b.PagesRemaining != 4 {
+		t.Errorf("Expected 4 pages to remain, got %d", b.PagesRemaining)
+	}
+
+	// Pages crawled after midnight count towards the new day.
+	now = now.Add(2 * time.Hour)
+	if !c.AddPage() {
+		t.Errorf("Expected page to be within the quota of the new day")
+	}
+	if b := c.Budget(); b.PagesRemaining != 9 {
+		t.Errorf("Expected 9 pages to remain, got %d", b.PagesRemaining)
+	}
+
+	for _, release := range releases {
+		release()
+	}
+	if b := c.Budget(); b.JobsRemaining != 2 || b.PagesRemaining != 9 {
+		t.Errorf("Unexpected budget %+v", b)
+	}
+}
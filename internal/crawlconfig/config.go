@@ -0,0 +1,322 @@
+package crawlconfig
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+
+	"github.com/jordanpotter/sitemapper/internal/mapper"
+)
+
+// MaxWorkers is the largest number of workers a single crawl may use.
+const MaxWorkers = 1000
+
+// redacted replaces the credentials of a redacted config.
+const redacted = "REDACTED"
+
+// Formats lists the supported output formats.
+var Formats = []string{"json", "jsonl", "csv", "graphml", "gexf", "dot"}
+
+// A Config is the JSON representation of a crawl, as accepted by the API.
+type Config struct {
+	Seeds          []string          `json:"seeds"`
+	Workers        int               `json:"workers"`
+	Scope          mapper.Scope      `json:"scope"`
+	Limits         Limits            `json:"limits"`
+	Include        []string          `json:"include"`
+	Exclude        []string          `json:"exclude"`
+	Headers        map[string]string `json:"headers"`
+	Auth           *Auth             `json:"auth"`
+	RateLimit      RateLimit         `json:"rateLimit"`
+	LazyAssetAttrs []string          `json:"lazyAssetAttrs"`
+	CheckFragments bool              `json:"checkFragments"`
+	Format         string            `json:"format"`
+	Callback       string            `json:"callback"`
+}
+
+// Limits bound the size of a crawl. Zero means no limit.
+type Limits struct {
+	MaxPages int `json:"maxPages"`
+	MaxDepth int `json:"maxDepth"`
+}
+
+// Auth holds the credentials sent with every page request. Type is either
+// "basic", which uses Username and Password, or "bearer", which uses Token.
+type Auth struct {
+	Type     string `json:"type"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Token    string `json:"token"`
+}
+
+// RateLimit bounds the rate of page requests. Zero means no limit.
+type RateLimit struct {
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+}
+
+// A FieldError describes why a field of a config is invalid.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// A ValidationError lists every invalid field of a config.
+type ValidationError struct {
+	Fields []*FieldError
+}
+
+func (ve *ValidationError) Error() string {
+	msgs := make([]string, 0, len(ve.Fields))
+	for _, fe := range ve.Fields {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", fe.Field, fe.Message))
+	}
+	return "invalid crawl config: " + strings.Join(msgs, "; ")
+}
+
+func (ve *ValidationError) add(field, format string, args ...interface{}) {
+	ve.Fields = append(ve.Fields, &FieldError{
+		Field:   field,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+var unknownFieldRegexp = regexp.MustCompile(`^json: unknown field "(.*)"$`)
+
+// Decode reads a config from r. If the JSON is malformed or the config is
+// invalid, the error is a *ValidationError.
+func Decode(r io.Reader) (*Config, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	var c Config
+	err := dec.Decode(&c)
+	if err != nil {
+		ve := &ValidationError{}
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			ve.add(typeErr.Field, "must be %s", typeErr.Type)
+		} else if m := unknownFieldRegexp.FindStringSubmatch(err.Error()); m != nil {
+			ve.add(m[1], "unknown field")
+		} else {
+			ve.add("", "malformed JSON: %v", err)
+		}
+		return nil, ve
+	}
+
+	err = c.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Validate checks every field of the config, returning a *ValidationError
+// listing all invalid fields.
+func (c *Config) Validate() error {
+	ve := &ValidationError{}
+
+	if len(c.Seeds) == 0 {
+		ve.add("seeds", "at least one seed is required")
+	}
+	for i, seed := range c.Seeds {
+		u, err := url.Parse(seed)
+		if err != nil {
+			ve.add(fmt.Sprintf("seeds[%d]", i), "invalid url: %v", err)
+		} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			ve.add(fmt.Sprintf("seeds[%d]", i), "must be an absolute http or https url")
+		}
+	}
+
+	if c.Workers < 0 || c.Workers > MaxWorkers {
+		ve.add("workers", "must be between 1 and %d, or 0 for the default", MaxWorkers)
+	}
+
+	if c.Scope != "" && !isScope(c.Scope) {
+		ve.add("scope", "must be one of %s", joinScopes())
+	}
+
+	if c.Limits.MaxPages < 0 {
+		ve.add("limits.maxPages", "must not be negative")
+	}
+	if c.Limits.MaxDepth < 0 {
+		ve.add("limits.maxDepth", "must not be negative")
+	}
+
+	for i, expr := range c.Include {
+		if _, err := regexp.Compile(expr); err != nil {
+			ve.add(fmt.Sprintf("include[%d]", i), "invalid regular expression: %v", err)
+		}
+	}
+	for i, expr := range c.Exclude {
+		if _, err := regexp.Compile(expr); err != nil {
+			ve.add(fmt.Sprintf("exclude[%d]", i), "invalid regular expression: %v", err)
+		}
+	}
+
+	names := make([]string, 0, len(c.Headers))
+	for name := range c.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !httpguts.ValidHeaderFieldName(name) {
+			ve.add("headers."+name, "invalid header name")
+		} else if !httpguts.ValidHeaderFieldValue(c.Headers[name]) {
+			ve.add("headers."+name, "invalid header value")
+		}
+	}
+
+	if c.Auth != nil {
+		switch c.Auth.Type {
+		case "basic":
+			if c.Auth.Username == "" {
+				ve.add("auth.username", "required for basic auth")
+			}
+		case "bearer":
+			if c.Auth.Token == "" {
+				ve.add("auth.token", "required for bearer auth")
+			}
+		default:
+			ve.add("auth.type", "must be one of basic, bearer")
+		}
+	}
+
+	if c.RateLimit.RequestsPerSecond < 0 {
+		ve.add("rateLimit.requestsPerSecond", "must not be negative")
+	}
+
+	if c.Format != "" && !isFormat(c.Format) {
+		ve.add("format", "must be one of %s", strings.Join(Formats, ", "))
+	}
+
+	if c.Callback != "" {
+		u, err := url.Parse(c.Callback)
+		if err != nil {
+			ve.add("callback", "invalid url: %v", err)
+		} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			ve.add("callback", "must be an absolute http or https url")
+		}
+	}
+
+	if len(ve.Fields) > 0 {
+		return ve
+	}
+	return nil
+}
+
+// Options returns the first seed and the mapper options described by a
+// valid config.
+func (c *Config) Options() (*url.URL, *mapper.Options, error) {
+	err := c.Validate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	seeds := make([]*url.URL, 0, len(c.Seeds))
+	for _, seed := range c.Seeds {
+		u, err := url.Parse(seed)
+		if err != nil {
+			return nil, nil, err
+		}
+		seeds = append(seeds, u)
+	}
+
+	workers := c.Workers
+	if workers == 0 {
+		workers = runtime.NumCPU()
+	}
+
+	opts := mapper.DefaultOptions(workers)
+	opts.Seeds = seeds[1:]
+	opts.Scope = c.Scope
+	opts.MaxPages = c.Limits.MaxPages
+	opts.MaxDepth = c.Limits.MaxDepth
+	opts.RequestsPerSecond = c.RateLimit.RequestsPerSecond
+	opts.CheckFragments = c.CheckFragments
+	if c.LazyAssetAttrs != nil {
+		opts.LazyAssetAttrs = c.LazyAssetAttrs
+	}
+
+	for _, expr := range c.Include {
+		opts.Include = append(opts.Include, regexp.MustCompile(expr))
+	}
+	for _, expr := range c.Exclude {
+		opts.Exclude = append(opts.Exclude, regexp.MustCompile(expr))
+	}
+
+	opts.Headers = make(http.Header)
+	for name, val := range c.Headers {
+		opts.Headers.Set(name, val)
+	}
+	if c.Auth != nil {
+		switch c.Auth.Type {
+		case "basic":
+			creds := c.Auth.Username + ":" + c.Auth.Password
+			opts.Headers.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(creds)))
+		case "bearer":
+			opts.Headers.Set("Authorization", "Bearer "+c.Auth.Token)
+		}
+	}
+
+	return seeds[0], opts, nil
+}
+
+// Redacted returns a copy of c with the values of its headers and the
+// secrets of its auth replaced, so that it can be shown without disclosing
+// credentials.
+func (c *Config) Redacted() *Config {
+	rc := *c
+	if c.Headers != nil {
+		rc.Headers = make(map[string]string, len(c.Headers))
+		for name := range c.Headers {
+			rc.Headers[name] = redacted
+		}
+	}
+	if c.Auth != nil {
+		auth := *c.Auth
+		if auth.Password != "" {
+			auth.Password = redacted
+		}
+		if auth.Token != "" {
+			auth.Token = redacted
+		}
+		rc.Auth = &auth
+	}
+	return &rc
+}
+
+func isScope(scope mapper.Scope) bool {
+	for _, s := range mapper.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func joinScopes() string {
+	strs := make([]string, 0, len(mapper.Scopes))
+	for _, s := range mapper.Scopes {
+		strs = append(strs, string(s))
+	}
+	return strings.Join(strs, ", ")
+}
+
+func isFormat(format string) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package crawlconfig
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jordanpotter/sitemapper/internal/mapper"
+)
+
+func TestDecode(t *testing.T) {
+	body := `{
+		"seeds": ["https://foo.com", "https://foo.com/docs"],
+		"workers": 8,
+		"scope": "prefix",
+		"limits": {"maxPages": 100, "maxDepth": 3},
+		"include": ["/docs/"],
+		"exclude": ["\\.pdf$"],
+		"headers": {"User-Agent": "sitemapper"},
+		"auth": {"type": "basic", "username": "user", "password": "pass"},
+		"rateLimit": {"requestsPerSecond": 2.5},
+		"checkFragments": true,
+		"format": "json",
+		"callback": "https://ci.foo.com/hooks/crawl"
+	}`
+
+	c, err := Decode(strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if c.Callback != "https://ci.foo.com/hooks/crawl" {
+		t.Errorf("Unexpected callback %q", c.Callback)
+	}
+
+	u, opts, err := c.Options()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if u.String() != "https://foo.com" {
+		t.Errorf("Expected first seed to be %q, got %q", "https://foo.com", u)
+	} else if len(opts.Seeds) != 1 || opts.Seeds[0].String() != "https://foo.com/docs" {
+		t.Errorf("Unexpected additional seeds %v", opts.Seeds)
+	}
+
+	if opts.NumWorkers != 8 || opts.Scope != mapper.ScopePrefix || opts.MaxPages != 100 || opts.MaxDepth != 3 {
+		t.Errorf("Unexpected options %+v", opts)
+	} else if opts.RequestsPerSecond != 2.5 || !opts.CheckFragments {
+		t.Errorf("Unexpected options %+v", opts)
+	}
+
+	if len(opts.Include) != 1 || !opts.Include[0].MatchString("https://foo.com/docs/api") {
+		t.Errorf("Unexpected include expressions %v", opts.Include)
+	} else if len(opts.Exclude) != 1 || !opts.Exclude[0].MatchString("https://foo.com/manual.pdf") {
+		t.Errorf("Unexpected exclude expressions %v", opts.Exclude)
+	}
+
+	if opts.Headers.Get("User-Agent") != "sitemapper" {
+		t.Errorf("Expected User-Agent header, got %v", opts.Headers)
+	} else if opts.Headers.Get("Authorization") != "Basic dXNlcjpwYXNz" {
+		t.Errorf("Unexpected Authorization header %q", opts.Headers.Get("Authorization"))
+	}
+
+	if len(opts.LazyAssetAttrs) != len(mapper.DefaultLazyAssetAttrs) {
+		t.Errorf("Expected default lazy asset attrs, got %v", opts.LazyAssetAttrs)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	c := &Config{
+		Seeds:   []string{"https://foo.com"},
+		Headers: map[string]string{"Cookie": "session=secret"},
+		Auth:    &Auth{Type: "basic", Username: "user", Password: "pass"},
+	}
+
+	rc := c.Redacted()
+	if rc.Headers["Cookie"] != redacted || rc.Auth.Password != redacted {
+		t.Errorf("Expected credentials to be redacted, got %v and %+v", rc.Headers, rc.Auth)
+	} else if rc.Auth.Username != "user" || rc.Auth.Token != "" || rc.Seeds[0] != "https://foo.com" {
+		t.Errorf("Unexpected redacted config %+v", rc)
+	}
+	if c.Headers["Cookie"] != "session=secret" || c.Auth.Password != "pass" {
+		t.Errorf("Expected config to be unchanged, got %v and %+v", c.Headers, c.Auth)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	testInvalid := func(body string, expectedFields ...string) {
+		_, err := Decode(strings.NewReader(body))
+		ve, ok := err.(*ValidationError)
+		if !ok {
+			t.Fatalf("Expected validation error for %s, got %v", body, err)
+		}
+
+		if len(ve.Fields) != len(expectedFields) {
+			t.Fatalf("Expected %d invalid fields for %s, got %v", len(expectedFields), body, ve)
+		}
+		for i, field := range expectedFields {
+			if ve.Fields[i].Field != field {
+				t.Errorf("Expected invalid field %q, got %q", field, ve.Fields[i].Field)
+			}
+		}
+	}
+
+	testInvalid(`{`, "")
+	testInvalid(`{"seeds": ["https://foo.com"], "bogus": 1}`, "bogus")
+	testInvalid(`{"seeds": ["https://foo.com"], "workers": "ten"}`, "workers")
+	testInvalid(`{}`, "seeds")
+	testInvalid(`{
+		"seeds": ["/relative", "ftp://foo.com"],
+		"workers": 5000,
+		"scope": "galaxy",
+		"limits": {"maxPages": -1, "maxDepth": -1},
+		"include": ["("],
+		"exclude": ["["],
+		"headers": {"Bad Header": "x", "X-Ok": "bad\nvalue"},
+		"auth": {"type": "bearer"},
+		"rateLimit": {"requestsPerSecond": -1},
+		"format": "xml",
+		"callback": "/hooks/crawl"
+	}`,
+		"seeds[0]", "seeds[1]", "workers", "scope",
+		"limits.maxPages", "limits.maxDepth", "include[0]", "exclude[0]",
+		"headers.Bad Header", "headers.X-Ok", "auth.token",
+		"rateLimit.requestsPerSecond", "format", "callback")
+}
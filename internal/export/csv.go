@@ -0,0 +1,280 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jordanpotter/sitemapper/internal/mapper"
+)
+
+// The columns of each CSV table, in their default order.
+var (
+	PageColumns  = []string{"url", "status", "depth", "title", "content_type", "size", "latency_ms"}
+	LinkColumns  = []string{"source", "target", "anchor_text", "type", "status"}
+	AssetColumns = []string{"source", "target", "kind"}
+)
+
+// CSVOptions select the columns of each CSV table. A nil list selects every
+// column of the table.
+type CSVOptions struct {
+	PageColumns  []string
+	LinkColumns  []string
+	AssetColumns []string
+}
+
+// Validate returns an error if a column selected by opts does not exist.
+func (opts *CSVOptions) Validate() error {
+	_, err := csvTables(opts)
+	return err
+}
+
+// A csvTable is one of the CSV files exported from a site map.
+type csvTable struct {
+	name    string
+	columns []string
+	write   func(cw *csv.Writer, sm *mapper.SiteMap, columns []string) error
+}
+
+// WriteCSVZip writes the pages, links and assets of sm as the CSV files
+// pages.csv, links.csv and assets.csv within a zip archive.
+func WriteCSVZip(w io.Writer, sm *mapper.SiteMap, opts *CSVOptions) error {
+	tables, err := csvTables(opts)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	modified := time.Now()
+	for _, t := range tables {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: t.name, Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return err
+		}
+		err = writeCSVTable(f, sm, t)
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// WriteCSVDir writes the pages, links and assets of sm as the CSV files
+// pages.csv, links.csv and assets.csv within dir, which is created if it
+// does not exist.
+func WriteCSVDir(dir string, sm *mapper.SiteMap, opts *CSVOptions) error {
+	tables, err := csvTables(opts)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tables {
+		f, err := os.Create(filepath.Join(dir, t.name))
+		if err != nil {
+			return err
+		}
+
+		err = writeCSVTable(f, sm, t)
+		closeErr := f.Close()
+		if err != nil {
+			return err
+		} else if closeErr != nil {
+			return closeErr
+		}
+	}
+	return nil
+}
+
+// csvTables returns the tables to export with the columns selected by opts.
+func csvTables(opts *CSVOptions) ([]*csvTable, error) {
+	if opts == nil {
+		opts = &CSVOptions{}
+	}
+
+	tables := []*csvTable{
+		{name: "pages.csv", columns: opts.PageColumns, write: writePages},
+		{name: "links.csv", columns: opts.LinkColumns, write: writeLinks},
+		{name: "assets.csv", columns: opts.AssetColumns, write: writeAssets},
+	}
+	for i, all := range [][]string{PageColumns, LinkColumns, AssetColumns} {
+		t := tables[i]
+		if t.columns == nil {
+			t.columns = all
+			continue
+		}
+
+		for _, c := range t.columns {
+			if !contains(all, c) {
+				table := strings.TrimSuffix(t.name, "s.csv")
+				return nil, fmt.Errorf("unknown %s column %q, must be one of %s", table, c, strings.Join(all, ", "))
+			}
+		}
+	}
+	return tables, nil
+}
+
+// writeCSVTable writes a table as RFC 4180 CSV, with a header row naming
+// its columns.
+func writeCSVTable(w io.Writer, sm *mapper.SiteMap, t *csvTable) error {
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = true
+
+	err := cw.Write(t.columns)
+	if err != nil {
+		return err
+	}
+	err = t.write(cw, sm, t.columns)
+	if err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func writePages(cw *csv.Writer, sm *mapper.SiteMap, columns []string) error {
+	for _, pm := range sm.PageMaps {
+		record := make([]string, 0, len(columns))
+		for _, c := range columns {
+			record = append(record, pageValue(pm, c))
+		}
+
+		err := cw.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func pageValue(pm *mapper.PageMap, column string) string {
+	switch column {
+	case "url":
+		return pm.URL.String()
+	case "status":
+		return strconv.Itoa(pm.StatusCode)
+	case "depth":
+		return strconv.Itoa(pm.Depth)
+	case "title":
+		if pm.Metadata != nil {
+			return escapeFormula(pm.Metadata.Title)
+		}
+	case "content_type":
+		return pm.ContentType
+	case "size":
+		return strconv.FormatInt(pm.Size, 10)
+	case "latency_ms":
+		return strconv.FormatInt(int64(pm.Latency/time.Millisecond), 10)
+	}
+	return ""
+}
+
+// writeLinks writes a row for each link of each page. The status of a link
+// is that of the page it links to, if that page was crawled.
+func writeLinks(cw *csv.Writer, sm *mapper.SiteMap, columns []string) error {
+	statuses := make(map[string]int, len(sm.PageMaps))
+	for _, pm := range sm.PageMaps {
+		statuses[pm.URL.String()] = pm.StatusCode
+	}
+
+	for _, pm := range sm.PageMaps {
+		for _, link := range pm.Links {
+			record := make([]string, 0, len(columns))
+			for _, c := range columns {
+				record = append(record, linkValue(pm, link, statuses, c))
+			}
+
+			err := cw.Write(record)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func linkValue(pm *mapper.PageMap, link *url.URL, statuses map[string]int, column string) string {
+	switch column {
+	case "source":
+		return pm.URL.String()
+	case "target":
+		return link.String()
+	case "anchor_text":
+		return escapeFormula(pm.LinkText[link.String()])
+	case "type":
+		if isInternal(pm.URL, link) {
+			return "internal"
+		}
+		return "external"
+	case "status":
+		if status, ok := statuses[link.String()]; ok {
+			return strconv.Itoa(status)
+		}
+	}
+	return ""
+}
+
+func writeAssets(cw *csv.Writer, sm *mapper.SiteMap, columns []string) error {
+	for _, pm := range sm.PageMaps {
+		for _, asset := range pm.Assets {
+			record := make([]string, 0, len(columns))
+			for _, c := range columns {
+				record = append(record, assetValue(pm, asset, c))
+			}
+
+			err := cw.Write(record)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func assetValue(pm *mapper.PageMap, asset *url.URL, column string) string {
+	switch column {
+	case "source":
+		return pm.URL.String()
+	case "target":
+		return asset.String()
+	case "kind":
+		return pm.AssetKinds[asset.String()]
+	}
+	return ""
+}
+
+// escapeFormula prefixes text taken from crawled pages with a quote if it
+// would otherwise be run as a formula when opened in a spreadsheet.
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// isInternal reports whether target is on the same host as the page at
+// source.
+func isInternal(source, target *url.URL) bool {
+	return strings.EqualFold(source.Host, target.Host)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,172 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jordanpotter/sitemapper/internal/mapper"
+)
+
+func createTestSiteMap(t *testing.T) *mapper.SiteMap {
+	parse := func(str string) *url.URL {
+		u, err := url.Parse(str)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return u
+	}
+
+	return &mapper.SiteMap{PageMaps: []*mapper.PageMap{
+		{
+			URL:         parse("https://foo.com"),
+			StatusCode:  200,
+			Latency:     120 * time.Millisecond,
+			Links:       []*url.URL{parse("https://foo.com/about"), parse("https://bar.com")},
+			Assets:      []*url.URL{parse("https://foo.com/logo.png")},
+			Metadata:    &mapper.PageMetadata{Title: `Foo, "the" site`},
+			ContentType: "text/html; charset=utf-8",
+			Size:        1024,
+			LinkText:    map[string]string{"https://foo.com/about": "About us"},
+			AssetKinds:  map[string]string{"https://foo.com/logo.png": "image"},
+		},
+		{
+			URL:        parse("https://foo.com/about"),
+			StatusCode: 404,
+			Depth:      1,
+		},
+	}}
+}
+
+func TestWriteCSVZip(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteCSVZip(&buf, createTestSiteMap(t), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]string{
+		"pages.csv": "url,status,depth,title,content_type,size,latency_ms\r\n" +
+			"https://foo.com,200,0,\"Foo, \"\"the\"\" site\",text/html; charset=utf-8,1024,120\r\n" +
+			"https://foo.com/about,404,1,,,0,0\r\n",
+		"links.csv": "source,target,anchor_text,type,status\r\n" +
+			"https://foo.com,https://foo.com/about,About us,internal,404\r\n" +
+			"https://foo.com,https://bar.com,,external,\r\n",
+		"assets.csv": "source,target,kind\r\n" +
+			"https://foo.com,https://foo.com/logo.png,image\r\n",
+	}
+	if len(zr.File) != len(expected) {
+		t.Fatalf("Unexpected number of files %d", len(zr.File))
+	}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if string(b) != expected[f.Name] {
+			t.Errorf("Unexpected %s %q", f.Name, b)
+		}
+	}
+}
+
+func TestWriteCSVDirColumns(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "csv")
+	opts := &CSVOptions{
+		PageColumns: []string{"status", "url"},
+		LinkColumns: []string{"target"},
+	}
+	err := WriteCSVDir(dir, createTestSiteMap(t), opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]string{
+		"pages.csv":  "status,url\r\n200,https://foo.com\r\n404,https://foo.com/about\r\n",
+		"links.csv":  "target\r\nhttps://foo.com/about\r\nhttps://bar.com\r\n",
+		"assets.csv": "source,target,kind\r\nhttps://foo.com,https://foo.com/logo.png,image\r\n",
+	}
+	for name, content := range expected {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if string(b) != content {
+			t.Errorf("Unexpected %s %q", name, b)
+		}
+	}
+}
+
+func TestWriteCSVUnknownColumn(t *testing.T) {
+	opts := &CSVOptions{LinkColumns: []string{"source", "anchor"}}
+	if opts.Validate() == nil {
+		t.Errorf("Expected validation error for unknown column")
+	}
+
+	err := WriteCSVZip(ioutil.Discard, createTestSiteMap(t), opts)
+	if err == nil {
+		t.Fatalf("Expected error for unknown column")
+	}
+}
+
+func TestWriteCSVEscapesFormulas(t *testing.T) {
+	sm := createTestSiteMap(t)
+	sm.PageMaps[0].Metadata.Title = `=HYPERLINK("https://evil.com","Click")`
+	sm.PageMaps[0].LinkText["https://foo.com/about"] = "@SUM(A1:A2)"
+
+	dir := filepath.Join(t.TempDir(), "csv")
+	opts := &CSVOptions{PageColumns: []string{"title"}, LinkColumns: []string{"anchor_text"}}
+	err := WriteCSVDir(dir, sm, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]string{
+		"pages.csv": "title\r\n\"'=HYPERLINK(\"\"https://evil.com\"\",\"\"Click\"\")\"\r\n\r\n",
+		"links.csv": "anchor_text\r\n'@SUM(A1:A2)\r\n\r\n",
+	}
+	for name, content := range expected {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if string(b) != content {
+			t.Errorf("Unexpected %s %q", name, b)
+		}
+	}
+}
+
+func TestEscapeFormula(t *testing.T) {
+	testCases := []struct {
+		s        string
+		expected string
+	}{
+		{"", ""},
+		{"About us", "About us"},
+		{"=1+1", "'=1+1"},
+		{"+1", "'+1"},
+		{"-1", "'-1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"a=b", "a=b"},
+	}
+
+	for _, tc := range testCases {
+		if escaped := escapeFormula(tc.s); escaped != tc.expected {
+			t.Errorf("Expected %q to be escaped as %q, got %q", tc.s, tc.expected, escaped)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jordanpotter/sitemapper/internal/mapper"
+)
+
+// dotShapes are the shapes of each type of node.
+var dotShapes = map[string]string{
+	nodePage:     "box",
+	nodeExternal: "ellipse",
+	nodeAsset:    "note",
+}
+
+// WriteDOT writes the link graph of sm as a Graphviz DOT digraph. Nodes are
+// identified by their url and have type attributes, along with status and
+// depth for crawled pages, and edges have kind attributes and are labelled
+// with their anchor text. Assets are drawn with dashed edges.
+func WriteDOT(w io.Writer, sm *mapper.SiteMap, opts *GraphOptions) error {
+	g := createGraph(sm, opts)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph sitemap {")
+	for _, n := range g.nodes {
+		attrs := []string{
+			dotAttr("type", n.typ),
+			dotAttr("shape", dotShapes[n.typ]),
+		}
+		if n.crawled {
+			attrs = append(attrs, fmt.Sprintf("status=%d", n.status), fmt.Sprintf("depth=%d", n.depth))
+		}
+		fmt.Fprintf(bw, "\t%s [%s];\n", dotQuote(n.url), strings.Join(attrs, ", "))
+	}
+
+	for _, e := range g.edges {
+		attrs := []string{dotAttr("kind", e.kind)}
+		if e.anchorText != "" {
+			attrs = append(attrs, dotAttr("label", e.anchorText))
+		}
+		if e.kind == edgeAsset {
+			attrs = append(attrs, "style=dashed")
+		}
+		fmt.Fprintf(bw, "\t%s -> %s [%s];\n", dotQuote(e.source.url), dotQuote(e.target.url), strings.Join(attrs, ", "))
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+func dotAttr(name, value string) string {
+	return name + "=" + dotQuote(value)
+}
+
+// dotQuote returns s as a quoted DOT identifier. Newlines are escaped, as
+// the anchor text of a link may span lines.
+func dotQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r", "", "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,47 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteDOT(t *testing.T) {
+	sm := createTestSiteMap(t)
+	sm.PageMaps[0].LinkText["https://foo.com/about"] = `About "us"`
+
+	var buf bytes.Buffer
+	err := WriteDOT(&buf, sm, &GraphOptions{DropAssets: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := `digraph sitemap {
+	"https://foo.com" [type="page", shape="box", status=200, depth=0];
+	"https://foo.com/about" [type="page", shape="box", status=404, depth=1];
+	"https://bar.com" [type="external", shape="ellipse"];
+	"https://foo.com" -> "https://foo.com/about" [kind="link", label="About \"us\""];
+	"https://foo.com" -> "https://bar.com" [kind="link"];
+}
+`
+	if buf.String() != expected {
+		t.Errorf("Unexpected DOT:\n%s", buf.String())
+	}
+}
+
+func TestDOTQuote(t *testing.T) {
+	testCases := []struct {
+		s        string
+		expected string
+	}{
+		{"https://foo.com", `"https://foo.com"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`back\slash`, `"back\\slash"`},
+		{"two\r\nlines", `"two\nlines"`},
+	}
+
+	for _, tc := range testCases {
+		if quoted := dotQuote(tc.s); quoted != tc.expected {
+			t.Errorf("Unexpected quoting of %q: %s", tc.s, quoted)
+		}
+	}
+}
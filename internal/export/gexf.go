@@ -0,0 +1,104 @@
+package export
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+
+	"github.com/jordanpotter/sitemapper/internal/mapper"
+)
+
+const gexfNamespace = "http://gexf.net/1.3"
+
+type gexfDocument struct {
+	XMLName xml.Name  `xml:"gexf"`
+	XMLNS   string    `xml:"xmlns,attr"`
+	Version string    `xml:"version,attr"`
+	Graph   gexfGraph `xml:"graph"`
+}
+
+type gexfGraph struct {
+	DefaultEdgeType string           `xml:"defaultedgetype,attr"`
+	Attributes      []gexfAttributes `xml:"attributes"`
+	Nodes           []gexfNode       `xml:"nodes>node"`
+	Edges           []gexfEdge       `xml:"edges>edge"`
+}
+
+type gexfAttributes struct {
+	Class      string          `xml:"class,attr"`
+	Attributes []gexfAttribute `xml:"attribute"`
+}
+
+type gexfAttribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type gexfNode struct {
+	ID        string         `xml:"id,attr"`
+	Label     string         `xml:"label,attr"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfEdge struct {
+	ID        string         `xml:"id,attr"`
+	Source    string         `xml:"source,attr"`
+	Target    string         `xml:"target,attr"`
+	Label     string         `xml:"label,attr,omitempty"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfAttValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// WriteGEXF writes the link graph of sm as GEXF. Nodes are labelled with
+// their url and have type attributes, along with status and depth for
+// crawled pages, and edges are labelled with their anchor text and have kind
+// attributes.
+func WriteGEXF(w io.Writer, sm *mapper.SiteMap, opts *GraphOptions) error {
+	g := createGraph(sm, opts)
+
+	doc := &gexfDocument{
+		XMLNS:   gexfNamespace,
+		Version: "1.3",
+		Graph: gexfGraph{
+			DefaultEdgeType: "directed",
+			Attributes: []gexfAttributes{
+				{Class: "node", Attributes: []gexfAttribute{
+					{ID: "type", Title: "type", Type: "string"},
+					{ID: "status", Title: "status", Type: "integer"},
+					{ID: "depth", Title: "depth", Type: "integer"},
+				}},
+				{Class: "edge", Attributes: []gexfAttribute{
+					{ID: "kind", Title: "kind", Type: "string"},
+				}},
+			},
+		},
+	}
+
+	for _, n := range g.nodes {
+		values := []gexfAttValue{{For: "type", Value: n.typ}}
+		if n.crawled {
+			values = append(values,
+				gexfAttValue{For: "status", Value: strconv.Itoa(n.status)},
+				gexfAttValue{For: "depth", Value: strconv.Itoa(n.depth)},
+			)
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, gexfNode{ID: n.id, Label: n.url, AttValues: values})
+	}
+
+	for _, e := range g.edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, gexfEdge{
+			ID:        e.id,
+			Source:    e.source.id,
+			Target:    e.target.id,
+			Label:     e.anchorText,
+			AttValues: []gexfAttValue{{For: "kind", Value: e.kind}},
+		})
+	}
+
+	return writeXML(w, doc)
+}
@@ -0,0 +1,51 @@
+package export
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+)
+
+func TestWriteGEXF(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteGEXF(&buf, createTestSiteMap(t), &GraphOptions{DropExternal: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var doc gexfDocument
+	err = xml.Unmarshal(buf.Bytes(), &doc)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if doc.XMLName.Space != gexfNamespace || doc.Version != "1.3" {
+		t.Errorf("Unexpected namespace %q and version %q", doc.XMLName.Space, doc.Version)
+	}
+	if len(doc.Graph.Nodes) != 3 || len(doc.Graph.Edges) != 2 {
+		t.Fatalf("Unexpected %d nodes and %d edges", len(doc.Graph.Nodes), len(doc.Graph.Edges))
+	}
+
+	n := doc.Graph.Nodes[0]
+	if n.Label != "https://foo.com" {
+		t.Errorf("Unexpected node label %q", n.Label)
+	}
+	expected := []gexfAttValue{{For: "type", Value: "page"}, {For: "status", Value: "200"}, {For: "depth", Value: "0"}}
+	if len(n.AttValues) != len(expected) {
+		t.Fatalf("Unexpected node attributes %v", n.AttValues)
+	}
+	for i := range expected {
+		if n.AttValues[i] != expected[i] {
+			t.Errorf("Unexpected node attribute %v", n.AttValues[i])
+		}
+	}
+
+	if n := doc.Graph.Nodes[2]; len(n.AttValues) != 1 || n.AttValues[0].Value != "asset" {
+		t.Errorf("Unexpected asset node attributes %v", n.AttValues)
+	}
+
+	e := doc.Graph.Edges[0]
+	if e.Label != "About us" || len(e.AttValues) != 1 || e.AttValues[0].Value != "link" {
+		t.Errorf("Unexpected edge %+v", e)
+	}
+}
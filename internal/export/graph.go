@@ -0,0 +1,129 @@
+package export
+
+import (
+	"strconv"
+
+	"github.com/jordanpotter/sitemapper/internal/mapper"
+)
+
+// GraphOptions control which nodes of a site map are exported as a graph.
+type GraphOptions struct {
+	// DropAssets excludes assets, along with the edges to them.
+	DropAssets bool
+
+	// DropExternal excludes pages on other hosts, along with the links to
+	// them.
+	DropExternal bool
+}
+
+// The types of graph nodes.
+const (
+	nodePage     = "page"
+	nodeExternal = "external"
+	nodeAsset    = "asset"
+)
+
+// The kinds of graph edges.
+const (
+	edgeLink  = "link"
+	edgeAsset = "asset"
+)
+
+// A graph is the link graph of a site map. Pages that were crawled have a
+// status and depth, while pages that were not crawled, external pages and
+// assets only have a url.
+type graph struct {
+	nodes []*graphNode
+	edges []*graphEdge
+	ids   map[string]*graphNode
+}
+
+type graphNode struct {
+	id      string
+	url     string
+	typ     string
+	crawled bool
+	status  int
+	depth   int
+}
+
+type graphEdge struct {
+	id         string
+	source     *graphNode
+	target     *graphNode
+	kind       string
+	anchorText string
+}
+
+// createGraph returns the graph of the pages, links and assets of sm. Links
+// to pages on the same host as the page linking to them are page nodes, even
+// if they were not crawled, while those to other hosts are external nodes.
+func createGraph(sm *mapper.SiteMap, opts *GraphOptions) *graph {
+	if opts == nil {
+		opts = &GraphOptions{}
+	}
+
+	g := &graph{ids: make(map[string]*graphNode)}
+	for _, pm := range sm.PageMaps {
+		n := g.node(pm.URL.String(), nodePage)
+		n.crawled = true
+		n.status = pm.StatusCode
+		n.depth = pm.Depth
+	}
+
+	for _, pm := range sm.PageMaps {
+		source := g.ids[pm.URL.String()]
+		for _, link := range pm.Links {
+			typ := nodePage
+			if !isInternal(pm.URL, link) {
+				typ = nodeExternal
+			}
+			if _, ok := g.ids[link.String()]; !ok && typ == nodeExternal && opts.DropExternal {
+				continue
+			}
+
+			target := g.node(link.String(), typ)
+			g.edge(source, target, edgeLink, pm.LinkText[link.String()])
+		}
+
+		if opts.DropAssets {
+			continue
+		}
+		for _, asset := range pm.Assets {
+			target := g.node(asset.String(), nodeAsset)
+			g.edge(source, target, edgeAsset, "")
+		}
+	}
+	return g
+}
+
+// node returns the node of the url str, adding it with typ if the graph does
+// not have it yet.
+func (g *graph) node(str, typ string) *graphNode {
+	if n, ok := g.ids[str]; ok {
+		return n
+	}
+
+	n := &graphNode{id: nodeID(len(g.nodes)), url: str, typ: typ}
+	g.nodes = append(g.nodes, n)
+	g.ids[str] = n
+	return n
+}
+
+func (g *graph) edge(source, target *graphNode, kind, anchorText string) {
+	g.edges = append(g.edges, &graphEdge{
+		id:         edgeID(len(g.edges)),
+		source:     source,
+		target:     target,
+		kind:       kind,
+		anchorText: anchorText,
+	})
+}
+
+func nodeID(i int) string {
+	return "n" + strconv.Itoa(i)
+}
+
+func edgeID(i int) string {
+	return "e" + strconv.Itoa(i)
+}
@@ -0,0 +1,60 @@
+package export
+
+import (
+	"testing"
+)
+
+func TestCreateGraph(t *testing.T) {
+	g := createGraph(createTestSiteMap(t), nil)
+
+	expectedNodes := []graphNode{
+		{id: "n0", url: "https://foo.com", typ: nodePage, crawled: true, status: 200},
+		{id: "n1", url: "https://foo.com/about", typ: nodePage, crawled: true, status: 404, depth: 1},
+		{id: "n2", url: "https://bar.com", typ: nodeExternal},
+		{id: "n3", url: "https://foo.com/logo.png", typ: nodeAsset},
+	}
+	if len(g.nodes) != len(expectedNodes) {
+		t.Fatalf("Unexpected number of nodes %d", len(g.nodes))
+	}
+	for i, n := range g.nodes {
+		if *n != expectedNodes[i] {
+			t.Errorf("Unexpected node %+v", *n)
+		}
+	}
+
+	expectedEdges := []struct {
+		source, target, kind, anchorText string
+	}{
+		{"n0", "n1", edgeLink, "About us"},
+		{"n0", "n2", edgeLink, ""},
+		{"n0", "n3", edgeAsset, ""},
+	}
+	if len(g.edges) != len(expectedEdges) {
+		t.Fatalf("Unexpected number of edges %d", len(g.edges))
+	}
+	for i, e := range g.edges {
+		expected := expectedEdges[i]
+		if e.source.id != expected.source || e.target.id != expected.target || e.kind != expected.kind || e.anchorText != expected.anchorText {
+			t.Errorf("Unexpected edge %s -> %s (%s, %q)", e.source.id, e.target.id, e.kind, e.anchorText)
+		}
+	}
+}
+
+func TestCreateGraphDrop(t *testing.T) {
+	g := createGraph(createTestSiteMap(t), &GraphOptions{DropAssets: true, DropExternal: true})
+
+	if len(g.nodes) != 2 {
+		t.Fatalf("Unexpected number of nodes %d", len(g.nodes))
+	}
+	for _, n := range g.nodes {
+		if n.typ != nodePage {
+			t.Errorf("Unexpected %s node %s", n.typ, n.url)
+		}
+	}
+	if len(g.edges) != 1 {
+		t.Fatalf("Unexpected number of edges %d", len(g.edges))
+	}
+	if g.edges[0].target.url != "https://foo.com/about" {
+		t.Errorf("Unexpected edge to %s", g.edges[0].target.url)
+	}
+}
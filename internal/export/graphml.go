@@ -0,0 +1,112 @@
+package export
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+
+	"github.com/jordanpotter/sitemapper/internal/mapper"
+)
+
+const graphMLNamespace = "http://graphml.graphdrawing.org/xmlns"
+
+type graphMLDocument struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// WriteGraphML writes the link graph of sm as GraphML. Nodes have url and
+// type attributes, along with status and depth for crawled pages, and edges
+// have kind and anchor text attributes.
+func WriteGraphML(w io.Writer, sm *mapper.SiteMap, opts *GraphOptions) error {
+	g := createGraph(sm, opts)
+
+	doc := &graphMLDocument{
+		XMLNS: graphMLNamespace,
+		Keys: []graphMLKey{
+			{ID: "url", For: "node", AttrName: "url", AttrType: "string"},
+			{ID: "type", For: "node", AttrName: "type", AttrType: "string"},
+			{ID: "status", For: "node", AttrName: "status", AttrType: "int"},
+			{ID: "depth", For: "node", AttrName: "depth", AttrType: "int"},
+			{ID: "kind", For: "edge", AttrName: "kind", AttrType: "string"},
+			{ID: "anchor_text", For: "edge", AttrName: "anchor_text", AttrType: "string"},
+		},
+		Graph: graphMLGraph{ID: "sitemap", EdgeDefault: "directed"},
+	}
+
+	for _, n := range g.nodes {
+		data := []graphMLData{{Key: "url", Value: n.url}, {Key: "type", Value: n.typ}}
+		if n.crawled {
+			data = append(data,
+				graphMLData{Key: "status", Value: strconv.Itoa(n.status)},
+				graphMLData{Key: "depth", Value: strconv.Itoa(n.depth)},
+			)
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{ID: n.id, Data: data})
+	}
+
+	for _, e := range g.edges {
+		data := []graphMLData{{Key: "kind", Value: e.kind}}
+		if e.anchorText != "" {
+			data = append(data, graphMLData{Key: "anchor_text", Value: e.anchorText})
+		}
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			ID:     e.id,
+			Source: e.source.id,
+			Target: e.target.id,
+			Data:   data,
+		})
+	}
+
+	return writeXML(w, doc)
+}
+
+// writeXML writes v as an indented XML document.
+func writeXML(w io.Writer, v interface{}) error {
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(v)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,54 @@
+package export
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+)
+
+func TestWriteGraphML(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteGraphML(&buf, createTestSiteMap(t), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var doc graphMLDocument
+	err = xml.Unmarshal(buf.Bytes(), &doc)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if doc.XMLName.Space != graphMLNamespace {
+		t.Errorf("Unexpected namespace %q", doc.XMLName.Space)
+	}
+	if doc.Graph.EdgeDefault != "directed" {
+		t.Errorf("Unexpected edge default %q", doc.Graph.EdgeDefault)
+	}
+	if len(doc.Graph.Nodes) != 4 || len(doc.Graph.Edges) != 3 {
+		t.Fatalf("Unexpected %d nodes and %d edges", len(doc.Graph.Nodes), len(doc.Graph.Edges))
+	}
+
+	expected := []graphMLData{{Key: "url", Value: "https://foo.com/about"}, {Key: "type", Value: "page"}, {Key: "status", Value: "404"}, {Key: "depth", Value: "1"}}
+	if data := doc.Graph.Nodes[1].Data; len(data) != len(expected) {
+		t.Errorf("Unexpected node data %v", data)
+	} else {
+		for i := range data {
+			if data[i] != expected[i] {
+				t.Errorf("Unexpected node data %v", data[i])
+			}
+		}
+	}
+	if data := doc.Graph.Nodes[2].Data; len(data) != 2 {
+		t.Errorf("Unexpected external node data %v", data)
+	}
+
+	e := doc.Graph.Edges[0]
+	if e.Source != "n0" || e.Target != "n1" {
+		t.Errorf("Unexpected edge from %s to %s", e.Source, e.Target)
+	}
+	expected = []graphMLData{{Key: "kind", Value: "link"}, {Key: "anchor_text", Value: "About us"}}
+	if len(e.Data) != len(expected) || e.Data[0] != expected[0] || e.Data[1] != expected[1] {
+		t.Errorf("Unexpected edge data %v", e.Data)
+	}
+}
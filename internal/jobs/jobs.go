@@ -0,0 +1,784 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jordanpotter/sitemapper/internal/mapper"
+)
+
+// A Status is the state of a job in its lifecycle.
+type Status string
+
+const (
+	Queued    Status = "queued"
+	Running   Status = "running"
+	Done      Status = "done"
+	Failed    Status = "failed"
+	Cancelled Status = "cancelled"
+)
+
+// IsFinished reports whether a job with status s has stopped running.
+func (s Status) IsFinished() bool {
+	return s == Done || s == Failed || s == Cancelled
+}
+
+var (
+	// ErrJobNotFound is returned when no job exists with the requested id.
+	ErrJobNotFound = errors.New("job not found")
+
+	// ErrJobFinished is returned when cancelling a job that has already
+	// finished.
+	ErrJobFinished = errors.New("job already finished")
+
+	// ErrJobNotFinished is returned when deleting a job that is still queued
+	// or running.
+	ErrJobNotFinished = errors.New("job not finished")
+
+	// ErrResultNotReady is returned when requesting the result of a job
+	// that has not completed successfully.
+	ErrResultNotReady = errors.New("job result not ready")
+
+	// ErrAtCapacity is returned when starting a job while the maximum number
+	// of jobs are already running and queued.
+	ErrAtCapacity = errors.New("too many jobs running and queued")
+
+	// ErrShuttingDown is returned when starting a job after the manager has
+	// been closed.
+	ErrShuttingDown = errors.New("job manager is shutting down")
+
+	// ErrInvalidCursor is returned when listing jobs after a job that does
+	// not exist.
+	ErrInvalidCursor = errors.New("invalid job list cursor")
+
+	errInterrupted = errors.New("job was interrupted by a server shutdown")
+
+	errMaxRunningTooLow = errors.New("max running jobs must be greater than 0")
+	errMaxQueuedTooLow  = errors.New("max queued jobs must not be negative")
+)
+
+type crawlFunc func(ctx context.Context, u *url.URL, opts *mapper.Options) (*mapper.SiteMap, error)
+
+// A Job is a site map crawl managed by a Manager. Owner names the client
+// that started the job, if any.
+type Job struct {
+	ID    string
+	Site  *url.URL
+	Owner string
+
+	opts   *mapper.Options
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	m           sync.Mutex
+	status      Status
+	err         error
+	pages       int
+	links       int
+	assets      int
+	created     time.Time
+	started     time.Time
+	finished    time.Time
+	resultBytes int64
+	interrupted bool
+	stopErr     error
+	webhook     *WebhookStatus
+
+	subscribers map[chan *mapper.Event]bool
+	done        chan struct{}
+}
+
+// subscriberBuffer is the number of events buffered for each subscriber
+// before further events are dropped.
+const subscriberBuffer = 256
+
+// A JobStatus is a snapshot of the state and counters of a job.
+type JobStatus struct {
+	ID          string         `json:"id"`
+	Site        string         `json:"site"`
+	Owner       string         `json:"owner,omitempty"`
+	Status      Status         `json:"status"`
+	Error       string         `json:"error,omitempty"`
+	Pages       int            `json:"pages"`
+	Links       int            `json:"links"`
+	Assets      int            `json:"assets"`
+	Created     time.Time      `json:"created"`
+	Started     *time.Time     `json:"started,omitempty"`
+	Finished    *time.Time     `json:"finished,omitempty"`
+	ResultBytes int64          `json:"resultBytes,omitempty"`
+	Webhook     *WebhookStatus `json:"webhook,omitempty"`
+}
+
+// A WebhookState is the progress of delivering a job's webhook.
+type WebhookState string
+
+const (
+	WebhookPending   WebhookState = "pending"
+	WebhookDelivered WebhookState = "delivered"
+	WebhookFailed    WebhookState = "failed"
+)
+
+// A WebhookStatus records the delivery of the webhook sent once a job has
+// finished.
+type WebhookStatus struct {
+	URL       string       `json:"url"`
+	State     WebhookState `json:"state"`
+	Attempts  int          `json:"attempts"`
+	LastError string       `json:"lastError,omitempty"`
+	Delivered *time.Time   `json:"delivered,omitempty"`
+}
+
+// Status returns a snapshot of the current state of the job.
+func (j *Job) Status() *JobStatus {
+	j.m.Lock()
+	defer j.m.Unlock()
+
+	js := &JobStatus{
+		ID:          j.ID,
+		Site:        j.Site.String(),
+		Owner:       j.Owner,
+		Status:      j.status,
+		Pages:       j.pages,
+		Links:       j.links,
+		Assets:      j.assets,
+		Created:     j.created,
+		ResultBytes: j.resultBytes,
+	}
+	if j.err != nil {
+		js.Error = j.err.Error()
+	}
+	if !j.started.IsZero() {
+		started := j.started
+		js.Started = &started
+	}
+	if !j.finished.IsZero() {
+		finished := j.finished
+		js.Finished = &finished
+	}
+	if j.webhook != nil {
+		webhook := *j.webhook
+		js.Webhook = &webhook
+	}
+	return js
+}
+
+// Done returns a channel that is closed once the job finishes.
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Subscribe returns a channel receiving the crawl events of the job, along
+// with a function to stop receiving them. The channel is closed once the job
+// finishes. A subscriber that falls behind misses events rather than slowing
+// down the crawl.
+func (j *Job) Subscribe() (<-chan *mapper.Event, func()) {
+	j.m.Lock()
+	defer j.m.Unlock()
+
+	events := make(chan *mapper.Event, subscriberBuffer)
+	if j.isFinished() {
+		close(events)
+		return events, func() {}
+	}
+
+	if j.subscribers == nil {
+		j.subscribers = make(map[chan *mapper.Event]bool)
+	}
+	j.subscribers[events] = true
+
+	unsubscribe := func() {
+		j.m.Lock()
+		defer j.m.Unlock()
+
+		if j.subscribers[events] {
+			delete(j.subscribers, events)
+			close(events)
+		}
+	}
+	return events, unsubscribe
+}
+
+func (j *Job) publish(e *mapper.Event) {
+	j.m.Lock()
+	defer j.m.Unlock()
+
+	for events := range j.subscribers {
+		select {
+		case events <- e:
+		default:
+		}
+	}
+}
+
+// Stop cancels the crawl of the job, which then fails with err. It has no
+// effect once the job has finished.
+func (j *Job) Stop(err error) {
+	j.m.Lock()
+	defer j.m.Unlock()
+
+	if j.isFinished() {
+		return
+	}
+	j.stopErr = err
+	j.cancel()
+}
+
+// finish closes the subscribers of a job that has just finished. It must be
+// called with j.m held.
+func (j *Job) finish() {
+	for events := range j.subscribers {
+		close(events)
+	}
+	j.subscribers = nil
+	close(j.done)
+}
+
+func (j *Job) isFinished() bool {
+	return j.status.IsFinished()
+}
+
+func (j *Job) addPageMap(pm *mapper.PageMap) {
+	j.m.Lock()
+	defer j.m.Unlock()
+
+	j.pages++
+	j.links += len(pm.Links)
+	j.assets += len(pm.Assets)
+}
+
+// A Manager runs crawl jobs, limiting how many run at once. Jobs started
+// while the limit is reached are queued and run in the order they were
+// started. The status and result of every job is saved to a store.
+type Manager struct {
+	maxRunning int
+	maxQueued  int
+	crawl      crawlFunc
+	store      Store
+
+	m       sync.Mutex
+	jobs    map[string]*Job
+	queue   []*Job
+	running int
+	closed  bool
+}
+
+// NewManager returns a manager that runs at most maxRunning jobs at once,
+// with at most maxQueued further jobs waiting to run. Jobs are saved to
+// store, or kept in memory if store is nil. Jobs in the store that had not
+// finished, because the process stopped, are marked as failed, as are
+// webhooks that had not been delivered.
+func NewManager(maxRunning, maxQueued int, store Store) (*Manager, error) {
+	if maxRunning < 1 {
+		return nil, errMaxRunningTooLow
+	} else if maxQueued < 0 {
+		return nil, errMaxQueuedTooLow
+	}
+
+	if store == nil {
+		store = newMemoryStore()
+	}
+
+	statuses, err := store.Statuses()
+	if err != nil {
+		return nil, err
+	}
+	for _, js := range statuses {
+		isInterrupted := !js.Status.IsFinished()
+		isUndelivered := js.Webhook != nil && js.Webhook.State == WebhookPending
+		if !isInterrupted && !isUndelivered {
+			continue
+		}
+
+		if isInterrupted {
+			now := time.Now()
+			js.Status = Failed
+			js.Error = errInterrupted.Error()
+			js.Finished = &now
+		}
+		if isUndelivered {
+			js.Webhook.State = WebhookFailed
+			js.Webhook.LastError = errInterrupted.Error()
+		}
+		err = store.SaveStatus(js)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Manager{
+		maxRunning: maxRunning,
+		maxQueued:  maxQueued,
+		crawl:      mapper.CreateSiteMapWithOptions,
+		store:      store,
+		jobs:       make(map[string]*Job),
+	}, nil
+}
+
+// Shutdown stops the manager from accepting new jobs and interrupts queued
+// jobs, then waits for running jobs to finish. If ctx is done first, the
+// running jobs are interrupted too and the context's error is returned.
+// Interrupted jobs are marked as failed.
+func (mgr *Manager) Shutdown(ctx context.Context) error {
+	mgr.m.Lock()
+	mgr.closed = true
+	queued := mgr.queue
+	mgr.queue = nil
+	started := make([]*Job, 0, len(mgr.jobs))
+	for _, j := range mgr.jobs {
+		started = append(started, j)
+	}
+	mgr.m.Unlock()
+
+	for _, j := range queued {
+		mgr.interrupt(j)
+	}
+
+	for _, j := range started {
+		select {
+		case <-j.Done():
+		case <-ctx.Done():
+			for _, j := range started {
+				mgr.interrupt(j)
+			}
+			for _, j := range started {
+				<-j.Done()
+			}
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// interrupt stops a job because the manager is shutting down. A queued job
+// fails immediately, while a running job fails once its crawl has stopped.
+func (mgr *Manager) interrupt(j *Job) {
+	j.m.Lock()
+	if j.isFinished() {
+		j.m.Unlock()
+		return
+	}
+
+	j.interrupted = true
+	wasQueued := j.status == Queued
+	if wasQueued {
+		j.status = Failed
+		j.err = errInterrupted
+		j.finished = time.Now()
+	}
+	j.cancel()
+	j.m.Unlock()
+
+	if wasQueued {
+		mgr.complete(j)
+	}
+}
+
+// Start queues a job to crawl the site at u with the specified options, on
+// behalf of owner.
+func (mgr *Manager) Start(u *url.URL, opts *mapper.Options, owner string) (*Job, error) {
+	id, err := createID()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &Job{
+		ID:      id,
+		Site:    u,
+		Owner:   owner,
+		ctx:     ctx,
+		cancel:  cancel,
+		status:  Queued,
+		created: time.Now(),
+		done:    make(chan struct{}),
+	}
+
+	jobOpts := *opts
+	jobOpts.OnPageMap = func(pm *mapper.PageMap) {
+		j.addPageMap(pm)
+		if opts.OnPageMap != nil {
+			opts.OnPageMap(pm)
+		}
+	}
+	jobOpts.OnEvent = func(e *mapper.Event) {
+		j.publish(e)
+		if opts.OnEvent != nil {
+			opts.OnEvent(e)
+		}
+	}
+	j.opts = &jobOpts
+
+	mgr.m.Lock()
+	if mgr.closed {
+		mgr.m.Unlock()
+		return nil, ErrShuttingDown
+	} else if mgr.running >= mgr.maxRunning && len(mgr.queue) >= mgr.maxQueued {
+		mgr.m.Unlock()
+		return nil, ErrAtCapacity
+	} else if err = mgr.store.SaveStatus(j.Status()); err != nil {
+		mgr.m.Unlock()
+		return nil, err
+	}
+	mgr.jobs[id] = j
+	mgr.queue = append(mgr.queue, j)
+	mgr.m.Unlock()
+
+	mgr.schedule()
+	return j, nil
+}
+
+// Get returns the job with the specified id, if it was started since the
+// manager was created and is still queued or running, or has finished but
+// could not be saved to the store.
+func (mgr *Manager) Get(id string) (*Job, error) {
+	mgr.m.Lock()
+	defer mgr.m.Unlock()
+
+	j, ok := mgr.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return j, nil
+}
+
+// Status returns the status of the job with the specified id, including
+// jobs that are only in the store.
+func (mgr *Manager) Status(id string) (*JobStatus, error) {
+	j, err := mgr.Get(id)
+	if err == nil {
+		return j.Status(), nil
+	}
+	return mgr.store.Status(id)
+}
+
+// SetWebhook records the delivery of the webhook of the job with the
+// specified id, saving it to the store.
+func (mgr *Manager) SetWebhook(id string, ws *WebhookStatus) error {
+	webhook := *ws
+	j, err := mgr.Get(id)
+	if err == ErrJobNotFound {
+		js, err := mgr.store.Status(id)
+		if err != nil {
+			return err
+		}
+		js.Webhook = &webhook
+		return mgr.store.SaveStatus(js)
+	} else if err != nil {
+		return err
+	}
+
+	j.m.Lock()
+	j.webhook = &webhook
+	j.m.Unlock()
+
+	return mgr.store.SaveStatus(j.Status())
+}
+
+// Running returns the number of jobs currently running.
+func (mgr *Manager) Running() int {
+	mgr.m.Lock()
+	defer mgr.m.Unlock()
+	return mgr.running
+}
+
+// Queued returns the number of jobs waiting to run.
+func (mgr *Manager) Queued() int {
+	mgr.m.Lock()
+	defer mgr.m.Unlock()
+	return len(mgr.queue)
+}
+
+// Result returns the JSON encoded site map of the job with the specified id,
+// once it has completed successfully.
+func (mgr *Manager) Result(id string) ([]byte, error) {
+	js, err := mgr.Status(id)
+	if err != nil {
+		return nil, err
+	} else if js.Status != Done {
+		return nil, ErrResultNotReady
+	}
+	return mgr.store.Result(id)
+}
+
+// List returns at most limit job statuses, newest first, starting after the
+// job with id cursor, or with the newest job if cursor is empty. Only jobs
+// for which match returns true are listed, or every job if match is nil. The
+// returned cursor continues the list, and is empty once there are no more
+// jobs.
+func (mgr *Manager) List(cursor string, limit int, match func(js *JobStatus) bool) ([]*JobStatus, string, error) {
+	stored, err := mgr.store.Statuses()
+	if err != nil {
+		return nil, "", err
+	}
+
+	statuses := stored[:0]
+	for _, js := range stored {
+		if match == nil || match(js) {
+			statuses = append(statuses, js)
+		}
+	}
+
+	mgr.m.Lock()
+	live := make(map[string]*Job, len(mgr.jobs))
+	for id, j := range mgr.jobs {
+		live[id] = j
+	}
+	mgr.m.Unlock()
+
+	for i, js := range statuses {
+		if j, ok := live[js.ID]; ok {
+			statuses[i] = j.Status()
+		}
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		if !statuses[i].Created.Equal(statuses[j].Created) {
+			return statuses[i].Created.After(statuses[j].Created)
+		}
+		return statuses[i].ID > statuses[j].ID
+	})
+
+	start := 0
+	if cursor != "" {
+		start = -1
+		for i, js := range statuses {
+			if js.ID == cursor {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			return nil, "", ErrInvalidCursor
+		}
+	}
+
+	end := start + limit
+	if end >= len(statuses) {
+		return statuses[start:], "", nil
+	}
+	return statuses[start:end], statuses[end-1].ID, nil
+}
+
+// Prune deletes finished jobs that finished more than maxAge ago, then the
+// oldest finished jobs until the results of all jobs total at most maxBytes.
+// Zero disables either limit. Jobs for which keep returns true are never
+// deleted, nor counted towards maxBytes. It returns the number of jobs
+// deleted.
+func (mgr *Manager) Prune(maxAge time.Duration, maxBytes int64, keep func(js *JobStatus) bool) (int, error) {
+	statuses, err := mgr.store.Statuses()
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	var finished []*JobStatus
+	for _, js := range statuses {
+		if keep != nil && keep(js) {
+			continue
+		}
+		total += js.ResultBytes
+		if js.Status.IsFinished() && js.Finished != nil {
+			finished = append(finished, js)
+		}
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].Finished.Before(*finished[j].Finished)
+	})
+
+	now := time.Now()
+	deleted := 0
+	for _, js := range finished {
+		isExpired := maxAge > 0 && now.Sub(*js.Finished) > maxAge
+		isOversize := maxBytes > 0 && total > maxBytes
+		if !isExpired && !isOversize {
+			break
+		}
+
+		err = mgr.store.Delete(js.ID)
+		if err != nil {
+			return deleted, err
+		}
+
+		mgr.m.Lock()
+		delete(mgr.jobs, js.ID)
+		mgr.m.Unlock()
+
+		total -= js.ResultBytes
+		deleted++
+	}
+	return deleted, nil
+}
+
+// Delete deletes the finished job with the specified id, along with its
+// result.
+func (mgr *Manager) Delete(id string) error {
+	js, err := mgr.Status(id)
+	if err != nil {
+		return err
+	} else if !js.Status.IsFinished() {
+		return ErrJobNotFinished
+	}
+
+	err = mgr.store.Delete(id)
+	if err != nil {
+		return err
+	}
+
+	mgr.m.Lock()
+	delete(mgr.jobs, id)
+	mgr.m.Unlock()
+	return nil
+}
+
+// Cancel stops the job with the specified id. A queued job is removed from
+// the queue, while a running job has its crawl cancelled.
+func (mgr *Manager) Cancel(id string) (*Job, error) {
+	j, err := mgr.Get(id)
+	if err == ErrJobNotFound {
+		_, err = mgr.store.Status(id)
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrJobFinished
+	} else if err != nil {
+		return nil, err
+	}
+
+	mgr.m.Lock()
+	for i, queued := range mgr.queue {
+		if queued == j {
+			mgr.queue = append(mgr.queue[:i], mgr.queue[i+1:]...)
+			break
+		}
+	}
+	mgr.m.Unlock()
+
+	j.m.Lock()
+	if j.isFinished() {
+		j.m.Unlock()
+		return j, ErrJobFinished
+	}
+
+	wasQueued := j.status == Queued
+	if wasQueued {
+		j.status = Cancelled
+		j.finished = time.Now()
+	}
+	j.cancel()
+	j.m.Unlock()
+
+	if wasQueued {
+		mgr.complete(j)
+	}
+	return j, nil
+}
+
+// schedule starts queued jobs until the running limit is reached.
+func (mgr *Manager) schedule() {
+	mgr.m.Lock()
+	defer mgr.m.Unlock()
+
+	for mgr.running < mgr.maxRunning && len(mgr.queue) > 0 {
+		j := mgr.queue[0]
+		mgr.queue = mgr.queue[1:]
+		mgr.running++
+		go mgr.run(j)
+	}
+}
+
+func (mgr *Manager) run(j *Job) {
+	defer func() {
+		mgr.m.Lock()
+		mgr.running--
+		mgr.m.Unlock()
+		mgr.schedule()
+	}()
+
+	j.m.Lock()
+	if j.isFinished() {
+		j.m.Unlock()
+		return
+	}
+	j.status = Running
+	j.started = time.Now()
+	j.m.Unlock()
+	mgr.saveStatus(j)
+
+	sm, err := mgr.crawl(j.ctx, j.Site, j.opts)
+
+	var result []byte
+	if err == nil && j.ctx.Err() == nil {
+		result, err = json.Marshal(sm)
+		if err == nil {
+			err = mgr.store.SaveResult(j.ID, result)
+		}
+	}
+
+	j.m.Lock()
+	j.finished = time.Now()
+	if j.interrupted {
+		j.status = Failed
+		j.err = errInterrupted
+	} else if j.stopErr != nil {
+		j.status = Failed
+		j.err = j.stopErr
+	} else if j.ctx.Err() != nil {
+		j.status = Cancelled
+	} else if err != nil {
+		j.status = Failed
+		j.err = err
+	} else {
+		j.status = Done
+		j.resultBytes = int64(len(result))
+	}
+	j.m.Unlock()
+
+	mgr.complete(j)
+}
+
+// complete saves the status of a job that has just finished, then closes its
+// subscribers and done channel, so that anyone waiting on the job sees its
+// final status in the store. Once saved, the job is only kept in the store,
+// along with its result.
+func (mgr *Manager) complete(j *Job) {
+	err := mgr.store.SaveStatus(j.Status())
+	if err != nil {
+		log.Printf("Failed to save status of job %s: %v", j.ID, err)
+	} else {
+		mgr.m.Lock()
+		delete(mgr.jobs, j.ID)
+		mgr.m.Unlock()
+	}
+
+	j.m.Lock()
+	defer j.m.Unlock()
+
+	j.finish()
+	j.cancel()
+}
+
+// saveStatus saves the current status of a job to the store. A failure is
+// logged rather than returned, as the job itself is unaffected.
+func (mgr *Manager) saveStatus(j *Job) {
+	err := mgr.store.SaveStatus(j.Status())
+	if err != nil {
+		log.Printf("Failed to save status of job %s: %v", j.ID, err)
+	}
+}
+
+func createID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
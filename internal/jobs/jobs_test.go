@@ -0,0 +1,675 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jordanpotter/sitemapper/internal/mapper"
+)
+
+func createTestManager(t *testing.T, maxRunning int, crawl crawlFunc) *Manager {
+	mgr, err := NewManager(maxRunning, 10, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mgr.crawl = crawl
+	return mgr
+}
+
+func waitForStatus(t *testing.T, j *Job, status Status) {
+	deadline := time.Now().Add(5 * time.Second)
+	for j.Status().Status != status {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected job status to be %q, got %q", status, j.Status().Status)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestNewManagerMaxRunning(t *testing.T) {
+	_, err := NewManager(0, 0, nil)
+	if err != errMaxRunningTooLow {
+		t.Errorf("Expected error %v, got %v", errMaxRunningTooLow, err)
+	}
+}
+
+func TestNewManagerMaxQueued(t *testing.T) {
+	_, err := NewManager(1, -1, nil)
+	if err != errMaxQueuedTooLow {
+		t.Errorf("Expected error %v, got %v", errMaxQueuedTooLow, err)
+	}
+}
+
+func TestManagerDone(t *testing.T) {
+	u, err := url.Parse("https://foo.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	sm := &mapper.SiteMap{PageMaps: []*mapper.PageMap{}}
+	mgr := createTestManager(t, 1, func(ctx context.Context, u *url.URL, opts *mapper.Options) (*mapper.SiteMap, error) {
+		opts.OnPageMap(&mapper.PageMap{URL: u, Links: []*url.URL{u}})
+		return sm, nil
+	})
+
+	j, err := mgr.Start(u, mapper.DefaultOptions(1), "alice")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitForStatus(t, j, Done)
+
+	select {
+	case <-j.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected done channel to be closed")
+	}
+
+	js := j.Status()
+	if js.Pages != 1 || js.Links != 1 || js.Assets != 0 {
+		t.Errorf("Unexpected counters %+v", js)
+	} else if js.Started == nil || js.Finished == nil {
+		t.Errorf("Expected started and finished times to be set")
+	}
+
+	result, err := mgr.Result(j.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if expected, _ := json.Marshal(sm); string(result) != string(expected) {
+		t.Errorf("Expected result to be the crawled site map, got %s", result)
+	}
+
+	// Once saved, the job is only kept in the store.
+	_, err = mgr.Get(j.ID)
+	if err != ErrJobNotFound {
+		t.Errorf("Expected error %v, got %v", ErrJobNotFound, err)
+	}
+	js, err = mgr.Status(j.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if js.Status != Done || js.Pages != 1 {
+		t.Errorf("Unexpected saved status %+v", js)
+	}
+
+	stored, err := mgr.store.Status(j.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if stored.Owner != "alice" {
+		t.Errorf("Expected owner to be saved, got %q", stored.Owner)
+	}
+}
+
+func TestManagerFailed(t *testing.T) {
+	u, err := url.Parse("https://foo.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	crawlErr := errors.New("crawl failed")
+	mgr := createTestManager(t, 1, func(ctx context.Context, u *url.URL, opts *mapper.Options) (*mapper.SiteMap, error) {
+		return nil, crawlErr
+	})
+
+	j, err := mgr.Start(u, mapper.DefaultOptions(1), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitForStatus(t, j, Failed)
+
+	if j.Status().Error != crawlErr.Error() {
+		t.Errorf("Expected error %q, got %q", crawlErr, j.Status().Error)
+	}
+
+	_, err = mgr.Result(j.ID)
+	if err != ErrResultNotReady {
+		t.Errorf("Expected error %v, got %v", ErrResultNotReady, err)
+	}
+}
+
+func TestManagerQueueAndCancel(t *testing.T) {
+	u, err := url.Parse("https://foo.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	mgr := createTestManager(t, 1, func(ctx context.Context, u *url.URL, opts *mapper.Options) (*mapper.SiteMap, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	first, err := mgr.Start(u, mapper.DefaultOptions(1), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	second, err := mgr.Start(u, mapper.DefaultOptions(1), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	third, err := mgr.Start(u, mapper.DefaultOptions(1), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	waitForStatus(t, first, Running)
+	if second.Status().Status != Queued || third.Status().Status != Queued {
+		t.Fatalf("Expected excess jobs to be queued")
+	} else if mgr.Running() != 1 || mgr.Queued() != 2 {
+		t.Errorf("Expected 1 running and 2 queued jobs, got %d and %d", mgr.Running(), mgr.Queued())
+	}
+
+	_, err = mgr.Cancel(second.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitForStatus(t, second, Cancelled)
+
+	_, err = mgr.Cancel(first.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitForStatus(t, first, Cancelled)
+	waitForStatus(t, third, Running)
+
+	_, err = mgr.Cancel(first.ID)
+	if err != ErrJobFinished {
+		t.Errorf("Expected error %v, got %v", ErrJobFinished, err)
+	}
+
+	_, err = mgr.Cancel("missing")
+	if err != ErrJobNotFound {
+		t.Errorf("Expected error %v, got %v", ErrJobNotFound, err)
+	}
+}
+
+func TestJobStop(t *testing.T) {
+	u, err := url.Parse("https://foo.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	mgr := createTestManager(t, 1, func(ctx context.Context, u *url.URL, opts *mapper.Options) (*mapper.SiteMap, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	j, err := mgr.Start(u, mapper.DefaultOptions(1), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitForStatus(t, j, Running)
+
+	stopErr := errors.New("quota exceeded")
+	j.Stop(stopErr)
+	waitForStatus(t, j, Failed)
+	if j.Status().Error != stopErr.Error() {
+		t.Errorf("Expected error %q, got %q", stopErr, j.Status().Error)
+	}
+
+	j.Stop(errors.New("too late"))
+	if j.Status().Error != stopErr.Error() {
+		t.Errorf("Expected finished job to be unaffected, got %q", j.Status().Error)
+	}
+}
+
+func TestJobSubscribe(t *testing.T) {
+	u, err := url.Parse("https://foo.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	start := make(chan struct{})
+	mgr := createTestManager(t, 1, func(ctx context.Context, u *url.URL, opts *mapper.Options) (*mapper.SiteMap, error) {
+		<-start
+		opts.OnEvent(&mapper.Event{Type: mapper.PageQueued, URL: u})
+		opts.OnEvent(&mapper.Event{Type: mapper.CrawlFinished, URL: u})
+		return &mapper.SiteMap{}, nil
+	})
+
+	j, err := mgr.Start(u, mapper.DefaultOptions(1), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	events, unsubscribe := j.Subscribe()
+	defer unsubscribe()
+	close(start)
+
+	var types []mapper.EventType
+	for e := range events {
+		types = append(types, e.Type)
+	}
+
+	if len(types) != 2 || types[0] != mapper.PageQueued || types[1] != mapper.CrawlFinished {
+		t.Errorf("Unexpected events %v", types)
+	}
+
+	finished, unsubscribe := j.Subscribe()
+	defer unsubscribe()
+	if _, ok := <-finished; ok {
+		t.Errorf("Expected subscription to a finished job to be closed")
+	}
+}
+
+func TestManagerAtCapacity(t *testing.T) {
+	u, err := url.Parse("https://foo.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	mgr, err := NewManager(1, 1, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mgr.crawl = func(ctx context.Context, u *url.URL, opts *mapper.Options) (*mapper.SiteMap, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	running, err := mgr.Start(u, mapper.DefaultOptions(1), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitForStatus(t, running, Running)
+
+	queued, err := mgr.Start(u, mapper.DefaultOptions(1), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err = mgr.Start(u, mapper.DefaultOptions(1), "")
+	if err != ErrAtCapacity {
+		t.Errorf("Expected error %v, got %v", ErrAtCapacity, err)
+	}
+
+	for _, j := range []*Job{queued, running} {
+		_, err = mgr.Cancel(j.ID)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+}
+
+func TestManagerResult(t *testing.T) {
+	u, err := url.Parse("https://foo.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	start := make(chan struct{})
+	mgr := createTestManager(t, 1, func(ctx context.Context, u *url.URL, opts *mapper.Options) (*mapper.SiteMap, error) {
+		<-start
+		return &mapper.SiteMap{PageMaps: []*mapper.PageMap{}}, nil
+	})
+
+	j, err := mgr.Start(u, mapper.DefaultOptions(1), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err = mgr.Result(j.ID)
+	if err != ErrResultNotReady {
+		t.Errorf("Expected error %v, got %v", ErrResultNotReady, err)
+	}
+
+	close(start)
+	waitForStatus(t, j, Done)
+
+	result, err := mgr.Result(j.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if string(result) != `{"pages":[]}` {
+		t.Errorf("Unexpected result %s", result)
+	}
+
+	js, err := mgr.store.Status(j.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if js.Status != Done || js.ResultBytes != int64(len(result)) {
+		t.Errorf("Unexpected stored status %+v", js)
+	}
+
+	_, err = mgr.Result("missing")
+	if err != ErrJobNotFound {
+		t.Errorf("Expected error %v, got %v", ErrJobNotFound, err)
+	}
+}
+
+func TestNewManagerInterruptedJobs(t *testing.T) {
+	store := newMemoryStore()
+	now := time.Now()
+	for _, js := range []*JobStatus{
+		{ID: "running", Status: Running, Created: now},
+		{ID: "queued", Status: Queued, Created: now},
+		{ID: "done", Status: Done, Created: now, Finished: &now},
+		{ID: "delivering", Status: Done, Created: now, Finished: &now, Webhook: &WebhookStatus{URL: "https://ci.foo.com", State: WebhookPending}},
+	} {
+		err := store.SaveStatus(js)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	mgr, err := NewManager(1, 1, store)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	testStatus := func(id string, expected Status) {
+		js, err := mgr.Status(id)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		} else if js.Status != expected {
+			t.Errorf("Expected job %s to be %q, got %q", id, expected, js.Status)
+		} else if js.Finished == nil {
+			t.Errorf("Expected job %s to have finished", id)
+		}
+	}
+
+	testStatus("running", Failed)
+	testStatus("queued", Failed)
+	testStatus("done", Done)
+	testStatus("delivering", Done)
+
+	js, err := mgr.Status("delivering")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if js.Webhook.State != WebhookFailed {
+		t.Errorf("Expected undelivered webhook to be %q, got %q", WebhookFailed, js.Webhook.State)
+	}
+
+	_, err = mgr.Cancel("done")
+	if err != ErrJobFinished {
+		t.Errorf("Expected error %v, got %v", ErrJobFinished, err)
+	}
+}
+
+func TestManagerSetWebhook(t *testing.T) {
+	u, err := url.Parse("https://foo.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	mgr := createTestManager(t, 1, func(ctx context.Context, u *url.URL, opts *mapper.Options) (*mapper.SiteMap, error) {
+		return &mapper.SiteMap{}, nil
+	})
+
+	j, err := mgr.Start(u, mapper.DefaultOptions(1), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	<-j.Done()
+
+	err = mgr.SetWebhook(j.ID, &WebhookStatus{URL: "https://ci.foo.com", State: WebhookDelivered, Attempts: 2})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	saved, err := mgr.store.Status(j.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if saved.Webhook == nil || saved.Webhook.State != WebhookDelivered || saved.Webhook.Attempts != 2 {
+		t.Errorf("Unexpected saved webhook %+v", saved.Webhook)
+	} else if saved.Status != Done {
+		t.Errorf("Expected job status to be %q, got %q", Done, saved.Status)
+	}
+
+	err = mgr.SetWebhook("missing", &WebhookStatus{})
+	if err != ErrJobNotFound {
+		t.Errorf("Expected error %v, got %v", ErrJobNotFound, err)
+	}
+}
+
+func TestManagerDelete(t *testing.T) {
+	u, err := url.Parse("https://foo.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	start := make(chan struct{})
+	mgr := createTestManager(t, 1, func(ctx context.Context, u *url.URL, opts *mapper.Options) (*mapper.SiteMap, error) {
+		<-start
+		return &mapper.SiteMap{}, nil
+	})
+
+	j, err := mgr.Start(u, mapper.DefaultOptions(1), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	err = mgr.Delete(j.ID)
+	if err != ErrJobNotFinished {
+		t.Errorf("Expected error %v, got %v", ErrJobNotFinished, err)
+	}
+
+	close(start)
+	<-j.Done()
+
+	err = mgr.Delete(j.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err = mgr.Status(j.ID)
+	if err != ErrJobNotFound {
+		t.Errorf("Expected error %v, got %v", ErrJobNotFound, err)
+	}
+	_, err = mgr.Result(j.ID)
+	if err != ErrJobNotFound {
+		t.Errorf("Expected error %v, got %v", ErrJobNotFound, err)
+	}
+}
+
+func TestManagerList(t *testing.T) {
+	store := newMemoryStore()
+	created := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, id := range []string{"a", "b", "c", "d", "e"} {
+		owner := "alice"
+		if i%2 == 1 {
+			owner = "bob"
+		}
+		err := store.SaveStatus(&JobStatus{ID: id, Owner: owner, Status: Done, Created: created.Add(time.Duration(i) * time.Hour)})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	mgr, err := NewManager(1, 1, store)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var ids []string
+	cursor := ""
+	for pages := 0; pages == 0 || cursor != ""; pages++ {
+		if pages > 5 {
+			t.Fatalf("Expected listing to finish")
+		}
+
+		var statuses []*JobStatus
+		statuses, cursor, err = mgr.List(cursor, 2, nil)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for _, js := range statuses {
+			ids = append(ids, js.ID)
+		}
+	}
+
+	if strings.Join(ids, ",") != "e,d,c,b,a" {
+		t.Errorf("Unexpected job order %v", ids)
+	}
+
+	_, _, err = mgr.List("missing", 2, nil)
+	if err != ErrInvalidCursor {
+		t.Errorf("Expected error %v, got %v", ErrInvalidCursor, err)
+	}
+
+	isBob := func(js *JobStatus) bool { return js.Owner == "bob" }
+	statuses, cursor, err := mgr.List("", 10, isBob)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if len(statuses) != 2 || statuses[0].ID != "d" || statuses[1].ID != "b" || cursor != "" {
+		t.Errorf("Unexpected jobs of bob %v", statuses)
+	}
+
+	_, _, err = mgr.List("c", 2, isBob)
+	if err != ErrInvalidCursor {
+		t.Errorf("Expected error %v for a cursor of another owner, got %v", ErrInvalidCursor, err)
+	}
+}
+
+func TestManagerPrune(t *testing.T) {
+	store := newMemoryStore()
+	now := time.Now()
+	for _, js := range []*JobStatus{
+		{ID: "old", Status: Done, ResultBytes: 10},
+		{ID: "large", Status: Done, ResultBytes: 100},
+		{ID: "small", Status: Failed},
+		{ID: "new", Status: Done, ResultBytes: 10},
+		{ID: "running", Status: Running, ResultBytes: 0},
+	} {
+		finished := now
+		switch js.ID {
+		case "old":
+			finished = now.Add(-48 * time.Hour)
+		case "large":
+			finished = now.Add(-2 * time.Hour)
+		case "small":
+			finished = now.Add(-time.Hour)
+		}
+		if js.Status.IsFinished() {
+			js.Finished = &finished
+		}
+
+		err := store.SaveStatus(js)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	mgr := &Manager{store: store, jobs: make(map[string]*Job)}
+
+	deleted, err := mgr.Prune(24*time.Hour, 0, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if deleted != 1 {
+		t.Errorf("Expected 1 job to be deleted, got %d", deleted)
+	}
+
+	keepLarge := func(js *JobStatus) bool { return js.ID == "large" }
+	deleted, err = mgr.Prune(0, 50, keepLarge)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if deleted != 0 {
+		t.Errorf("Expected kept job to be ignored, got %d deleted", deleted)
+	}
+
+	deleted, err = mgr.Prune(0, 50, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if deleted != 1 {
+		t.Errorf("Expected 1 job to be deleted, got %d", deleted)
+	}
+
+	var ids []string
+	statuses, _, err := mgr.List("", 10, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, js := range statuses {
+		ids = append(ids, js.ID)
+	}
+	sort.Strings(ids)
+
+	if strings.Join(ids, ",") != "new,running,small" {
+		t.Errorf("Unexpected remaining jobs %v", ids)
+	}
+}
+
+func TestManagerShutdown(t *testing.T) {
+	u, err := url.Parse("https://foo.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	finish := make(chan struct{})
+	mgr := createTestManager(t, 1, func(ctx context.Context, u *url.URL, opts *mapper.Options) (*mapper.SiteMap, error) {
+		select {
+		case <-finish:
+			return &mapper.SiteMap{}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+
+	running, err := mgr.Start(u, mapper.DefaultOptions(1), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	queued, err := mgr.Start(u, mapper.DefaultOptions(1), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitForStatus(t, running, Running)
+
+	go func() {
+		for queued.Status().Status != Failed {
+			time.Sleep(time.Millisecond)
+		}
+		close(finish)
+	}()
+
+	err = mgr.Shutdown(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if running.Status().Status != Done {
+		t.Errorf("Expected running job to finish, got %q", running.Status().Status)
+	} else if queued.Status().Error != errInterrupted.Error() {
+		t.Errorf("Expected queued job to be interrupted, got %q", queued.Status().Error)
+	}
+
+	_, err = mgr.Start(u, mapper.DefaultOptions(1), "")
+	if err != ErrShuttingDown {
+		t.Errorf("Expected error %v, got %v", ErrShuttingDown, err)
+	}
+}
+
+func TestManagerShutdownDeadline(t *testing.T) {
+	u, err := url.Parse("https://foo.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	mgr := createTestManager(t, 1, func(ctx context.Context, u *url.URL, opts *mapper.Options) (*mapper.SiteMap, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	j, err := mgr.Start(u, mapper.DefaultOptions(1), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitForStatus(t, j, Running)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err = mgr.Shutdown(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected error %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	js, err := mgr.store.Status(j.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if js.Status != Failed || js.Error != errInterrupted.Error() {
+		t.Errorf("Expected interrupted job to have failed, got %+v", js)
+	}
+}
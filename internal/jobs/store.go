@@ -0,0 +1,93 @@
+package jobs
+
+import (
+	"sync"
+)
+
+// A Store persists the statuses and results of jobs, so that they can be
+// fetched after the job has finished, or the process has restarted.
+// Status returns ErrJobNotFound for an unknown job, while Result returns
+// ErrResultNotReady for a job without a stored result.
+type Store interface {
+	SaveStatus(js *JobStatus) error
+	Status(id string) (*JobStatus, error)
+	Statuses() ([]*JobStatus, error)
+	SaveResult(id string, result []byte) error
+	Result(id string) ([]byte, error)
+	Delete(id string) error
+}
+
+// memoryStore keeps jobs only for the lifetime of the process.
+type memoryStore struct {
+	m        sync.Mutex
+	statuses map[string]*JobStatus
+	results  map[string][]byte
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		statuses: make(map[string]*JobStatus),
+		results:  make(map[string][]byte),
+	}
+}
+
+func (ms *memoryStore) SaveStatus(js *JobStatus) error {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	saved := *js
+	ms.statuses[js.ID] = &saved
+	return nil
+}
+
+func (ms *memoryStore) Status(id string) (*JobStatus, error) {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	js, ok := ms.statuses[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	saved := *js
+	return &saved, nil
+}
+
+func (ms *memoryStore) Statuses() ([]*JobStatus, error) {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	statuses := make([]*JobStatus, 0, len(ms.statuses))
+	for _, js := range ms.statuses {
+		saved := *js
+		statuses = append(statuses, &saved)
+	}
+	return statuses, nil
+}
+
+func (ms *memoryStore) SaveResult(id string, result []byte) error {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	ms.results[id] = result
+	return nil
+}
+
+func (ms *memoryStore) Result(id string) ([]byte, error) {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	result, ok := ms.results[id]
+	if !ok {
+		return nil, ErrResultNotReady
+	}
+	return result, nil
+}
+
+func (ms *memoryStore) Delete(id string) error {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	delete(ms.statuses, id)
+	delete(ms.results, id)
+	return nil
+}
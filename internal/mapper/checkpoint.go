@@ -0,0 +1,146 @@
+package mapper
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+)
+
+// A Checkpoint is the state of a crawl in progress, from which the crawl can
+// be resumed. Pages are the pages already processed, which are not fetched
+// again, while Frontier lists the pages queued but not yet processed.
+type Checkpoint struct {
+	URL      *url.URL
+	Pages    []*PageMap
+	Frontier []*QueuedURL
+}
+
+// A QueuedURL is a page queued to be crawled, along with its depth.
+type QueuedURL struct {
+	URL   *url.URL
+	Depth int
+}
+
+func (cp *Checkpoint) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		URL      string       `json:"url"`
+		Pages    []*PageMap   `json:"pages"`
+		Frontier []*QueuedURL `json:"frontier"`
+	}{
+		URL:      cp.URL.String(),
+		Pages:    cp.Pages,
+		Frontier: cp.Frontier,
+	})
+}
+
+func (cp *Checkpoint) UnmarshalJSON(b []byte) error {
+	var v struct {
+		URL      string       `json:"url"`
+		Pages    []*PageMap   `json:"pages"`
+		Frontier []*QueuedURL `json:"frontier"`
+	}
+	err := json.Unmarshal(b, &v)
+	if err != nil {
+		return err
+	}
+
+	u, err := url.Parse(v.URL)
+	if err != nil {
+		return err
+	}
+	*cp = Checkpoint{URL: u, Pages: v.Pages, Frontier: v.Frontier}
+	return nil
+}
+
+func (qu *QueuedURL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		URL   string `json:"url"`
+		Depth int    `json:"depth"`
+	}{
+		URL:   qu.URL.String(),
+		Depth: qu.Depth,
+	})
+}
+
+func (qu *QueuedURL) UnmarshalJSON(b []byte) error {
+	var v struct {
+		URL   string `json:"url"`
+		Depth int    `json:"depth"`
+	}
+	err := json.Unmarshal(b, &v)
+	if err != nil {
+		return err
+	}
+
+	u, err := url.Parse(v.URL)
+	if err != nil {
+		return err
+	}
+	*qu = QueuedURL{URL: u, Depth: v.Depth}
+	return nil
+}
+
+// createCheckpoint returns the state of a crawl from the pages processed so
+// far and its frontier. The frontier is sorted by depth.
+func createCheckpoint(initialURL *url.URL, pms []*PageMap, frontier Frontier) (*Checkpoint, error) {
+	pending, err := frontier.Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	cp := &Checkpoint{
+		URL:      initialURL,
+		Pages:    append([]*PageMap(nil), pms...),
+		Frontier: append([]*QueuedURL{}, pending...),
+	}
+	sort.Slice(cp.Frontier, func(i, j int) bool {
+		if cp.Frontier[i].Depth == cp.Frontier[j].Depth {
+			return cp.Frontier[i].URL.String() < cp.Frontier[j].URL.String()
+		}
+		return cp.Frontier[i].Depth < cp.Frontier[j].Depth
+	})
+	return cp, nil
+}
+
+// resumeFrontier records the pages of cp as visited in frontier, then queues
+// the pages to crawl when resuming from cp with queue. Along with the seeds
+// and the frontier of cp, links of the pages already processed are queued,
+// as they may not have been queued when the checkpoint was created. The
+// frontier skips any page already queued or visited.
+func resumeFrontier(cp *Checkpoint, seeds []*url.URL, opts *Options, frontier Frontier, queue func(u *url.URL, depth int) error) error {
+	for _, pm := range cp.Pages {
+		err := frontier.Visit(pm.URL)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, seed := range seeds {
+		err := queue(seed, 0)
+		if err != nil {
+			return err
+		}
+	}
+	for _, qu := range cp.Frontier {
+		err := queue(qu.URL, qu.Depth)
+		if err != nil {
+			return err
+		}
+	}
+	for _, pm := range cp.Pages {
+		depth := pm.Depth + 1
+		if opts.MaxDepth > 0 && depth > opts.MaxDepth {
+			continue
+		}
+		for _, link := range pm.Links {
+			if !shouldCrawl(opts, seeds, link) {
+				continue
+			}
+			err := queue(link, depth)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package mapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestCheckpointJSON(t *testing.T) {
+	b := []byte(`{"url":"https://foo.com","pages":[{"url":"https://foo.com","status":200,"latencyMs":0,"depth":0,` +
+		`"links":["https://foo.com/a"],"assets":[]}],"frontier":[{"url":"https://foo.com/a","depth":1}]}`)
+
+	var cp Checkpoint
+	err := json.Unmarshal(b, &cp)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if cp.URL.String() != "https://foo.com" || len(cp.Pages) != 1 || len(cp.Frontier) != 1 {
+		t.Fatalf("Unexpected checkpoint %+v", cp)
+	} else if cp.Frontier[0].URL.String() != "https://foo.com/a" || cp.Frontier[0].Depth != 1 {
+		t.Errorf("Unexpected frontier url %+v", cp.Frontier[0])
+	}
+
+	out, err := json.Marshal(&cp)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if string(out) != string(b) {
+		t.Errorf("Expected %s, got %s", b, out)
+	}
+}
+
+func TestCreateCheckpoint(t *testing.T) {
+	urls, err := parseURLs([]string{"https://foo.com", "https://foo.com/b/c", "https://foo.com/b", "https://foo.com/a"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	frontier := newMemoryFrontier()
+	for i, depth := range []int{0, 2, 1, 1} {
+		frontier.Queue(urls[i], depth)
+	}
+	frontier.Pop()
+	frontier.Visit(urls[0])
+	frontier.Pop()
+
+	cp, err := createCheckpoint(urls[0], []*PageMap{&PageMap{URL: urls[0]}}, frontier)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var pending []string
+	for _, qu := range cp.Frontier {
+		pending = append(pending, qu.URL.String())
+	}
+
+	expected := []string{"https://foo.com/a", "https://foo.com/b", "https://foo.com/b/c"}
+	if !reflect.DeepEqual(pending, expected) {
+		t.Errorf("Expected frontier %v, got %v", expected, pending)
+	} else if len(cp.Pages) != 1 || cp.URL != urls[0] {
+		t.Errorf("Unexpected checkpoint %+v", cp)
+	}
+}
+
+func TestResumeFrontier(t *testing.T) {
+	urls, err := parseURLs([]string{"https://foo.com", "https://foo.com/a", "https://foo.com/b", "https://bar.com"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	cp := &Checkpoint{
+		URL:      urls[0],
+		Pages:    []*PageMap{&PageMap{URL: urls[0], Links: urls}},
+		Frontier: []*QueuedURL{&QueuedURL{URL: urls[2], Depth: 1}},
+	}
+
+	frontier := newMemoryFrontier()
+	var queue []*QueuedURL
+	err = resumeFrontier(cp, urls[:1], DefaultOptions(1), frontier, func(u *url.URL, depth int) error {
+		added, err := frontier.Queue(u, depth)
+		if added {
+			queue = append(queue, &QueuedURL{URL: u, Depth: depth})
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var queued []string
+	for _, qu := range queue {
+		queued = append(queued, fmt.Sprintf("%s %d", qu.URL, qu.Depth))
+	}
+	expected := []string{"https://foo.com/b 1", "https://foo.com/a 1"}
+	if !reflect.DeepEqual(queued, expected) {
+		t.Errorf("Expected the frontier, then unqueued links in scope, got %v", queued)
+	}
+
+	if added, _ := frontier.Queue(urls[0], 0); added {
+		t.Errorf("Expected page of checkpoint to be visited")
+	}
+}
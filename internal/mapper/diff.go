@@ -0,0 +1,107 @@
+package mapper
+
+import (
+	"net/url"
+	"sort"
+)
+
+// A SiteMapDiff describes how a site map changed between two crawls. Pages
+// are identified by their url, and every list is sorted.
+type SiteMapDiff struct {
+	Added   []string    `json:"added"`
+	Removed []string    `json:"removed"`
+	Changed []*PageDiff `json:"changed"`
+}
+
+// A PageDiff describes how a page found by both crawls changed. The statuses
+// are equal unless the status of the page changed.
+type PageDiff struct {
+	URL           string   `json:"url"`
+	OldStatus     int      `json:"oldStatus"`
+	NewStatus     int      `json:"newStatus"`
+	LinksAdded    []string `json:"linksAdded,omitempty"`
+	LinksRemoved  []string `json:"linksRemoved,omitempty"`
+	AssetsAdded   []string `json:"assetsAdded,omitempty"`
+	AssetsRemoved []string `json:"assetsRemoved,omitempty"`
+}
+
+// StatusChanged reports whether the status of the page changed.
+func (pd *PageDiff) StatusChanged() bool {
+	return pd.OldStatus != pd.NewStatus
+}
+
+// IsEmpty reports whether the site maps are the same.
+func (d *SiteMapDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// CreateSiteMapDiff compares the site map of an earlier crawl, old, with that
+// of a later crawl, newer.
+func CreateSiteMapDiff(old, newer *SiteMap) *SiteMapDiff {
+	oldPages := pagesByURL(old)
+	newPages := pagesByURL(newer)
+
+	d := &SiteMapDiff{Added: []string{}, Removed: []string{}, Changed: []*PageDiff{}}
+	for u, npm := range newPages {
+		opm, ok := oldPages[u]
+		if !ok {
+			d.Added = append(d.Added, u)
+			continue
+		}
+
+		pd := &PageDiff{URL: u, OldStatus: opm.StatusCode, NewStatus: npm.StatusCode}
+		pd.LinksAdded, pd.LinksRemoved = diffURLs(opm.Links, npm.Links)
+		pd.AssetsAdded, pd.AssetsRemoved = diffURLs(opm.Assets, npm.Assets)
+		if pd.StatusChanged() || len(pd.LinksAdded) > 0 || len(pd.LinksRemoved) > 0 ||
+			len(pd.AssetsAdded) > 0 || len(pd.AssetsRemoved) > 0 {
+			d.Changed = append(d.Changed, pd)
+		}
+	}
+	for u := range oldPages {
+		if _, ok := newPages[u]; !ok {
+			d.Removed = append(d.Removed, u)
+		}
+	}
+
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Slice(d.Changed, func(i, j int) bool {
+		return d.Changed[i].URL < d.Changed[j].URL
+	})
+	return d
+}
+
+func pagesByURL(sm *SiteMap) map[string]*PageMap {
+	pages := make(map[string]*PageMap, len(sm.PageMaps))
+	for _, pm := range sm.PageMaps {
+		pages[pm.URL.String()] = pm
+	}
+	return pages
+}
+
+// diffURLs returns the urls in newer but not old, and those in old but not
+// newer.
+func diffURLs(old, newer []*url.URL) (added, removed []string) {
+	oldSet := make(map[string]bool, len(old))
+	for _, u := range old {
+		oldSet[u.String()] = true
+	}
+	newSet := make(map[string]bool, len(newer))
+	for _, u := range newer {
+		newSet[u.String()] = true
+	}
+
+	for u := range newSet {
+		if !oldSet[u] {
+			added = append(added, u)
+		}
+	}
+	for u := range oldSet {
+		if !newSet[u] {
+			removed = append(removed, u)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
@@ -0,0 +1,71 @@
+package mapper
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestCreateSiteMapDiff(t *testing.T) {
+	createURLs := func(strs ...string) []*url.URL {
+		urls, err := parseURLs(strs)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return urls
+	}
+	createPageMap := func(str string, status int, links, assets []string) *PageMap {
+		return &PageMap{
+			URL:        createURLs(str)[0],
+			StatusCode: status,
+			Links:      createURLs(links...),
+			Assets:     createURLs(assets...),
+		}
+	}
+
+	old := &SiteMap{PageMaps: []*PageMap{
+		createPageMap("https://foo.com", 200, []string{"https://foo.com/about", "https://foo.com/blog"}, []string{"https://foo.com/logo.png"}),
+		createPageMap("https://foo.com/about", 200, nil, nil),
+		createPageMap("https://foo.com/blog", 200, nil, nil),
+		createPageMap("https://foo.com/same", 200, []string{"https://foo.com"}, nil),
+	}}
+	newer := &SiteMap{PageMaps: []*PageMap{
+		createPageMap("https://foo.com", 200, []string{"https://foo.com/about", "https://foo.com/news"}, []string{"https://foo.com/logo.svg"}),
+		createPageMap("https://foo.com/about", 404, nil, nil),
+		createPageMap("https://foo.com/news", 200, nil, nil),
+		createPageMap("https://foo.com/same", 200, []string{"https://foo.com"}, nil),
+	}}
+
+	d := CreateSiteMapDiff(old, newer)
+	if !reflect.DeepEqual(d.Added, []string{"https://foo.com/news"}) {
+		t.Errorf("Unexpected added pages %v", d.Added)
+	} else if !reflect.DeepEqual(d.Removed, []string{"https://foo.com/blog"}) {
+		t.Errorf("Unexpected removed pages %v", d.Removed)
+	} else if len(d.Changed) != 2 {
+		t.Fatalf("Expected 2 changed pages, got %d", len(d.Changed))
+	}
+
+	expected := []*PageDiff{
+		{
+			URL:           "https://foo.com",
+			OldStatus:     200,
+			NewStatus:     200,
+			LinksAdded:    []string{"https://foo.com/news"},
+			LinksRemoved:  []string{"https://foo.com/blog"},
+			AssetsAdded:   []string{"https://foo.com/logo.svg"},
+			AssetsRemoved: []string{"https://foo.com/logo.png"},
+		},
+		{URL: "https://foo.com/about", OldStatus: 200, NewStatus: 404},
+	}
+	for i, pd := range d.Changed {
+		if !reflect.DeepEqual(pd, expected[i]) {
+			t.Errorf("Expected page diff %+v, got %+v", expected[i], pd)
+		}
+	}
+
+	if d.IsEmpty() {
+		t.Errorf("Expected diff not to be empty")
+	} else if !CreateSiteMapDiff(newer, newer).IsEmpty() {
+		t.Errorf("Expected diff of identical site maps to be empty")
+	}
+}
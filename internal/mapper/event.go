@@ -0,0 +1,102 @@
+package mapper
+
+import (
+	"encoding/json"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// An EventType identifies what happened during a crawl.
+type EventType string
+
+const (
+	// PageQueued is emitted when a url is added to the frontier to be crawled.
+	PageQueued EventType = "pageQueued"
+
+	// PageFetched is emitted when a page has been fetched and parsed, along
+	// with its status code and how long it took.
+	PageFetched EventType = "pageFetched"
+
+	// PageFailed is emitted when a page could not be fetched or parsed.
+	PageFailed EventType = "pageFailed"
+
+	// LinkDiscovered is emitted for every link found on a processed page.
+	LinkDiscovered EventType = "linkDiscovered"
+
+	// CrawlFinished is emitted once the crawl has completed or stopped.
+	CrawlFinished EventType = "crawlFinished"
+)
+
+// An Event describes the progress of a crawl. Only the fields relevant to
+// Type are set: Source is the page a discovered link was found on, Status
+// and Duration describe a fetched page, Pages is the number of pages in a
+// finished site map and Err is the reason a page or crawl failed.
+type Event struct {
+	Type     EventType
+	Time     time.Time
+	URL      *url.URL
+	Source   *url.URL
+	Status   int
+	Duration time.Duration
+	Pages    int
+	Err      error
+}
+
+func (e *Event) MarshalJSON() ([]byte, error) {
+	urlToString := func(u *url.URL) string {
+		if u == nil {
+			return ""
+		}
+		return u.String()
+	}
+
+	var errStr string
+	if e.Err != nil {
+		errStr = e.Err.Error()
+	}
+
+	return json.Marshal(struct {
+		Type       EventType `json:"type"`
+		Time       time.Time `json:"time"`
+		URL        string    `json:"url,omitempty"`
+		Source     string    `json:"source,omitempty"`
+		Status     int       `json:"status,omitempty"`
+		DurationMs int64     `json:"durationMs,omitempty"`
+		Pages      int       `json:"pages,omitempty"`
+		Error      string    `json:"error,omitempty"`
+	}{
+		Type:       e.Type,
+		Time:       e.Time,
+		URL:        urlToString(e.URL),
+		Source:     urlToString(e.Source),
+		Status:     e.Status,
+		DurationMs: int64(e.Duration / time.Millisecond),
+		Pages:      e.Pages,
+		Error:      errStr,
+	})
+}
+
+func emitEvent(opts *Options, e *Event) {
+	if opts.OnEvent == nil {
+		return
+	}
+
+	e.Time = time.Now()
+	opts.OnEvent(e)
+}
+
+// serializeEvents wraps onEvent so that it is never called concurrently, as
+// events are emitted from every worker.
+func serializeEvents(onEvent func(*Event)) func(*Event) {
+	if onEvent == nil {
+		return nil
+	}
+
+	var m sync.Mutex
+	return func(e *Event) {
+		m.Lock()
+		defer m.Unlock()
+		onEvent(e)
+	}
+}
@@ -0,0 +1,111 @@
+package mapper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEventMarshalJSON(t *testing.T) {
+	u, err := url.Parse("https://foo.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	e := Event{
+		Type:     PageFetched,
+		Time:     time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC),
+		URL:      u,
+		Status:   200,
+		Duration: 1500 * time.Millisecond,
+	}
+	b, err := json.Marshal(&e)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := `{"type":"pageFetched","time":"2016-01-02T03:04:05Z","url":"https://foo.com","status":200,"durationMs":1500}`
+	if string(b) != expected {
+		t.Errorf("Expected %s, got %s", expected, b)
+	}
+
+	e = Event{Type: PageFailed, Time: e.Time, URL: u, Err: errors.New("timeout")}
+	b, err = json.Marshal(&e)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected = `{"type":"pageFailed","time":"2016-01-02T03:04:05Z","url":"https://foo.com","error":"timeout"}`
+	if string(b) != expected {
+		t.Errorf("Expected %s, got %s", expected, b)
+	}
+}
+
+func TestSerializeEvents(t *testing.T) {
+	if serializeEvents(nil) != nil {
+		t.Errorf("Expected nil event handler to remain nil")
+	}
+
+	count := 0
+	onEvent := serializeEvents(func(e *Event) {
+		count++
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(100)
+	for i := 0; i < 100; i++ {
+		go func() {
+			onEvent(&Event{Type: PageQueued})
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+
+	if count != 100 {
+		t.Errorf("Expected 100 events, got %d", count)
+	}
+}
+
+func TestProcessPagesEvents(t *testing.T) {
+	u, err := url.Parse("https://foo.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	externalLink, err := url.Parse("https://bar.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var processed []string
+	urls := make(chan *QueuedURL)
+	results := createTestWorker(urls, &processed, &PageMap{URL: u, Links: []*url.URL{externalLink}})
+
+	var events []*Event
+	opts := &Options{
+		OnEvent: serializeEvents(func(e *Event) {
+			if e.Type != PageQueued {
+				events = append(events, e)
+			}
+		}),
+	}
+	_, _, err = processPages(context.Background(), u, urls, results, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+
+	e := events[0]
+	if e.Type != LinkDiscovered || e.URL != externalLink || e.Source != u {
+		t.Errorf("Unexpected event %+v", e)
+	} else if e.Time.IsZero() {
+		t.Errorf("Expected event time to be set")
+	}
+}
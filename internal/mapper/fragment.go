@@ -0,0 +1,119 @@
+package mapper
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// A BrokenFragment is a link from Page to a fragment of a crawled page that
+// has no element with a matching id or anchor name.
+type BrokenFragment struct {
+	Page *url.URL
+	Link *url.URL
+}
+
+func (bf *BrokenFragment) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Page string `json:"page"`
+		Link string `json:"link"`
+	}{
+		Page: bf.Page.String(),
+		Link: bf.Link.String(),
+	})
+}
+
+func (bf *BrokenFragment) UnmarshalJSON(b []byte) error {
+	var v struct {
+		Page string `json:"page"`
+		Link string `json:"link"`
+	}
+	err := json.Unmarshal(b, &v)
+	if err != nil {
+		return err
+	}
+
+	page, err := url.Parse(v.Page)
+	if err != nil {
+		return err
+	}
+	link, err := url.Parse(v.Link)
+	if err != nil {
+		return err
+	}
+	*bf = BrokenFragment{Page: page, Link: link}
+	return nil
+}
+
+func addFragmentLink(pm *PageMap, linkURL *url.URL, fragment string) {
+	if fragment == "" {
+		return
+	}
+
+	fragmentURL := *linkURL
+	fragmentURL.Fragment = fragment
+	pm.FragmentLinks = append(pm.FragmentLinks, &fragmentURL)
+}
+
+func addAnchorIDs(pm *PageMap, n *html.Node) {
+	if id, err := getNodeAttrValue(n, "id"); err == nil && id != "" {
+		pm.AnchorIDs = append(pm.AnchorIDs, id)
+	}
+
+	if getNodeType(n) != anchorNode {
+		return
+	}
+
+	if name, err := getNodeAttrValue(n, "name"); err == nil && name != "" {
+		pm.AnchorIDs = append(pm.AnchorIDs, name)
+	}
+}
+
+func getUniqueStrings(strs []string) []string {
+	var unique []string
+	seen := make(map[string]bool)
+	for _, s := range strs {
+		if !seen[s] {
+			seen[s] = true
+			unique = append(unique, s)
+		}
+	}
+	return unique
+}
+
+// findBrokenFragments returns the fragment links whose target page was
+// crawled but does not contain the fragment. Links to pages outside of pms
+// cannot be checked and are ignored.
+func findBrokenFragments(pms []*PageMap) []*BrokenFragment {
+	anchors := make(map[string]map[string]bool)
+	for _, pm := range pms {
+		ids := make(map[string]bool)
+		for _, id := range pm.AnchorIDs {
+			ids[id] = true
+		}
+		anchors[pm.URL.String()] = ids
+	}
+
+	var broken []*BrokenFragment
+	for _, pm := range pms {
+		for _, link := range pm.FragmentLinks {
+			target := *link
+			target.Fragment = ""
+
+			ids, crawled := anchors[target.String()]
+			if !crawled || ids[link.Fragment] || isTopFragment(link.Fragment) {
+				continue
+			}
+			broken = append(broken, &BrokenFragment{Page: pm.URL, Link: link})
+		}
+	}
+	return broken
+}
+
+// isTopFragment reports whether fragment scrolls to the top of the document
+// even when no element has a matching id.
+func isTopFragment(fragment string) bool {
+	return strings.EqualFold(fragment, "top")
+}
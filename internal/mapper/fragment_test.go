@@ -0,0 +1,131 @@
+package mapper
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestAddLinkURLFragment(t *testing.T) {
+	u, err := url.Parse("https://foo.com/docs")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	opts := DefaultOptions(1)
+	opts.CheckFragments = true
+
+	pm := PageMap{URL: u}
+	for _, href := range []string{"/docs/api#create-user", "#intro", "/docs/guide"} {
+		n := html.Node{
+			Type: html.ElementNode,
+			Data: "a",
+			Attr: []html.Attribute{
+				html.Attribute{Key: "href", Val: href},
+			},
+		}
+
+		err = addLinkURL(&pm, &n, opts)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if len(pm.Links) != 3 {
+		t.Errorf("Expected number links to be 3, got %d", len(pm.Links))
+	}
+
+	expected := []string{"https://foo.com/docs/api#create-user", "https://foo.com/docs#intro"}
+	if len(pm.FragmentLinks) != len(expected) {
+		t.Fatalf("Expected number fragment links to be %d, got %d", len(expected), len(pm.FragmentLinks))
+	}
+	for i, linkStr := range expected {
+		if pm.FragmentLinks[i].String() != linkStr {
+			t.Errorf("Expected fragment link to be %q, got %q", linkStr, pm.FragmentLinks[i].String())
+		}
+	}
+}
+
+func TestAddAnchorIDs(t *testing.T) {
+	pm := PageMap{}
+	addAnchorIDs(&pm, &html.Node{
+		Type: html.ElementNode,
+		Data: "h2",
+		Attr: []html.Attribute{
+			html.Attribute{Key: "id", Val: "create-user"},
+		},
+	})
+	addAnchorIDs(&pm, &html.Node{
+		Type: html.ElementNode,
+		Data: "a",
+		Attr: []html.Attribute{
+			html.Attribute{Key: "name", Val: "legacy"},
+		},
+	})
+	addAnchorIDs(&pm, &html.Node{
+		Type: html.ElementNode,
+		Data: "div",
+		Attr: []html.Attribute{
+			html.Attribute{Key: "name", Val: "ignored"},
+		},
+	})
+
+	if len(pm.AnchorIDs) != 2 {
+		t.Fatalf("Expected 2 anchor ids, got %d", len(pm.AnchorIDs))
+	} else if pm.AnchorIDs[0] != "create-user" || pm.AnchorIDs[1] != "legacy" {
+		t.Errorf("Unexpected anchor ids %v", pm.AnchorIDs)
+	}
+}
+
+func TestFindBrokenFragments(t *testing.T) {
+	createURL := func(str string) *url.URL {
+		u, err := url.Parse(str)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return u
+	}
+
+	pms := []*PageMap{
+		&PageMap{
+			URL: createURL("https://foo.com/docs"),
+			FragmentLinks: []*url.URL{
+				createURL("https://foo.com/docs/api#create-user"),
+				createURL("https://foo.com/docs/api#delete-user"),
+				createURL("https://foo.com/docs#top"),
+				createURL("https://foo.com/uncrawled#missing"),
+			},
+		},
+		&PageMap{
+			URL:       createURL("https://foo.com/docs/api"),
+			AnchorIDs: []string{"create-user"},
+		},
+	}
+
+	broken := findBrokenFragments(pms)
+	if len(broken) != 1 {
+		t.Fatalf("Expected 1 broken fragment, got %d", len(broken))
+	}
+
+	if broken[0].Page.String() != "https://foo.com/docs" {
+		t.Errorf("Expected page to be %q, got %q", "https://foo.com/docs", broken[0].Page)
+	} else if broken[0].Link.String() != "https://foo.com/docs/api#delete-user" {
+		t.Errorf("Expected link to be %q, got %q", "https://foo.com/docs/api#delete-user", broken[0].Link)
+	}
+}
+
+func TestBrokenFragmentJSON(t *testing.T) {
+	var bf BrokenFragment
+	err := json.Unmarshal([]byte(`{"page":"https://foo.com/docs","link":"https://foo.com/docs/api#delete-user"}`), &bf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if bf.Page.String() != "https://foo.com/docs" {
+		t.Errorf("Expected page to be %q, got %q", "https://foo.com/docs", bf.Page)
+	} else if bf.Link.String() != "https://foo.com/docs/api#delete-user" {
+		t.Errorf("Expected link to be %q, got %q", "https://foo.com/docs/api#delete-user", bf.Link)
+	}
+}
@@ -0,0 +1,89 @@
+package mapper
+
+import (
+	"net/url"
+	"sync"
+)
+
+// A Frontier is the queue of pages to crawl, which also records the pages
+// visited so that no page is queued twice. Pages are popped in the order
+// they were queued. Implementations must be safe for concurrent use.
+type Frontier interface {
+	// Queue adds u to the end of the queue at depth, unless it was already
+	// queued or visited, reporting whether it was added.
+	Queue(u *url.URL, depth int) (bool, error)
+
+	// Pop removes the page at the front of the queue and returns it, or nil
+	// if the queue is empty. The page stays pending until it is visited.
+	Pop() (*QueuedURL, error)
+
+	// Visit records that u, which was popped or never queued, was visited,
+	// so that it is no longer pending and is never queued again.
+	Visit(u *url.URL) error
+
+	// Pending returns every page queued, or popped, but not visited.
+	Pending() ([]*QueuedURL, error)
+}
+
+// memoryFrontier is the frontier used when none is configured, keeping every
+// page in memory.
+type memoryFrontier struct {
+	m      sync.Mutex
+	seen   map[string]bool
+	queue  []*QueuedURL
+	popped map[string]*QueuedURL
+}
+
+func newMemoryFrontier() *memoryFrontier {
+	return &memoryFrontier{
+		seen:   make(map[string]bool),
+		popped: make(map[string]*QueuedURL),
+	}
+}
+
+func (mf *memoryFrontier) Queue(u *url.URL, depth int) (bool, error) {
+	mf.m.Lock()
+	defer mf.m.Unlock()
+
+	if mf.seen[u.String()] {
+		return false, nil
+	}
+	mf.seen[u.String()] = true
+	mf.queue = append(mf.queue, &QueuedURL{URL: u, Depth: depth})
+	return true, nil
+}
+
+func (mf *memoryFrontier) Pop() (*QueuedURL, error) {
+	mf.m.Lock()
+	defer mf.m.Unlock()
+
+	if len(mf.queue) == 0 {
+		return nil, nil
+	}
+	qu := mf.queue[0]
+	mf.queue[0] = nil
+	mf.queue = mf.queue[1:]
+	mf.popped[qu.URL.String()] = qu
+	return qu, nil
+}
+
+func (mf *memoryFrontier) Visit(u *url.URL) error {
+	mf.m.Lock()
+	defer mf.m.Unlock()
+
+	mf.seen[u.String()] = true
+	delete(mf.popped, u.String())
+	return nil
+}
+
+func (mf *memoryFrontier) Pending() ([]*QueuedURL, error) {
+	mf.m.Lock()
+	defer mf.m.Unlock()
+
+	pending := make([]*QueuedURL, 0, len(mf.queue)+len(mf.popped))
+	pending = append(pending, mf.queue...)
+	for _, qu := range mf.popped {
+		pending = append(pending, qu)
+	}
+	return pending, nil
+}
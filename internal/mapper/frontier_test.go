@@ -0,0 +1,65 @@
+package mapper
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestMemoryFrontierQueue(t *testing.T) {
+	urls, err := parseURLs([]string{"https://foo.com", "https://foo.com/a", "https://foo.com/b"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	frontier := newMemoryFrontier()
+	for i, depth := range []int{0, 1, 2} {
+		added, err := frontier.Queue(urls[i], depth)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		} else if !added {
+			t.Errorf("Expected %s to be added", urls[i])
+		}
+	}
+
+	if added, _ := frontier.Queue(urls[1], 0); added {
+		t.Errorf("Expected queued page not to be added again")
+	}
+
+	qu, err := frontier.Pop()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if qu.URL != urls[0] || qu.Depth != 0 {
+		t.Errorf("Expected %s to be popped first, got %+v", urls[0], qu)
+	}
+	frontier.Visit(urls[0])
+
+	if added, _ := frontier.Queue(urls[0], 1); added {
+		t.Errorf("Expected visited page not to be added again")
+	}
+
+	qu, _ = frontier.Pop()
+	if qu.URL != urls[1] || qu.Depth != 1 {
+		t.Errorf("Expected %s to be popped next, got %+v", urls[1], qu)
+	}
+
+	pending, err := frontier.Pending()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if len(pending) != 2 || pending[0].URL != urls[2] || pending[1].URL != urls[1] {
+		t.Errorf("Expected queued then popped pages to be pending, got %v", pending)
+	}
+
+	frontier.Visit(urls[1])
+	frontier.Pop()
+	qu, err = frontier.Pop()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if qu != nil {
+		t.Errorf("Expected empty queue, got %+v", qu)
+	}
+
+	frontier.Visit(&url.URL{Scheme: "https", Host: "bar.com"})
+	if added, _ := frontier.Queue(&url.URL{Scheme: "https", Host: "bar.com"}, 0); added {
+		t.Errorf("Expected page visited without being queued not to be added")
+	}
+}
@@ -0,0 +1,162 @@
+package mapper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// PageMetadata contains the SEO and content metadata found on a page.
+type PageMetadata struct {
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	Keywords    []string          `json:"keywords"`
+	Language    string            `json:"language"`
+	Headings    []*Heading        `json:"headings"`
+	OpenGraph   map[string]string `json:"openGraph"`
+	Twitter     map[string]string `json:"twitter"`
+	WordCount   int               `json:"wordCount"`
+	ContentHash string            `json:"contentHash"`
+}
+
+// A Heading is the text of an h1 through h6 element.
+type Heading struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+}
+
+func extractMetadata(root *html.Node) *PageMetadata {
+	md := &PageMetadata{
+		OpenGraph: make(map[string]string),
+		Twitter:   make(map[string]string),
+	}
+	processMetadataNode(md, root)
+
+	text := getNodeText(root)
+	md.WordCount = len(strings.Fields(text))
+	md.ContentHash = getContentHash(getMainContentNode(root))
+	return md
+}
+
+func processMetadataNode(md *PageMetadata, n *html.Node) {
+	if n.Type == html.ElementNode {
+		switch n.Data {
+		case "html":
+			md.Language, _ = getNodeAttrValue(n, "lang")
+		case "title":
+			if md.Title == "" {
+				md.Title = getNodeText(n)
+			}
+		case "meta":
+			addMetaTag(md, n)
+		case "h1", "h2", "h3", "h4", "h5", "h6":
+			md.Headings = append(md.Headings, &Heading{
+				Level: int(n.Data[1] - '0'),
+				Text:  getNodeText(n),
+			})
+		case "svg", "math":
+			return
+		}
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		processMetadataNode(md, child)
+	}
+}
+
+func addMetaTag(md *PageMetadata, n *html.Node) {
+	content, err := getNodeAttrValue(n, "content")
+	if err != nil {
+		return
+	}
+
+	name, err := getNodeAttrValue(n, "name")
+	if err != nil {
+		name, err = getNodeAttrValue(n, "property")
+		if err != nil {
+			return
+		}
+	}
+
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch {
+	case name == "description":
+		md.Description = strings.TrimSpace(content)
+	case name == "keywords":
+		md.Keywords = splitKeywords(content)
+	case strings.HasPrefix(name, "og:"):
+		md.OpenGraph[strings.TrimPrefix(name, "og:")] = content
+	case strings.HasPrefix(name, "twitter:"):
+		md.Twitter[strings.TrimPrefix(name, "twitter:")] = content
+	}
+}
+
+func splitKeywords(content string) []string {
+	var keywords []string
+	for _, keyword := range strings.Split(content, ",") {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			keywords = append(keywords, keyword)
+		}
+	}
+	return keywords
+}
+
+// getNodeText returns the visible text within n, with runs of whitespace
+// collapsed into a single space.
+func getNodeText(n *html.Node) string {
+	var words []string
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			words = append(words, strings.Fields(n.Data)...)
+			return
+		} else if n.Type == html.ElementNode && isInvisibleNode(n) {
+			return
+		}
+
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			collect(child)
+		}
+	}
+	collect(n)
+	return strings.Join(words, " ")
+}
+
+func isInvisibleNode(n *html.Node) bool {
+	switch n.Data {
+	case "head", "script", "style", "noscript", "template", "svg", "math":
+		return true
+	}
+	return false
+}
+
+// getMainContentNode returns the node holding the main content of the page,
+// preferring main over article over body.
+func getMainContentNode(root *html.Node) *html.Node {
+	for _, tag := range []string{"main", "article", "body"} {
+		if n := findElement(root, tag); n != nil {
+			return n
+		}
+	}
+	return root
+}
+
+func findElement(n *html.Node, tag string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == tag {
+		return n
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if found := findElement(child, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func getContentHash(n *html.Node) string {
+	sum := sha256.Sum256([]byte(getNodeText(n)))
+	return hex.EncodeToString(sum[:])
+}
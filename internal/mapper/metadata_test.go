@@ -0,0 +1,103 @@
+package mapper
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+const metadataTestPage = `<!DOCTYPE html>
+<html lang="en-US">
+	<head>
+		<title> Foo  Home </title>
+		<meta name="description" content="The home of foo">
+		<meta name="keywords" content="foo, bar ,, baz">
+		<meta property="og:title" content="Foo">
+		<meta name="twitter:card" content="summary">
+		<style>body { color: red; }</style>
+	</head>
+	<body>
+		<h1>Welcome to foo</h1>
+		<nav>Home About</nav>
+		<main>
+			<h2>Latest <em>news</em></h2>
+			<p>Nothing happened today.</p>
+		</main>
+		<script>var hidden = "not counted";</script>
+	</body>
+</html>`
+
+func TestExtractMetadata(t *testing.T) {
+	root, err := html.Parse(strings.NewReader(metadataTestPage))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	md := extractMetadata(root)
+	if md.Title != "Foo Home" {
+		t.Errorf("Expected title to be %q, got %q", "Foo Home", md.Title)
+	}
+	if md.Description != "The home of foo" {
+		t.Errorf("Expected description to be %q, got %q", "The home of foo", md.Description)
+	}
+	if strings.Join(md.Keywords, "|") != "foo|bar|baz" {
+		t.Errorf("Expected keywords to be foo, bar and baz, got %v", md.Keywords)
+	}
+	if md.Language != "en-US" {
+		t.Errorf("Expected language to be %q, got %q", "en-US", md.Language)
+	}
+	if md.OpenGraph["title"] != "Foo" {
+		t.Errorf("Expected og:title to be %q, got %q", "Foo", md.OpenGraph["title"])
+	}
+	if md.Twitter["card"] != "summary" {
+		t.Errorf("Expected twitter:card to be %q, got %q", "summary", md.Twitter["card"])
+	}
+
+	if len(md.Headings) != 2 {
+		t.Fatalf("Expected 2 headings, got %d", len(md.Headings))
+	} else if md.Headings[0].Level != 1 || md.Headings[0].Text != "Welcome to foo" {
+		t.Errorf("Unexpected first heading %+v", md.Headings[0])
+	} else if md.Headings[1].Level != 2 || md.Headings[1].Text != "Latest news" {
+		t.Errorf("Unexpected second heading %+v", md.Headings[1])
+	}
+
+	if md.WordCount != 10 {
+		t.Errorf("Expected word count to be 10, got %d", md.WordCount)
+	}
+
+	mainNode := findElement(root, "main")
+	if md.ContentHash != getContentHash(mainNode) {
+		t.Errorf("Expected content hash of main element")
+	}
+}
+
+func TestGetNodeText(t *testing.T) {
+	root, err := html.Parse(strings.NewReader("<p>one\n\ttwo <script>three</script><b>four</b></p>"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	text := getNodeText(root)
+	if text != "one two four" {
+		t.Errorf("Expected text to be %q, got %q", "one two four", text)
+	}
+}
+
+func TestGetMainContentNode(t *testing.T) {
+	testMain := func(page, expectedTag string) {
+		root, err := html.Parse(strings.NewReader(page))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		n := getMainContentNode(root)
+		if n.Data != expectedTag {
+			t.Errorf("Expected main content to be %q, got %q", expectedTag, n.Data)
+		}
+	}
+
+	testMain("<main><article>a</article></main>", "main")
+	testMain("<div><article>a</article></div>", "article")
+	testMain("<div>a</div>", "body")
+}
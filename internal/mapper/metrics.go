@@ -0,0 +1,87 @@
+package mapper
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Metrics receive measurements of a crawl as it runs. Methods are called
+// concurrently from every worker, so must be safe for concurrent use.
+type Metrics interface {
+	// QueueChanged is called with +1 when a url is queued to be crawled,
+	// and with -1 when a worker takes it or the crawl stops first.
+	QueueChanged(delta int)
+
+	// WorkersChanged is called with +1 when a worker starts fetching a
+	// page, and with -1 once it has finished.
+	WorkersChanged(delta int)
+
+	// PageFetched is called for every page fetched and parsed, with the
+	// status code, the time taken and the size of the body.
+	PageFetched(status int, latency time.Duration, bytes int64)
+
+	// PageFailed is called for every page that could not be fetched or
+	// parsed, with the type of error returned by getErrorType.
+	PageFailed(errType string)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) QueueChanged(int)                      {}
+func (nopMetrics) WorkersChanged(int)                    {}
+func (nopMetrics) PageFetched(int, time.Duration, int64) {}
+func (nopMetrics) PageFailed(string)                     {}
+
+func getMetrics(opts *Options) Metrics {
+	if opts.Metrics == nil {
+		return nopMetrics{}
+	}
+	return opts.Metrics
+}
+
+// getErrorType classifies the error of a failed page as one of cancelled,
+// timeout, dns, connection_refused, connection_reset, tls or other.
+func getErrorType(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection_refused"
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.ErrUnexpectedEOF):
+		return "connection_reset"
+	case errors.As(err, &certErr), errors.As(err, &unknownAuthorityErr), errors.As(err, &hostnameErr):
+		return "tls"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	default:
+		return "other"
+	}
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
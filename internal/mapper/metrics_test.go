@@ -0,0 +1,103 @@
+package mapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type testMetrics struct {
+	m       sync.Mutex
+	queue   int
+	workers int
+	fetched []int
+	bytes   int64
+	failed  []string
+}
+
+func (tm *testMetrics) QueueChanged(delta int) {
+	tm.m.Lock()
+	defer tm.m.Unlock()
+	tm.queue += delta
+}
+
+func (tm *testMetrics) WorkersChanged(delta int) {
+	tm.m.Lock()
+	defer tm.m.Unlock()
+	tm.workers += delta
+}
+
+func (tm *testMetrics) PageFetched(status int, latency time.Duration, bytes int64) {
+	tm.m.Lock()
+	defer tm.m.Unlock()
+	tm.fetched = append(tm.fetched, status)
+	tm.bytes += bytes
+}
+
+func (tm *testMetrics) PageFailed(errType string) {
+	tm.m.Lock()
+	defer tm.m.Unlock()
+	tm.failed = append(tm.failed, errType)
+}
+
+func TestCreateWorkersMetrics(t *testing.T) {
+	u, err := url.Parse("http://127.0.0.1:0/")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tm := &testMetrics{queue: 1}
+	opts := DefaultOptions(1)
+	opts.Metrics = tm
+
+	urls := make(chan *QueuedURL, 1)
+	urls <- &QueuedURL{URL: u}
+	close(urls)
+
+	for range createWorkers(context.Background(), opts, urls) {
+	}
+
+	if tm.queue != 0 || tm.workers != 0 {
+		t.Errorf("Expected queue and workers to return to 0, got %d and %d", tm.queue, tm.workers)
+	} else if len(tm.fetched) != 0 || len(tm.failed) != 1 {
+		t.Errorf("Expected 1 failed page, got %v fetched and %v failed", tm.fetched, tm.failed)
+	}
+}
+
+func TestGetErrorType(t *testing.T) {
+	testGetErrorType := func(err error, expected string) {
+		errType := getErrorType(fmt.Errorf("wrapped: %w", err))
+		if errType != expected {
+			t.Errorf("Expected error %v to have type %q, got %q", err, expected, errType)
+		}
+	}
+
+	testGetErrorType(context.Canceled, "cancelled")
+	testGetErrorType(context.DeadlineExceeded, "timeout")
+	testGetErrorType(&net.DNSError{Err: "no such host", Name: "foo.com"}, "dns")
+	testGetErrorType(&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, "connection_refused")
+	testGetErrorType(syscall.ECONNRESET, "connection_reset")
+	testGetErrorType(io.ErrUnexpectedEOF, "connection_reset")
+	testGetErrorType(errors.New("bad html"), "other")
+}
+
+func TestCountingReader(t *testing.T) {
+	cr := &countingReader{r: strings.NewReader("<html></html>")}
+	_, err := ioutil.ReadAll(cr)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if cr.n != 13 {
+		t.Errorf("Expected 13 bytes to be counted, got %d", cr.n)
+	}
+}
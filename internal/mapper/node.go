@@ -15,6 +15,7 @@ const (
 	embedNode
 	objectNode
 	imageNode
+	videoNode
 	anchorNode
 	scriptNode
 	stylesheetNode
@@ -36,6 +37,8 @@ func getNodeType(n *html.Node) nodeType {
 		return objectNode
 	case "img":
 		return imageNode
+	case "video":
+		return videoNode
 	case "a":
 		return anchorNode
 	case "script":
@@ -50,6 +53,21 @@ func getNodeType(n *html.Node) nodeType {
 	return unknownNode
 }
 
+// getAssetKind returns the kind of asset loaded by n, such as "image" or
+// "script".
+func getAssetKind(n *html.Node) string {
+	switch getNodeType(n) {
+	case imageNode:
+		return "image"
+	case stylesheetNode:
+		return "stylesheet"
+	case icoNode:
+		return "icon"
+	default:
+		return n.Data
+	}
+}
+
 func isStylesheetNode(n *html.Node) bool {
 	relVal, err := getNodeAttrValue(n, "rel")
 	if err != nil {
@@ -74,3 +92,44 @@ func getNodeAttrValue(n *html.Node, key string) (string, error) {
 	}
 	return "", errNodeAttrNotFound
 }
+
+func hasNodeAttr(n *html.Node, key string) bool {
+	_, err := getNodeAttrValue(n, key)
+	return err == nil
+}
+
+func getNodeAttrValues(n *html.Node, keys []string) ([]string, error) {
+	var vals []string
+	for _, key := range keys {
+		val, err := getNodeAttrValue(n, key)
+		if err != nil {
+			continue
+		}
+
+		if isSrcsetAttr(key) {
+			vals = append(vals, parseSrcset(val)...)
+		} else {
+			vals = append(vals, val)
+		}
+	}
+
+	if len(vals) == 0 {
+		return nil, errNodeAttrNotFound
+	}
+	return vals, nil
+}
+
+func isSrcsetAttr(key string) bool {
+	return strings.HasSuffix(strings.ToLower(key), "srcset")
+}
+
+func parseSrcset(val string) []string {
+	var urls []string
+	for _, candidate := range strings.Split(val, ",") {
+		fields := strings.Fields(candidate)
+		if len(fields) > 0 {
+			urls = append(urls, fields[0])
+		}
+	}
+	return urls
+}
@@ -20,6 +20,7 @@ func TestGetNodeType(t *testing.T) {
 	testType("embed", []html.Attribute{}, embedNode)
 	testType("object", []html.Attribute{}, objectNode)
 	testType("img", []html.Attribute{}, imageNode)
+	testType("video", []html.Attribute{}, videoNode)
 	testType("a", []html.Attribute{}, anchorNode)
 	testType("script", []html.Attribute{}, scriptNode)
 	testType("link", []html.Attribute{
@@ -81,3 +82,51 @@ func TestGetNodeAttrValue(t *testing.T) {
 		t.Errorf("Expected error: %v", errNodeAttrNotFound)
 	}
 }
+
+func TestGetNodeAttrValues(t *testing.T) {
+	var n html.Node
+	n.Attr = []html.Attribute{
+		html.Attribute{Key: "src", Val: "placeholder.gif"},
+		html.Attribute{Key: "data-src", Val: "image.png"},
+		html.Attribute{Key: "data-srcset", Val: "small.png 480w, large.png 1080w"},
+	}
+
+	vals, err := getNodeAttrValues(&n, []string{"src", "data-src", "data-srcset", "data-original"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	expected := []string{"placeholder.gif", "image.png", "small.png", "large.png"}
+	if len(vals) != len(expected) {
+		t.Fatalf("Expected %d values, got %d", len(expected), len(vals))
+	}
+	for i, val := range vals {
+		if val != expected[i] {
+			t.Errorf("Expected %s, got %s", expected[i], val)
+		}
+	}
+
+	_, err = getNodeAttrValues(&n, []string{"bad-key"})
+	if err != errNodeAttrNotFound {
+		t.Errorf("Expected error: %v", errNodeAttrNotFound)
+	}
+}
+
+func TestParseSrcset(t *testing.T) {
+	testSrcset := func(srcset string, expected []string) {
+		urls := parseSrcset(srcset)
+		if len(urls) != len(expected) {
+			t.Fatalf("Expected %d urls for %q, got %d", len(expected), srcset, len(urls))
+		}
+		for i, u := range urls {
+			if u != expected[i] {
+				t.Errorf("Expected %s, got %s", expected[i], u)
+			}
+		}
+	}
+
+	testSrcset("", nil)
+	testSrcset("image.png", []string{"image.png"})
+	testSrcset("image-1x.png 1x, image-2x.png 2x", []string{"image-1x.png", "image-2x.png"})
+	testSrcset(" small.png 480w ,large.png 1080w, ", []string{"small.png", "large.png"})
+}
@@ -0,0 +1,132 @@
+package mapper
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// DefaultLazyAssetAttrs are the attributes used by common lazy-loading
+// libraries to hold asset URLs until the asset scrolls into view.
+var DefaultLazyAssetAttrs = []string{
+	"data-src",
+	"data-srcset",
+	"data-lazy-src",
+	"data-original",
+}
+
+// Options configure how site maps and page maps are created.
+type Options struct {
+	// NumWorkers is the number of workers used to crawl the domain.
+	NumWorkers int
+
+	// Seeds are additional urls to start crawling from, alongside the url
+	// the site map is created for. A page is in scope if it is in the scope
+	// of any of these urls.
+	Seeds []*url.URL
+
+	// Scope determines which pages are crawled relative to the seeds. The
+	// zero value is ScopeHost.
+	Scope Scope
+
+	// MaxPages and MaxDepth limit the number of pages crawled and the
+	// number of links followed from a seed to reach a page. Zero means no
+	// limit.
+	MaxPages int
+	MaxDepth int
+
+	// Include and Exclude filter the pages that are crawled by url. If
+	// Include is not empty, a page must match one of its expressions. A
+	// page matching any Exclude expression is never crawled.
+	Include []*regexp.Regexp
+	Exclude []*regexp.Regexp
+
+	// Headers are added to every request made for a page.
+	Headers http.Header
+
+	// Client is used to request pages. If nil, http.DefaultClient is used.
+	Client *http.Client
+
+	// RequestsPerSecond limits the rate at which pages are requested across
+	// all workers. Zero means no limit.
+	RequestsPerSecond float64
+
+	// LazyAssetAttrs are checked for asset URLs on img, iframe, source and
+	// video nodes, in addition to the standard src and srcset attributes.
+	// Attributes ending in "srcset" are parsed as a srcset candidate list.
+	LazyAssetAttrs []string
+
+	// CheckFragments records the fragment of every link and the anchors of
+	// every page, so that links to missing anchors can be reported.
+	CheckFragments bool
+
+	// OnPageMap, if set, is called with each page map as soon as its page
+	// has been processed. Calls are never made concurrently.
+	OnPageMap func(*PageMap)
+
+	// OnEvent, if set, is called with every event describing the progress
+	// of the crawl. Calls are never made concurrently, but block the crawl
+	// until they return.
+	OnEvent func(*Event)
+
+	// Metrics, if set, receive measurements of the crawl as it runs.
+	Metrics Metrics
+
+	// Previous, if set, is the site map of an earlier crawl. Pages in it are
+	// requested with If-None-Match and If-Modified-Since, and the Change of
+	// every page map is set.
+	Previous *SiteMap
+
+	// OnCheckpoint, if set, is called with the state of the crawl as pages
+	// are processed, at most once every CheckpointInterval, and again if the
+	// crawl stops early. Calls are never made concurrently, but block the
+	// crawl until they return.
+	OnCheckpoint       func(*Checkpoint)
+	CheckpointInterval time.Duration
+
+	// Resume, if set, continues a crawl from a checkpoint. Its pages are not
+	// fetched again.
+	Resume *Checkpoint
+
+	// Frontier, if set, records the pages queued and visited by the crawl,
+	// which are otherwise kept in memory. It must be empty when the crawl
+	// starts.
+	Frontier Frontier
+
+	// DiscardPageMaps leaves page maps out of the site map once they have
+	// been passed to OnPageMap, so that memory does not grow with the size
+	// of the site. Broken fragments are still reported if fragments are
+	// checked. Checkpoints cannot be used when discarding page maps.
+	DiscardPageMaps bool
+
+	// previous indexes the page maps of Previous by url, once a crawl has
+	// started.
+	previous map[string]*PageMap
+}
+
+// previousPageMap returns the page map for u in the previous site map, if
+// any.
+func (opts *Options) previousPageMap(u *url.URL) *PageMap {
+	if opts.previous != nil {
+		return opts.previous[u.String()]
+	} else if opts.Previous == nil {
+		return nil
+	}
+
+	for _, pm := range opts.Previous.PageMaps {
+		if pm.URL.String() == u.String() {
+			return pm
+		}
+	}
+	return nil
+}
+
+// DefaultOptions returns the options used by CreateSiteMap and
+// CreatePageMap.
+func DefaultOptions(numWorkers int) *Options {
+	return &Options{
+		NumWorkers:     numWorkers,
+		LazyAssetAttrs: DefaultLazyAssetAttrs,
+	}
+}
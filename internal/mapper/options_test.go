@@ -0,0 +1,14 @@
+package mapper
+
+import "testing"
+
+func TestDefaultOptions(t *testing.T) {
+	opts := DefaultOptions(4)
+	if opts.NumWorkers != 4 {
+		t.Errorf("Expected num workers to be 4, got %d", opts.NumWorkers)
+	}
+
+	if len(opts.LazyAssetAttrs) != len(DefaultLazyAssetAttrs) {
+		t.Errorf("Expected %d lazy asset attrs, got %d", len(DefaultLazyAssetAttrs), len(opts.LazyAssetAttrs))
+	}
+}
@@ -1,20 +1,63 @@
 package mapper
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
 	"golang.org/x/net/html"
 )
 
-// A PageMap contains all of the links and assets at URL.
+// A PageMap contains all of the links and assets at URL, along with the
+// metadata describing the page. FragmentLinks and AnchorIDs are only
+// recorded when fragment checking is enabled. ETag and LastModified are the
+// validators sent with the page, and Change is only set when re-crawling from
+// a previous site map. LinkText and AssetKinds map the url of a link to the
+// text of its first anchor, and the url of an asset to the kind of element
+// that loads it. RedirectURL is the url the page was finally fetched from,
+// when requesting URL was redirected.
 type PageMap struct {
-	URL    *url.URL
-	Links  []*url.URL
-	Assets []*url.URL
+	URL           *url.URL
+	StatusCode    int
+	Latency       time.Duration
+	Depth         int
+	Links         []*url.URL
+	Assets        []*url.URL
+	Metadata      *PageMetadata
+	FragmentLinks []*url.URL
+	AnchorIDs     []string
+	SchemeLinks   []*SchemeLink
+	Structured    *StructuredData
+	ETag          string
+	LastModified  string
+	Change        PageChange
+	ContentType   string
+	Size          int64
+	LinkText      map[string]string
+	AssetKinds    map[string]string
+	RedirectURL   *url.URL
 }
 
+// A PageChange describes how a page changed since a previous crawl.
+type PageChange string
+
+// The changes of a page since a previous crawl.
+const (
+	// PageUnchanged pages were not modified, so their previous links and
+	// assets were reused.
+	PageUnchanged PageChange = "unchanged"
+
+	// PageChanged pages were fetched and parsed again, as they were either
+	// modified or sent without validators.
+	PageChanged PageChange = "changed"
+
+	// PageNew pages were not found by the previous crawl.
+	PageNew PageChange = "new"
+)
+
 func (pm *PageMap) MarshalJSON() ([]byte, error) {
 	urlsToStrings := func(urls []*url.URL) []string {
 		strs := make([]string, 0, len(urls))
@@ -23,59 +66,286 @@ func (pm *PageMap) MarshalJSON() ([]byte, error) {
 		}
 		return strs
 	}
+	var redirectURL string
+	if pm.RedirectURL != nil {
+		redirectURL = pm.RedirectURL.String()
+	}
 
 	return json.Marshal(struct {
-		URL    string   `json:"url"`
-		Links  []string `json:"links"`
-		Assets []string `json:"assets"`
+		URL           string            `json:"url"`
+		Status        int               `json:"status"`
+		LatencyMs     int64             `json:"latencyMs"`
+		Depth         int               `json:"depth"`
+		Links         []string          `json:"links"`
+		Assets        []string          `json:"assets"`
+		Metadata      *PageMetadata     `json:"metadata,omitempty"`
+		FragmentLinks []string          `json:"fragmentLinks,omitempty"`
+		AnchorIDs     []string          `json:"anchorIds,omitempty"`
+		SchemeLinks   []*SchemeLink     `json:"schemeLinks,omitempty"`
+		Structured    *StructuredData   `json:"structuredData,omitempty"`
+		ETag          string            `json:"etag,omitempty"`
+		LastModified  string            `json:"lastModified,omitempty"`
+		Change        PageChange        `json:"change,omitempty"`
+		ContentType   string            `json:"contentType,omitempty"`
+		Size          int64             `json:"size,omitempty"`
+		LinkText      map[string]string `json:"linkText,omitempty"`
+		AssetKinds    map[string]string `json:"assetKinds,omitempty"`
+		RedirectURL   string            `json:"redirectUrl,omitempty"`
 	}{
-		URL:    pm.URL.String(),
-		Links:  urlsToStrings(pm.Links),
-		Assets: urlsToStrings(pm.Assets),
+		URL:           pm.URL.String(),
+		Status:        pm.StatusCode,
+		LatencyMs:     int64(pm.Latency / time.Millisecond),
+		Depth:         pm.Depth,
+		Links:         urlsToStrings(pm.Links),
+		Assets:        urlsToStrings(pm.Assets),
+		Metadata:      pm.Metadata,
+		FragmentLinks: urlsToStrings(pm.FragmentLinks),
+		AnchorIDs:     pm.AnchorIDs,
+		SchemeLinks:   pm.SchemeLinks,
+		Structured:    pm.Structured,
+		ETag:          pm.ETag,
+		LastModified:  pm.LastModified,
+		Change:        pm.Change,
+		ContentType:   pm.ContentType,
+		Size:          pm.Size,
+		LinkText:      pm.LinkText,
+		AssetKinds:    pm.AssetKinds,
+		RedirectURL:   redirectURL,
 	})
 }
 
+func (pm *PageMap) UnmarshalJSON(b []byte) error {
+	var v struct {
+		URL           string            `json:"url"`
+		Status        int               `json:"status"`
+		LatencyMs     int64             `json:"latencyMs"`
+		Depth         int               `json:"depth"`
+		Links         []string          `json:"links"`
+		Assets        []string          `json:"assets"`
+		Metadata      *PageMetadata     `json:"metadata"`
+		FragmentLinks []string          `json:"fragmentLinks"`
+		AnchorIDs     []string          `json:"anchorIds"`
+		SchemeLinks   []*SchemeLink     `json:"schemeLinks"`
+		Structured    *StructuredData   `json:"structuredData"`
+		ETag          string            `json:"etag"`
+		LastModified  string            `json:"lastModified"`
+		Change        PageChange        `json:"change"`
+		ContentType   string            `json:"contentType"`
+		Size          int64             `json:"size"`
+		LinkText      map[string]string `json:"linkText"`
+		AssetKinds    map[string]string `json:"assetKinds"`
+		RedirectURL   string            `json:"redirectUrl"`
+	}
+	err := json.Unmarshal(b, &v)
+	if err != nil {
+		return err
+	}
+
+	u, err := url.Parse(v.URL)
+	if err != nil {
+		return err
+	}
+	links, err := parseURLs(v.Links)
+	if err != nil {
+		return err
+	}
+	assets, err := parseURLs(v.Assets)
+	if err != nil {
+		return err
+	}
+	fragmentLinks, err := parseURLs(v.FragmentLinks)
+	if err != nil {
+		return err
+	}
+	var redirectURL *url.URL
+	if v.RedirectURL != "" {
+		redirectURL, err = url.Parse(v.RedirectURL)
+		if err != nil {
+			return err
+		}
+	}
+
+	*pm = PageMap{
+		URL:           u,
+		StatusCode:    v.Status,
+		Latency:       time.Duration(v.LatencyMs) * time.Millisecond,
+		Depth:         v.Depth,
+		Links:         links,
+		Assets:        assets,
+		Metadata:      v.Metadata,
+		FragmentLinks: fragmentLinks,
+		AnchorIDs:     v.AnchorIDs,
+		SchemeLinks:   v.SchemeLinks,
+		Structured:    v.Structured,
+		ETag:          v.ETag,
+		LastModified:  v.LastModified,
+		Change:        v.Change,
+		ContentType:   v.ContentType,
+		Size:          v.Size,
+		LinkText:      v.LinkText,
+		AssetKinds:    v.AssetKinds,
+		RedirectURL:   redirectURL,
+	}
+	return nil
+}
+
+func parseURLs(strs []string) ([]*url.URL, error) {
+	urls := make([]*url.URL, 0, len(strs))
+	for _, s := range strs {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, u)
+	}
+	return urls, nil
+}
+
 // CreatePageMap creates a page map for the specified url. This is done by
-// parsing the HTML for all links and assets found in the DOM tree.
+// parsing the HTML for all links, assets and metadata found in the DOM tree.
 func CreatePageMap(u *url.URL) (*PageMap, error) {
-	resp, err := http.Get(u.String())
+	return CreatePageMapWithOptions(context.Background(), u, DefaultOptions(1))
+}
+
+// CreatePageMapWithOptions creates a page map for the specified url, parsing
+// the page as configured by opts. If opts has a previous site map containing
+// the page, the page is requested conditionally, and its previous links and
+// assets are reused if it has not been modified.
+func CreatePageMapWithOptions(ctx context.Context, u *url.URL, opts *Options) (*PageMap, error) {
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, vals := range opts.Headers {
+		for _, val := range vals {
+			req.Header.Add(key, val)
+		}
+	}
+
+	prev := opts.previousPageMap(u)
+	if prev != nil && prev.ETag != "" {
+		req.Header.Set("If-None-Match", prev.ETag)
+	}
+	if prev != nil && prev.LastModified != "" {
+		req.Header.Set("If-Modified-Since", prev.LastModified)
+	}
+
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	root, err := html.Parse(resp.Body)
+	if prev != nil && resp.StatusCode == http.StatusNotModified {
+		return reusePageMap(prev, u, resp, time.Since(start)), nil
+	}
+
+	body := &countingReader{r: resp.Body}
+	root, err := html.Parse(body)
 	if err != nil {
 		return nil, err
 	}
 
-	pm := &PageMap{URL: u}
-	processNode(pm, root)
+	pm := &PageMap{
+		URL:        u,
+		StatusCode: resp.StatusCode,
+		Latency:    time.Since(start),
+		Metadata:   extractMetadata(root),
+	}
+	pm.ContentType = resp.Header.Get("Content-Type")
+	pm.Size = body.n
+	setValidators(pm, resp)
+	setRedirectURL(pm, resp)
+	if prev != nil {
+		pm.Change = PageChanged
+	} else if opts.Previous != nil {
+		pm.Change = PageNew
+	}
+	processNode(pm, root, opts)
+	extractStructuredData(pm, root, opts)
 	pm.Links = getUniqueURLs(pm.Links)
 	pm.Assets = getUniqueURLs(pm.Assets)
+	pm.FragmentLinks = getUniqueURLs(pm.FragmentLinks)
+	pm.AnchorIDs = getUniqueStrings(pm.AnchorIDs)
+	pm.SchemeLinks = getUniqueSchemeLinks(pm.SchemeLinks)
 	return pm, nil
 }
 
-func processNode(pm *PageMap, n *html.Node) error {
+// reusePageMap returns the page map of a page that has not been modified
+// since prev was created.
+func reusePageMap(prev *PageMap, u *url.URL, resp *http.Response, latency time.Duration) *PageMap {
+	pm := &PageMap{
+		URL:           u,
+		StatusCode:    prev.StatusCode,
+		Latency:       latency,
+		Links:         prev.Links,
+		Assets:        prev.Assets,
+		Metadata:      prev.Metadata,
+		FragmentLinks: prev.FragmentLinks,
+		AnchorIDs:     prev.AnchorIDs,
+		SchemeLinks:   prev.SchemeLinks,
+		Structured:    prev.Structured,
+		ETag:          prev.ETag,
+		LastModified:  prev.LastModified,
+		Change:        PageUnchanged,
+		ContentType:   prev.ContentType,
+		Size:          prev.Size,
+		LinkText:      prev.LinkText,
+		AssetKinds:    prev.AssetKinds,
+	}
+	setValidators(pm, resp)
+	setRedirectURL(pm, resp)
+	return pm
+}
+
+func setValidators(pm *PageMap, resp *http.Response) {
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		pm.ETag = etag
+	}
+	if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+		pm.LastModified = lastModified
+	}
+}
+
+// setRedirectURL records the url pm was fetched from if the request for it
+// was redirected.
+func setRedirectURL(pm *PageMap, resp *http.Response) {
+	if resp.Request != nil && resp.Request.URL.String() != pm.URL.String() {
+		pm.RedirectURL = resp.Request.URL
+	}
+}
+
+func processNode(pm *PageMap, n *html.Node, opts *Options) error {
 	if n.Type == html.ElementNode {
-		err := addLinkURL(pm, n)
+		if opts.CheckFragments {
+			addAnchorIDs(pm, n)
+		}
+
+		err := addLinkURL(pm, n, opts)
 		if err != nil {
 			return err
 		}
 
-		err = addAssetURL(pm, n)
+		err = addAssetURL(pm, n, opts)
 		if err != nil {
 			return err
 		}
 	}
 
 	for child := n.FirstChild; child != nil; child = child.NextSibling {
-		processNode(pm, child)
+		processNode(pm, child, opts)
 	}
 	return nil
 }
 
-func addLinkURL(pm *PageMap, n *html.Node) error {
+func addLinkURL(pm *PageMap, n *html.Node, opts *Options) error {
 	if getNodeType(n) != anchorNode {
 		return nil
 	}
@@ -85,10 +355,35 @@ func addLinkURL(pm *PageMap, n *html.Node) error {
 		return err
 	}
 
+	numLinks := len(pm.Links)
+	err = addLink(pm, link, opts)
+	if err != nil || len(pm.Links) == numLinks {
+		return err
+	}
+
+	text := getNodeText(n)
+	linkStr := pm.Links[numLinks].String()
+	if _, ok := pm.LinkText[linkStr]; text != "" && !ok {
+		if pm.LinkText == nil {
+			pm.LinkText = make(map[string]string)
+		}
+		pm.LinkText[linkStr] = text
+	}
+	return nil
+}
+
+func addLink(pm *PageMap, link string, opts *Options) error {
+	link = strings.TrimSpace(link)
+	if scheme := getLinkScheme(link); !isHTTPScheme(scheme) {
+		addSchemeLink(pm, scheme, link)
+		return nil
+	}
+
 	linkURL, err := url.Parse(link)
 	if err != nil {
 		return err
 	}
+	fragment := linkURL.Fragment
 
 	linkURL, err = getHashlessURL(linkURL)
 	if err != nil {
@@ -105,19 +400,25 @@ func addLinkURL(pm *PageMap, n *html.Node) error {
 	}
 
 	pm.Links = append(pm.Links, linkURL)
+	if opts.CheckFragments {
+		addFragmentLink(pm, linkURL, fragment)
+	}
 	return nil
 }
 
-func addAssetURL(pm *PageMap, n *html.Node) error {
-	var asset string
+func addAssetURL(pm *PageMap, n *html.Node, opts *Options) error {
+	var assets []string
 	var err error
 	switch getNodeType(n) {
-	case scriptNode, iframeNode, sourceNode, embedNode, imageNode:
-		asset, err = getNodeAttrValue(n, "src")
+	case iframeNode, sourceNode, imageNode, videoNode:
+		keys := append([]string{"src", "srcset"}, opts.LazyAssetAttrs...)
+		assets, err = getNodeAttrValues(n, keys)
+	case scriptNode, embedNode:
+		assets, err = getNodeAttrValues(n, []string{"src"})
 	case stylesheetNode, icoNode:
-		asset, err = getNodeAttrValue(n, "href")
+		assets, err = getNodeAttrValues(n, []string{"href"})
 	case objectNode:
-		asset, err = getNodeAttrValue(n, "data")
+		assets, err = getNodeAttrValues(n, []string{"data"})
 	default:
 		return nil
 	}
@@ -126,7 +427,27 @@ func addAssetURL(pm *PageMap, n *html.Node) error {
 		return err
 	}
 
-	assetURL, err := url.Parse(asset)
+	kind := getAssetKind(n)
+	for _, asset := range assets {
+		numAssets := len(pm.Assets)
+		err = addAsset(pm, asset)
+		if err != nil {
+			return err
+		}
+
+		assetStr := pm.Assets[numAssets].String()
+		if _, ok := pm.AssetKinds[assetStr]; !ok {
+			if pm.AssetKinds == nil {
+				pm.AssetKinds = make(map[string]string)
+			}
+			pm.AssetKinds[assetStr] = kind
+		}
+	}
+	return nil
+}
+
+func addAsset(pm *PageMap, asset string) error {
+	assetURL, err := url.Parse(strings.TrimSpace(asset))
 	if err != nil {
 		return err
 	}
@@ -1,9 +1,15 @@
 package mapper
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"golang.org/x/net/html"
 )
@@ -54,7 +60,7 @@ func TestProcessNode(t *testing.T) {
 	}
 
 	pm := PageMap{URL: u}
-	err = processNode(&pm, &root)
+	err = processNode(&pm, &root, DefaultOptions(1))
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -98,7 +104,7 @@ func TestAddLinkURL(t *testing.T) {
 	}
 
 	pm := PageMap{URL: u}
-	err = addLinkURL(&pm, &n)
+	err = addLinkURL(&pm, &n, DefaultOptions(1))
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -132,7 +138,7 @@ func TestAddAssetURL(t *testing.T) {
 	}
 
 	pm := PageMap{URL: u}
-	err = addAssetURL(&pm, &n)
+	err = addAssetURL(&pm, &n, DefaultOptions(1))
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -148,3 +154,149 @@ func TestAddAssetURL(t *testing.T) {
 		t.Errorf("Exepected asset url to be %q, got %q", expectedAssetStr, pm.Assets[0].String())
 	}
 }
+
+func TestAddAssetURLLazy(t *testing.T) {
+	u, err := url.Parse("https://foo.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	n := html.Node{
+		Type: html.ElementNode,
+		Data: "img",
+		Attr: []html.Attribute{
+			html.Attribute{Key: "data-src", Val: "image.png"},
+			html.Attribute{Key: "data-srcset", Val: "image-1x.png 1x, image-2x.png 2x"},
+		},
+	}
+
+	pm := PageMap{URL: u}
+	err = addAssetURL(&pm, &n, DefaultOptions(1))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"https://foo.com/image.png",
+		"https://foo.com/image-1x.png",
+		"https://foo.com/image-2x.png",
+	}
+	if len(pm.Assets) != len(expected) {
+		t.Fatalf("Expected number assets to be %d, got %d", len(expected), len(pm.Assets))
+	}
+
+	for i, assetStr := range expected {
+		if pm.Assets[i].String() != assetStr {
+			t.Errorf("Expected asset url to be %q, got %q", assetStr, pm.Assets[i].String())
+		}
+	}
+
+	pm = PageMap{URL: u}
+	err = addAssetURL(&pm, &n, &Options{})
+	if err != errNodeAttrNotFound {
+		t.Errorf("Expected error: %v", errNodeAttrNotFound)
+	}
+}
+
+func TestProcessNodeLinkTextAndAssetKinds(t *testing.T) {
+	u, err := url.Parse("https://foo.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	root, err := html.Parse(strings.NewReader(`<a href="/about"> About
+		<b>us</b></a><a href="/about">Again</a><a href="/blank"></a>` +
+		`<img src="/logo.png"><link rel="stylesheet" href="/site.css"><script src="/app.js"></script>`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	pm := PageMap{URL: u}
+	processNode(&pm, root, DefaultOptions(1))
+
+	expectedText := map[string]string{"https://foo.com/about": "About us"}
+	if !reflect.DeepEqual(pm.LinkText, expectedText) {
+		t.Errorf("Expected link text %v, got %v", expectedText, pm.LinkText)
+	}
+
+	expectedKinds := map[string]string{
+		"https://foo.com/logo.png": "image",
+		"https://foo.com/site.css": "stylesheet",
+		"https://foo.com/app.js":   "script",
+	}
+	if !reflect.DeepEqual(pm.AssetKinds, expectedKinds) {
+		t.Errorf("Expected asset kinds %v, got %v", expectedKinds, pm.AssetKinds)
+	}
+}
+
+func TestPageMapJSON(t *testing.T) {
+	b := []byte(`{"url":"https://foo.com/docs","status":200,"latencyMs":42,"depth":1,` +
+		`"links":["https://foo.com/docs/api"],"assets":["https://foo.com/logo.png"],` +
+		`"fragmentLinks":["https://foo.com/docs#top"],"anchorIds":["top"],` +
+		`"etag":"\"v1\"","change":"unchanged","redirectUrl":"https://foo.com/docs/"}`)
+
+	var pm PageMap
+	err := json.Unmarshal(b, &pm)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if pm.URL.String() != "https://foo.com/docs" {
+		t.Errorf("Expected url to be %q, got %q", "https://foo.com/docs", pm.URL)
+	} else if pm.StatusCode != 200 || pm.Depth != 1 {
+		t.Errorf("Unexpected status %d or depth %d", pm.StatusCode, pm.Depth)
+	} else if pm.Latency != 42*time.Millisecond {
+		t.Errorf("Expected latency to be 42ms, got %v", pm.Latency)
+	} else if len(pm.Links) != 1 || pm.Links[0].String() != "https://foo.com/docs/api" {
+		t.Errorf("Unexpected links %v", pm.Links)
+	} else if pm.ETag != `"v1"` || pm.Change != PageUnchanged {
+		t.Errorf("Unexpected etag %q or change %q", pm.ETag, pm.Change)
+	} else if pm.RedirectURL == nil || pm.RedirectURL.String() != "https://foo.com/docs/" {
+		t.Errorf("Unexpected redirect url %v", pm.RedirectURL)
+	} else if len(pm.Assets) != 1 || len(pm.FragmentLinks) != 1 || len(pm.AnchorIDs) != 1 {
+		t.Errorf("Unexpected page map %+v", pm)
+	}
+
+	out, err := json.Marshal(&pm)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if string(out) != string(b) {
+		t.Errorf("Expected %s, got %s", b, out)
+	}
+
+	err = json.Unmarshal([]byte(`{"url":"%zz"}`), &pm)
+	if err == nil {
+		t.Errorf("Expected error for malformed url")
+	}
+}
+
+func TestCreatePageMapRedirect(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+			return
+		}
+		w.Write([]byte(`<html></html>`))
+	}))
+	defer ts.Close()
+
+	for path, expected := range map[string]string{"/old": ts.URL + "/new", "/new": ""} {
+		u, err := url.Parse(ts.URL + path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		pm, err := CreatePageMap(u)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		var redirectURL string
+		if pm.RedirectURL != nil {
+			redirectURL = pm.RedirectURL.String()
+		}
+		if redirectURL != expected {
+			t.Errorf("Expected redirect url of %s to be %q, got %q", path, expected, redirectURL)
+		}
+	}
+}
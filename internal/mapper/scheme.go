@@ -0,0 +1,147 @@
+package mapper
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// A SchemeLink is a link using a scheme other than http or https, such as
+// mailto, tel, sms or javascript. Href is kept exactly as written since these
+// links are frequently not valid URLs.
+type SchemeLink struct {
+	Scheme string `json:"scheme"`
+	Href   string `json:"href"`
+}
+
+// A SchemeLinkReport lists the email addresses and phone numbers exposed by
+// a site, along with its javascript pseudo-links.
+type SchemeLinkReport struct {
+	Emails          []*ExposedValue `json:"emails"`
+	Phones          []*ExposedValue `json:"phones"`
+	JavaScriptLinks []*ExposedValue `json:"javascriptLinks"`
+}
+
+// An ExposedValue is a value found in scheme links on Pages.
+type ExposedValue struct {
+	Value string   `json:"value"`
+	Pages []string `json:"pages"`
+}
+
+// CreateSchemeLinkReport collects the email addresses, phone numbers and
+// javascript pseudo-links from every page of the site map.
+func CreateSchemeLinkReport(sm *SiteMap) *SchemeLinkReport {
+	emails := make(map[string][]string)
+	phones := make(map[string][]string)
+	scripts := make(map[string][]string)
+
+	for _, pm := range sm.PageMaps {
+		page := pm.URL.String()
+		for _, sl := range pm.SchemeLinks {
+			switch sl.Scheme {
+			case "mailto":
+				for _, email := range getEmailAddresses(sl.Href) {
+					emails[email] = append(emails[email], page)
+				}
+			case "tel", "sms":
+				if phone := getPhoneNumber(sl.Href); phone != "" {
+					phones[phone] = append(phones[phone], page)
+				}
+			case "javascript":
+				scripts[sl.Href] = append(scripts[sl.Href], page)
+			}
+		}
+	}
+
+	return &SchemeLinkReport{
+		Emails:          getExposedValues(emails),
+		Phones:          getExposedValues(phones),
+		JavaScriptLinks: getExposedValues(scripts),
+	}
+}
+
+// getLinkScheme returns the lowercase scheme of href, or an empty string if
+// href is relative.
+func getLinkScheme(href string) string {
+	colonIndex := strings.Index(href, ":")
+	if colonIndex < 1 {
+		return ""
+	}
+
+	scheme := href[:colonIndex]
+	for i, r := range scheme {
+		isAlpha := ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z')
+		isSchemeChar := ('0' <= r && r <= '9') || r == '+' || r == '-' || r == '.'
+		if !isAlpha && (i == 0 || !isSchemeChar) {
+			return ""
+		}
+	}
+	return strings.ToLower(scheme)
+}
+
+func isHTTPScheme(scheme string) bool {
+	return scheme == "" || scheme == "http" || scheme == "https"
+}
+
+func addSchemeLink(pm *PageMap, scheme, href string) {
+	pm.SchemeLinks = append(pm.SchemeLinks, &SchemeLink{
+		Scheme: scheme,
+		Href:   href,
+	})
+}
+
+func getUniqueSchemeLinks(sls []*SchemeLink) []*SchemeLink {
+	var unique []*SchemeLink
+	seen := make(map[string]bool)
+	for _, sl := range sls {
+		if !seen[sl.Href] {
+			seen[sl.Href] = true
+			unique = append(unique, sl)
+		}
+	}
+	return unique
+}
+
+func getEmailAddresses(href string) []string {
+	addrs := href[strings.Index(href, ":")+1:]
+	if queryIndex := strings.Index(addrs, "?"); queryIndex >= 0 {
+		addrs = addrs[:queryIndex]
+	}
+
+	var emails []string
+	for _, addr := range strings.Split(addrs, ",") {
+		if unescaped, err := url.PathUnescape(addr); err == nil {
+			addr = unescaped
+		}
+		if addr = strings.ToLower(strings.TrimSpace(addr)); addr != "" {
+			emails = append(emails, addr)
+		}
+	}
+	return emails
+}
+
+func getPhoneNumber(href string) string {
+	number := href[strings.Index(href, ":")+1:]
+	if paramIndex := strings.IndexAny(number, ";?"); paramIndex >= 0 {
+		number = number[:paramIndex]
+	}
+	if unescaped, err := url.PathUnescape(number); err == nil {
+		number = unescaped
+	}
+	return strings.TrimSpace(number)
+}
+
+func getExposedValues(pages map[string][]string) []*ExposedValue {
+	values := make([]*ExposedValue, 0, len(pages))
+	for value, valuePages := range pages {
+		values = append(values, &ExposedValue{
+			Value: value,
+			Pages: getUniqueStrings(valuePages),
+		})
+	}
+
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].Value < values[j].Value
+	})
+	return values
+}
@@ -0,0 +1,118 @@
+package mapper
+
+import (
+	"net/url"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestGetLinkScheme(t *testing.T) {
+	testScheme := func(href, expected string) {
+		scheme := getLinkScheme(href)
+		if scheme != expected {
+			t.Errorf("Expected scheme of %q to be %q, got %q", href, expected, scheme)
+		}
+	}
+
+	testScheme("https://foo.com", "https")
+	testScheme("HTTP://foo.com", "http")
+	testScheme("mailto:foo@bar.com", "mailto")
+	testScheme("tel:+1-555-0100", "tel")
+	testScheme("javascript:void(0)", "javascript")
+	testScheme("web+foo:bar", "web+foo")
+
+	testScheme("", "")
+	testScheme("path/to/site", "")
+	testScheme("//foo.com", "")
+	testScheme("/path:with:colons", "")
+	testScheme(":foo", "")
+	testScheme("1abc:foo", "")
+}
+
+func TestAddLinkURLScheme(t *testing.T) {
+	u, err := url.Parse("https://foo.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	pm := PageMap{URL: u}
+	for _, href := range []string{"mailto:foo@bar.com", " javascript:alert('hi there')", "path/to/site"} {
+		n := html.Node{
+			Type: html.ElementNode,
+			Data: "a",
+			Attr: []html.Attribute{
+				html.Attribute{Key: "href", Val: href},
+			},
+		}
+
+		err = addLinkURL(&pm, &n, DefaultOptions(1))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if len(pm.Links) != 1 {
+		t.Errorf("Expected number links to be 1, got %d", len(pm.Links))
+	}
+
+	if len(pm.SchemeLinks) != 2 {
+		t.Fatalf("Expected number scheme links to be 2, got %d", len(pm.SchemeLinks))
+	} else if pm.SchemeLinks[0].Scheme != "mailto" || pm.SchemeLinks[0].Href != "mailto:foo@bar.com" {
+		t.Errorf("Unexpected scheme link %+v", pm.SchemeLinks[0])
+	} else if pm.SchemeLinks[1].Scheme != "javascript" || pm.SchemeLinks[1].Href != "javascript:alert('hi there')" {
+		t.Errorf("Unexpected scheme link %+v", pm.SchemeLinks[1])
+	}
+}
+
+func TestCreateSchemeLinkReport(t *testing.T) {
+	createURL := func(str string) *url.URL {
+		u, err := url.Parse(str)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return u
+	}
+
+	sm := SiteMap{
+		PageMaps: []*PageMap{
+			&PageMap{
+				URL: createURL("https://foo.com"),
+				SchemeLinks: []*SchemeLink{
+					&SchemeLink{Scheme: "mailto", Href: "mailto:Sales@foo.com,support@foo.com?subject=Hi"},
+					&SchemeLink{Scheme: "tel", Href: "tel:+1-555-0100;ext=2"},
+					&SchemeLink{Scheme: "javascript", Href: "javascript:void(0)"},
+				},
+			},
+			&PageMap{
+				URL: createURL("https://foo.com/contact"),
+				SchemeLinks: []*SchemeLink{
+					&SchemeLink{Scheme: "mailto", Href: "mailto:sales@foo.com"},
+					&SchemeLink{Scheme: "sms", Href: "sms:%2B1-555-0199"},
+					&SchemeLink{Scheme: "ftp", Href: "ftp://foo.com"},
+				},
+			},
+		},
+	}
+
+	report := CreateSchemeLinkReport(&sm)
+	if len(report.Emails) != 2 {
+		t.Fatalf("Expected 2 emails, got %d", len(report.Emails))
+	} else if report.Emails[0].Value != "sales@foo.com" || len(report.Emails[0].Pages) != 2 {
+		t.Errorf("Unexpected email %+v", report.Emails[0])
+	} else if report.Emails[1].Value != "support@foo.com" || len(report.Emails[1].Pages) != 1 {
+		t.Errorf("Unexpected email %+v", report.Emails[1])
+	}
+
+	if len(report.Phones) != 2 {
+		t.Fatalf("Expected 2 phones, got %d", len(report.Phones))
+	} else if report.Phones[0].Value != "+1-555-0100" || report.Phones[1].Value != "+1-555-0199" {
+		t.Errorf("Unexpected phones %+v, %+v", report.Phones[0], report.Phones[1])
+	}
+
+	if len(report.JavaScriptLinks) != 1 {
+		t.Fatalf("Expected 1 javascript link, got %d", len(report.JavaScriptLinks))
+	} else if report.JavaScriptLinks[0].Value != "javascript:void(0)" {
+		t.Errorf("Unexpected javascript link %+v", report.JavaScriptLinks[0])
+	}
+}
@@ -0,0 +1,87 @@
+package mapper
+
+import (
+	"net/url"
+	"strings"
+)
+
+// A Scope determines which pages are crawled relative to a seed url.
+type Scope string
+
+const (
+	// ScopeHost crawls pages whose protocol and host match the seed exactly.
+	ScopeHost Scope = "host"
+
+	// ScopeDomain crawls pages on the host of the seed or any of its
+	// subdomains, over either http or https.
+	ScopeDomain Scope = "domain"
+
+	// ScopePrefix crawls pages whose protocol and host match the seed
+	// exactly and whose path is within the path of the seed.
+	ScopePrefix Scope = "prefix"
+)
+
+// Scopes lists every supported scope.
+var Scopes = []Scope{ScopeHost, ScopeDomain, ScopePrefix}
+
+func isInScope(scope Scope, seedURL, targetURL *url.URL) bool {
+	switch scope {
+	case ScopeDomain:
+		return isSameOrSubdomain(seedURL, targetURL)
+	case ScopePrefix:
+		return isSameDomain(seedURL, targetURL) && hasPathPrefix(seedURL.Path, targetURL.Path)
+	default:
+		return isSameDomain(seedURL, targetURL)
+	}
+}
+
+func isSameOrSubdomain(seedURL, targetURL *url.URL) bool {
+	if targetURL.Scheme != "http" && targetURL.Scheme != "https" {
+		return false
+	}
+
+	seedHost := strings.ToLower(seedURL.Hostname())
+	targetHost := strings.ToLower(targetURL.Hostname())
+	return targetHost == seedHost || strings.HasSuffix(targetHost, "."+seedHost)
+}
+
+// hasPathPrefix reports whether path is within prefix, treating prefix as a
+// directory so that "/docs" contains "/docs/api" but not "/docsearch".
+func hasPathPrefix(prefix, path string) bool {
+	if prefix == "" || strings.HasSuffix(prefix, "/") {
+		return strings.HasPrefix(path, prefix)
+	}
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// shouldCrawl reports whether u is in the scope of any of the seeds and is
+// allowed by the include and exclude expressions of opts.
+func shouldCrawl(opts *Options, seeds []*url.URL, u *url.URL) bool {
+	inScope := false
+	for _, seed := range seeds {
+		if isInScope(opts.Scope, seed, u) {
+			inScope = true
+			break
+		}
+	}
+	if !inScope {
+		return false
+	}
+
+	urlStr := u.String()
+	for _, re := range opts.Exclude {
+		if re.MatchString(urlStr) {
+			return false
+		}
+	}
+
+	if len(opts.Include) == 0 {
+		return true
+	}
+	for _, re := range opts.Include {
+		if re.MatchString(urlStr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package mapper
+
+import (
+	"net/url"
+	"regexp"
+	"testing"
+)
+
+func TestIsInScope(t *testing.T) {
+	testURL := func(scope Scope, seedStr, targetStr string, shouldBeInScope bool) {
+		seedURL, err := url.Parse(seedStr)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		targetURL, err := url.Parse(targetStr)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		inScope := isInScope(scope, seedURL, targetURL)
+		if inScope != shouldBeInScope {
+			t.Errorf("Expected (%s, %s, %s) to be %t, got %t", scope, seedURL, targetURL, shouldBeInScope, inScope)
+		}
+	}
+
+	testURL("", "https://foo.com", "https://foo.com/path", true)
+	testURL("", "https://foo.com", "https://docs.foo.com", false)
+	testURL(ScopeHost, "https://foo.com", "http://foo.com", false)
+
+	testURL(ScopeDomain, "https://foo.com", "https://foo.com/path", true)
+	testURL(ScopeDomain, "https://foo.com", "http://foo.com/path", true)
+	testURL(ScopeDomain, "https://foo.com", "https://docs.foo.com/path", true)
+	testURL(ScopeDomain, "https://foo.com", "https://barfoo.com", false)
+	testURL(ScopeDomain, "https://foo.com", "ftp://foo.com", false)
+
+	testURL(ScopePrefix, "https://foo.com/docs", "https://foo.com/docs", true)
+	testURL(ScopePrefix, "https://foo.com/docs", "https://foo.com/docs/api", true)
+	testURL(ScopePrefix, "https://foo.com/docs", "https://foo.com/docsearch", false)
+	testURL(ScopePrefix, "https://foo.com/docs/", "https://foo.com/docs/api", true)
+	testURL(ScopePrefix, "https://foo.com/docs", "https://foo.com/blog", false)
+	testURL(ScopePrefix, "https://foo.com", "https://foo.com/blog", true)
+}
+
+func TestShouldCrawl(t *testing.T) {
+	seed, err := url.Parse("https://foo.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	opts := &Options{
+		Include: []*regexp.Regexp{regexp.MustCompile(`/docs/`)},
+		Exclude: []*regexp.Regexp{regexp.MustCompile(`/docs/private/`)},
+	}
+
+	testURL := func(target string, shouldBeCrawled bool) {
+		u, err := url.Parse(target)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		crawl := shouldCrawl(opts, []*url.URL{seed}, u)
+		if crawl != shouldBeCrawled {
+			t.Errorf("Expected %s to be %t, got %t", u, shouldBeCrawled, crawl)
+		}
+	}
+
+	testURL("https://foo.com/docs/api", true)
+	testURL("https://foo.com/blog/post", false)
+	testURL("https://foo.com/docs/private/keys", false)
+	testURL("https://bar.com/docs/api", false)
+}
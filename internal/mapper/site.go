@@ -1,16 +1,21 @@
 package mapper
 
 import (
+	"context"
 	"errors"
 	"log"
 	"net/url"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // A SiteMap contains page maps for every page in the same domain. A page is
-// considered to be in the same domain if the protocol and host match exactly.
+// considered to be in the same domain if the protocol and host match exactly,
+// unless a different scope is configured.
 type SiteMap struct {
-	PageMaps []*PageMap `json:"pages"`
+	PageMaps        []*PageMap        `json:"pages"`
+	BrokenFragments []*BrokenFragment `json:"brokenFragments,omitempty"`
 }
 
 type workerPageResult struct {
@@ -18,37 +23,117 @@ type workerPageResult struct {
 	err error
 }
 
-var errNumWorkersTooLow = errors.New("num workers must be greater than 0")
+var (
+	errNumWorkersTooLow    = errors.New("num workers must be greater than 0")
+	errCheckpointDiscarded = errors.New("checkpoints cannot be used when discarding page maps")
+)
+
+// A PageError records the page whose fetch or parse stopped a crawl.
+type PageError struct {
+	URL *url.URL
+	Err error
+}
+
+func (pe *PageError) Error() string {
+	return pe.Err.Error()
+}
+
+func (pe *PageError) Unwrap() error {
+	return pe.Err
+}
 
 // CreateSiteMap returns a complete site map starting from the specified url.
 // The number of workers used to crawl the domain, begining at url u, is
 // determined by numWorkers.
 func CreateSiteMap(u *url.URL, numWorkers int) (*SiteMap, error) {
-	if numWorkers < 1 {
+	return CreateSiteMapWithOptions(context.Background(), u, DefaultOptions(numWorkers))
+}
+
+// CreateSiteMapWithOptions returns a complete site map starting from the
+// specified url, crawling and parsing pages as configured by opts. The crawl
+// stops early, returning the context's error, if ctx is cancelled.
+func CreateSiteMapWithOptions(ctx context.Context, u *url.URL, opts *Options) (*SiteMap, error) {
+	if opts.NumWorkers < 1 {
 		return nil, errNumWorkersTooLow
+	} else if opts.DiscardPageMaps && (opts.OnCheckpoint != nil || opts.Resume != nil) {
+		return nil, errCheckpointDiscarded
+	}
+
+	serialized := *opts
+	serialized.OnEvent = serializeEvents(opts.OnEvent)
+	if opts.Previous != nil {
+		serialized.previous = pagesByURL(opts.Previous)
+	}
+	opts = &serialized
+
+	log.Printf("Creating site map for %q with %d workers...", u, opts.NumWorkers)
+	urls := make(chan *QueuedURL)
+	results := createWorkers(ctx, opts, urls)
+	pms, numPages, err := processPages(ctx, u, urls, results, opts)
+	emitEvent(opts, &Event{Type: CrawlFinished, URL: u, Pages: numPages, Err: err})
+	if err != nil {
+		return nil, err
 	}
 
-	log.Printf("Creating site map for %q with %d workers...", u, numWorkers)
-	urls := make(chan *url.URL)
-	results := createWorkers(numWorkers, urls)
-	pms, err := processPages(u, urls, results)
-	return &SiteMap{pms}, err
+	sm := &SiteMap{PageMaps: pms}
+	if opts.CheckFragments {
+		sm.BrokenFragments = findBrokenFragments(pms)
+	}
+	if opts.DiscardPageMaps {
+		sm.PageMaps = nil
+	}
+	return sm, nil
 }
 
-func createWorkers(num int, urls <-chan *url.URL) <-chan *workerPageResult {
+func createWorkers(ctx context.Context, opts *Options, urls <-chan *QueuedURL) <-chan *workerPageResult {
 	var wg sync.WaitGroup
 	results := make(chan *workerPageResult)
 
-	wg.Add(num)
+	var limiter <-chan time.Time
+	stopLimiter := func() {}
+	if opts.RequestsPerSecond > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / opts.RequestsPerSecond))
+		limiter = ticker.C
+		stopLimiter = ticker.Stop
+	}
+
+	wg.Add(opts.NumWorkers)
 	go func() {
 		wg.Wait()
+		stopLimiter()
 		close(results)
 	}()
 
-	for i := 0; i < num; i++ {
+	metrics := getMetrics(opts)
+	for i := 0; i < opts.NumWorkers; i++ {
 		go func() {
-			for u := range urls {
-				pm, err := CreatePageMap(u)
+			for qu := range urls {
+				u := qu.URL
+				metrics.QueueChanged(-1)
+				if limiter != nil {
+					select {
+					case <-limiter:
+					case <-ctx.Done():
+					}
+				}
+
+				metrics.WorkersChanged(1)
+				pm, err := CreatePageMapWithOptions(ctx, u, opts)
+				metrics.WorkersChanged(-1)
+				if err != nil {
+					metrics.PageFailed(getErrorType(err))
+					emitEvent(opts, &Event{Type: PageFailed, URL: u, Err: err})
+					err = &PageError{URL: u, Err: err}
+				} else {
+					pm.Depth = qu.Depth
+					size := pm.Size
+					if pm.Change == PageUnchanged {
+						// The body of an unmodified page is not downloaded.
+						size = 0
+					}
+					metrics.PageFetched(pm.StatusCode, pm.Latency, size)
+					emitEvent(opts, &Event{Type: PageFetched, URL: u, Status: pm.StatusCode, Duration: pm.Latency})
+				}
 				results <- &workerPageResult{pm, err}
 			}
 			wg.Done()
@@ -57,63 +142,209 @@ func createWorkers(num int, urls <-chan *url.URL) <-chan *workerPageResult {
 	return results
 }
 
-func processPages(initialURL *url.URL, urls chan<- *url.URL, results <-chan *workerPageResult) ([]*PageMap, error) {
+// processPages sends urls to the workers and collects their page maps until
+// every reachable page in scope has been processed or the page limit is
+// reached, returning the page maps kept along with the number of pages
+// processed. If a worker fails or ctx is cancelled, no further urls are sent
+// and the first error is returned once the outstanding results have been
+// drained. When resuming from a checkpoint, its pages are kept and its
+// frontier is queued in place of the seeds.
+func processPages(ctx context.Context, initialURL *url.URL, urls chan<- *QueuedURL, results <-chan *workerPageResult, opts *Options) ([]*PageMap, int, error) {
 	var pms []*PageMap
-	var m sync.RWMutex
-	var wg sync.WaitGroup
+	var numPages int
+	var firstErr error
+	var limitReached bool
 
-	go func() {
-		urls <- initialURL
-		wg.Add(1)
-		wg.Wait()
+	frontier := opts.Frontier
+	if frontier == nil {
+		frontier = newMemoryFrontier()
+	}
+
+	crawlCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	metrics := getMetrics(opts)
+
+	// numQueued counts the pages added to the frontier and not yet popped,
+	// so that the queue metric is reset for those left once the crawl stops.
+	var numQueued int64
+	queue := func(u *url.URL, depth int) error {
+		added, err := frontier.Queue(u, depth)
+		if added {
+			atomic.AddInt64(&numQueued, 1)
+			emitEvent(opts, &Event{Type: PageQueued, URL: u})
+			metrics.QueueChanged(1)
+		}
+		return err
+	}
+
+	seeds := append([]*url.URL{initialURL}, opts.Seeds...)
+	var err error
+	if opts.Resume != nil {
+		pms = append(pms, opts.Resume.Pages...)
+		numPages = len(opts.Resume.Pages)
+		err = resumeFrontier(opts.Resume, seeds, opts, frontier, queue)
+	} else {
+		for _, seed := range seeds {
+			if err == nil {
+				err = queue(seed, 0)
+			}
+		}
+	}
+	if err != nil {
 		close(urls)
+		for range results {
+		}
+		return nil, 0, err
+	}
+
+	// The dispatcher pops pages from the frontier for the workers, waiting
+	// on wake while the frontier is empty but pages are still in flight, as
+	// their links may yet be queued. frontierErr is the first error from the
+	// frontier while popping pages, which stops the crawl.
+	var inFlight int64
+	var frontierErr error
+	wake := make(chan struct{}, 1)
+	go func() {
+		defer close(urls)
+		for {
+			// Links are queued before a page leaves the flight, so
+			// nothing more can be queued if none is in flight before
+			// the frontier is found empty.
+			idle := atomic.LoadInt64(&inFlight) == 0
+			qu, err := frontier.Pop()
+			if err != nil {
+				frontierErr = err
+				cancel()
+				return
+			} else if qu == nil && idle {
+				return
+			} else if qu == nil {
+				select {
+				case <-wake:
+				case <-crawlCtx.Done():
+					return
+				}
+				continue
+			}
+
+			atomic.AddInt64(&numQueued, -1)
+			atomic.AddInt64(&inFlight, 1)
+			select {
+			case urls <- qu:
+			case <-crawlCtx.Done():
+				metrics.QueueChanged(-1)
+				return
+			}
+		}
 	}()
 
-	for wr := range results {
-		if wr.err != nil {
-			return nil, wr.err
+	lastCheckpoint := time.Now()
+	checkpoint := func() {
+		if opts.OnCheckpoint == nil {
+			return
 		}
 
-		if hasVisitedPage(pms, &m, wr.pm.URL) {
-			wg.Done()
-			continue
+		cp, err := createCheckpoint(initialURL, pms, frontier)
+		if err != nil {
+			log.Printf("Failed to create checkpoint: %v", err)
+			return
 		}
+		opts.OnCheckpoint(cp)
+		lastCheckpoint = time.Now()
+	}
 
-		log.Printf("Processed %s", wr.pm.URL)
+	for wr := range results {
+		processPage := func() error {
+			if wr.err != nil && firstErr == nil && !limitReached {
+				firstErr = wr.err
+				cancel()
+			}
+			if firstErr != nil || limitReached {
+				return nil
+			}
 
-		m.Lock()
-		pms = append(pms, wr.pm)
-		m.Unlock()
+			err := frontier.Visit(wr.pm.URL)
+			if err != nil {
+				return err
+			}
 
-		wg.Add(len(wr.pm.Links) - 1)
-		go func(links []*url.URL) {
-			for _, link := range links {
-				if !isSameDomain(initialURL, link) {
-					wg.Done()
-				} else if hasVisitedPage(pms, &m, link) {
-					wg.Done()
-				} else {
-					urls <- link
+			log.Printf("Processed %s", wr.pm.URL)
+			numPages++
+			pms = keepPageMap(pms, wr.pm, opts)
+
+			if opts.OnPageMap != nil {
+				opts.OnPageMap(wr.pm)
+			}
+			for _, link := range wr.pm.Links {
+				emitEvent(opts, &Event{Type: LinkDiscovered, URL: link, Source: wr.pm.URL})
+			}
+
+			if opts.MaxPages > 0 && numPages >= opts.MaxPages {
+				limitReached = true
+				cancel()
+				return nil
+			}
+
+			depth := wr.pm.Depth + 1
+			if opts.MaxDepth > 0 && depth > opts.MaxDepth {
+				return nil
+			}
+			for _, link := range wr.pm.Links {
+				if !shouldCrawl(opts, seeds, link) {
+					continue
+				}
+				err := queue(link, depth)
+				if err != nil {
+					return err
 				}
 			}
-		}(wr.pm.Links)
+			return nil
+		}
+
+		err := processPage()
+		if err != nil && firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+
+		atomic.AddInt64(&inFlight, -1)
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+
+		if firstErr == nil && !limitReached && time.Since(lastCheckpoint) >= opts.CheckpointInterval {
+			checkpoint()
+		}
 	}
-	return pms, nil
+	metrics.QueueChanged(-int(atomic.LoadInt64(&numQueued)))
+
+	if frontierErr != nil {
+		firstErr = frontierErr
+	} else if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+
+	if firstErr != nil {
+		checkpoint()
+		return nil, 0, firstErr
+	}
+	return pms, numPages, nil
+}
+
+// keepPageMap appends pm to pms, unless page maps are discarded. When
+// discarding page maps while checking fragments, only the fragment links and
+// anchors of the page are kept.
+func keepPageMap(pms []*PageMap, pm *PageMap, opts *Options) []*PageMap {
+	if !opts.DiscardPageMaps {
+		return append(pms, pm)
+	} else if opts.CheckFragments {
+		return append(pms, &PageMap{URL: pm.URL, FragmentLinks: pm.FragmentLinks, AnchorIDs: pm.AnchorIDs})
+	}
+	return pms
 }
 
 func isSameDomain(initialURL, targetURL *url.URL) bool {
 	return initialURL.Scheme == targetURL.Scheme &&
 		initialURL.Host == targetURL.Host
 }
-
-func hasVisitedPage(pms []*PageMap, m *sync.RWMutex, u *url.URL) bool {
-	m.RLock()
-	defer m.RUnlock()
-
-	for _, pm := range pms {
-		if pm.URL.String() == u.String() {
-			return true
-		}
-	}
-	return false
-}
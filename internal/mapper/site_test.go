@@ -1,7 +1,14 @@
 package mapper
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"reflect"
+	"runtime"
 	"sync"
 	"testing"
 )
@@ -13,23 +20,44 @@ func TestCreateSiteMapNumWorkers(t *testing.T) {
 	}
 }
 
+// createTestWorker returns the results of a worker that processes every url
+// sent to urls, using the page map of pms with the same url, or else a page
+// map without links. The urls processed are appended to processed.
+func createTestWorker(urls <-chan *QueuedURL, processed *[]string, pms ...*PageMap) <-chan *workerPageResult {
+	results := make(chan *workerPageResult)
+	go func() {
+		defer close(results)
+		for qu := range urls {
+			*processed = append(*processed, qu.URL.String())
+			pm := &PageMap{URL: qu.URL}
+			for _, known := range pms {
+				if known.URL.String() == qu.URL.String() {
+					pm = known
+				}
+			}
+			pm.Depth = qu.Depth
+			results <- &workerPageResult{pm: pm}
+		}
+	}()
+	return results
+}
+
 func TestProcessPagesInitialURL(t *testing.T) {
 	u, err := url.Parse("https://foo.com")
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 
-	urls := make(chan *url.URL)
-	results := make(chan *workerPageResult)
-	close(results)
-	_, err = processPages(u, urls, results)
+	var processed []string
+	urls := make(chan *QueuedURL)
+	results := createTestWorker(urls, &processed)
+	_, _, err = processPages(context.Background(), u, urls, results, &Options{})
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 
-	firstURL := <-urls
-	if firstURL.String() != u.String() {
-		t.Errorf("Expected initial url to be %q, got %q", u.String(), firstURL.String())
+	if len(processed) != 1 || processed[0] != u.String() {
+		t.Errorf("Expected initial url %q to be processed, got %v", u, processed)
 	}
 }
 
@@ -49,30 +77,23 @@ func TestProcessPagesAddURLs(t *testing.T) {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 
-	firstResult := workerPageResult{
-		pm: &PageMap{
-			URL:   u,
-			Links: []*url.URL{circularLink, unvisitedLink},
-		},
-	}
-
-	urls := make(chan *url.URL)
-	results := make(chan *workerPageResult, 1)
-	results <- &firstResult
-	close(results)
+	var processed []string
+	urls := make(chan *QueuedURL)
+	results := createTestWorker(urls, &processed, &PageMap{
+		URL:   u,
+		Links: []*url.URL{circularLink, unvisitedLink},
+	})
 
-	_, err = processPages(u, urls, results)
+	pms, _, err := processPages(context.Background(), u, urls, results, &Options{})
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 
-	firstURL := <-urls
-	if firstURL.String() == u.String() {
-		firstURL = <-urls
-	}
-
-	if firstURL.String() != unvisitedLink.String() {
-		t.Errorf("Expected new url to be %q, got %q", unvisitedLink.String(), firstURL.String())
+	expected := []string{u.String(), unvisitedLink.String()}
+	if !reflect.DeepEqual(processed, expected) {
+		t.Errorf("Expected urls %v to be processed once each, got %v", expected, processed)
+	} else if len(pms) != 2 || pms[1].Depth != 1 {
+		t.Errorf("Expected new url to be processed at depth 1, got %v", pms)
 	}
 }
 
@@ -107,29 +128,303 @@ func TestIsSameDomain(t *testing.T) {
 	testURL("https://foo.com/path/to/asset/1.png", "https://bar.com/path/to/asset/2.png", false)
 }
 
-func TestHasVisitedPage(t *testing.T) {
-	testURL := func(pageURLs []string, target string, shouldBeVisited bool) {
-		var pms []*PageMap
-		for _, pageURL := range pageURLs {
-			u, err := url.Parse(pageURL)
-			if err != nil {
-				t.Fatalf("Unexpected error: %v", err)
+func TestProcessPagesCancelled(t *testing.T) {
+	u, err := url.Parse("https://foo.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var processed []string
+	urls := make(chan *QueuedURL)
+	results := createTestWorker(urls, &processed)
+
+	_, _, err = processPages(ctx, u, urls, results, &Options{})
+	if err != context.Canceled {
+		t.Errorf("Expected error %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestProcessPagesOnPageMap(t *testing.T) {
+	u, err := url.Parse("https://foo.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var processed []string
+	urls := make(chan *QueuedURL)
+	results := createTestWorker(urls, &processed)
+
+	var pmsProcessed []*PageMap
+	opts := &Options{
+		OnPageMap: func(pm *PageMap) {
+			pmsProcessed = append(pmsProcessed, pm)
+		},
+	}
+	pms, _, err := processPages(context.Background(), u, urls, results, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(pmsProcessed) != 1 || pmsProcessed[0] != pms[0] {
+		t.Errorf("Expected OnPageMap to be called with the processed page map")
+	}
+}
+
+func TestProcessPagesMaxPages(t *testing.T) {
+	u, err := url.Parse("https://foo.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	seed, err := url.Parse("https://foo.com/other")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var processed []string
+	urls := make(chan *QueuedURL)
+	results := createTestWorker(urls, &processed)
+
+	opts := &Options{Seeds: []*url.URL{seed}, MaxPages: 1}
+	pms, numPages, err := processPages(context.Background(), u, urls, results, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(pms) != 1 || numPages != 1 || pms[0].URL != u {
+		t.Errorf("Expected only the initial url to be processed, got %d page maps", len(pms))
+	}
+}
+
+func TestProcessPagesDispatchers(t *testing.T) {
+	// Every page links to two further pages, whose links would each wait in
+	// a goroutine if one were started per page.
+	pageURL := func(i int) *url.URL {
+		return &url.URL{Scheme: "https", Host: "foo.com", Path: fmt.Sprintf("/%d", i)}
+	}
+	var pms []*PageMap
+	for i := 0; i < 1000; i++ {
+		pms = append(pms, &PageMap{URL: pageURL(i), Links: []*url.URL{pageURL(2*i + 1), pageURL(2*i + 2)}})
+	}
+
+	var processed []string
+	urls := make(chan *QueuedURL)
+	results := createTestWorker(urls, &processed, pms...)
+
+	var maxGoroutines int
+	opts := &Options{
+		MaxDepth: 8,
+		OnPageMap: func(pm *PageMap) {
+			if n := runtime.NumGoroutine(); n > maxGoroutines {
+				maxGoroutines = n
+			}
+		},
+	}
+	before := runtime.NumGoroutine()
+	processedPMs, _, err := processPages(context.Background(), pageURL(0), urls, results, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(processedPMs) != 511 {
+		t.Errorf("Expected 511 page maps, got %d", len(processedPMs))
+	} else if maxGoroutines > before+10 {
+		t.Errorf("Expected a fixed number of goroutines, got %d more", maxGoroutines-before)
+	}
+}
+
+func TestCreateWorkersPageError(t *testing.T) {
+	u, err := url.Parse("http://127.0.0.1:0/")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	urls := make(chan *QueuedURL, 1)
+	urls <- &QueuedURL{URL: u}
+	close(urls)
+
+	wr := <-createWorkers(context.Background(), DefaultOptions(1), urls)
+	var pe *PageError
+	if !errors.As(wr.err, &pe) {
+		t.Fatalf("Expected a page error, got %v", wr.err)
+	} else if pe.URL != u {
+		t.Errorf("Expected page error for %q, got %q", u, pe.URL)
+	}
+}
+
+func TestCreateSiteMapPrevious(t *testing.T) {
+	const lastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+	rootETag := `"v1"`
+	rootBody := `<a href="/a"></a><a href="/b"></a>`
+	var m sync.Mutex
+	var conditional []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+		if r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "" {
+			conditional = append(conditional, r.URL.Path)
+		}
+
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("ETag", rootETag)
+			if r.Header.Get("If-None-Match") == rootETag {
+				w.WriteHeader(http.StatusNotModified)
+				return
 			}
-			pms = append(pms, &PageMap{URL: u})
+			w.Write([]byte(rootBody))
+		case "/a":
+			w.Header().Set("Last-Modified", lastModified)
+			if r.Header.Get("If-Modified-Since") == lastModified {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Write([]byte(`<img src="/logo.png">`))
+		default:
+			w.Write([]byte(`<html></html>`))
 		}
+	}))
+	defer ts.Close()
 
-		targetURL, err := url.Parse(target)
-		if err != nil {
-			t.Fatalf("Unexpected error: %v", err)
+	u, err := url.Parse(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	old, err := CreateSiteMapWithOptions(context.Background(), u, DefaultOptions(2))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if len(old.PageMaps) != 3 || len(conditional) != 0 {
+		t.Fatalf("Expected 3 pages fetched unconditionally, got %d and %v", len(old.PageMaps), conditional)
+	}
+
+	m.Lock()
+	rootETag = `"v2"`
+	rootBody = `<a href="/a"></a><a href="/b"></a><a href="/c"></a>`
+	m.Unlock()
+
+	opts := DefaultOptions(2)
+	opts.Previous = old
+	sm, err := CreateSiteMapWithOptions(context.Background(), u, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	changes := make(map[string]PageChange)
+	for _, pm := range sm.PageMaps {
+		changes[pm.URL.Path] = pm.Change
+		if pm.URL.Path == "/a" && (pm.StatusCode != http.StatusOK || len(pm.Assets) != 1 || pm.LastModified != lastModified) {
+			t.Errorf("Expected unchanged page to reuse its previous page map, got %+v", pm)
+		} else if pm.URL.Path == "/" && pm.ETag != `"v2"` {
+			t.Errorf("Expected etag to be %q, got %q", `"v2"`, pm.ETag)
 		}
+	}
 
-		visited := hasVisitedPage(pms, new(sync.RWMutex), targetURL)
-		if visited != shouldBeVisited {
-			t.Errorf("Expected visited to be %t, got %t", shouldBeVisited, visited)
+	expected := map[string]PageChange{"/": PageChanged, "/a": PageUnchanged, "/b": PageChanged, "/c": PageNew}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected changes %v, got %v", expected, changes)
+	}
+	if len(conditional) != 2 {
+		t.Errorf("Expected 2 conditional requests, got %v", conditional)
+	}
+}
+
+func TestCreateSiteMapResume(t *testing.T) {
+	var m sync.Mutex
+	fetched := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		fetched[r.URL.Path]++
+		m.Unlock()
+		w.Write([]byte(`<a href="/"></a><a href="/a"></a><a href="/b"></a>`))
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var cp *Checkpoint
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	opts := DefaultOptions(1)
+	opts.OnCheckpoint = func(c *Checkpoint) {
+		cp = c
+	}
+	_, err = CreateSiteMapWithOptions(ctx, u, opts)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected error %v, got %v", context.Canceled, err)
+	} else if cp == nil || len(cp.Pages) != 0 || len(cp.Frontier) != 1 {
+		t.Fatalf("Expected a checkpoint queueing the seed once the crawl stopped, got %+v", cp)
+	}
+
+	a, err := url.Parse(ts.URL + "/a")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cp.Pages = []*PageMap{&PageMap{URL: u, Links: []*url.URL{u, a}}}
+	cp.Frontier = []*QueuedURL{&QueuedURL{URL: a, Depth: 1}}
+
+	opts = DefaultOptions(2)
+	opts.Resume = cp
+	sm, err := CreateSiteMapWithOptions(context.Background(), u, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(sm.PageMaps) != 3 {
+		t.Errorf("Expected 3 pages, got %d", len(sm.PageMaps))
+	}
+	expected := map[string]int{"/a": 1, "/b": 1}
+	if !reflect.DeepEqual(fetched, expected) {
+		t.Errorf("Expected pages fetched %v, got %v", expected, fetched)
+	}
+}
+
+func TestCreateSiteMapDiscardPageMaps(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<a href="/a#top"></a><a href="/b#missing"></a><h1 id="top"></h1>`))
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var numPageMaps int
+	var numPages int
+	opts := DefaultOptions(2)
+	opts.DiscardPageMaps = true
+	opts.CheckFragments = true
+	opts.OnPageMap = func(pm *PageMap) {
+		numPageMaps++
+	}
+	opts.OnEvent = func(e *Event) {
+		if e.Type == CrawlFinished {
+			numPages = e.Pages
 		}
 	}
 
-	testURL([]string{"https://foo.com", "https://bar.com"}, "https://foo.com", true)
-	testURL([]string{"https://foo.com", "https://bar.com"}, "https://bar.com", true)
-	testURL([]string{"https://foo.com", "https://bar.com"}, "https://baz.com", false)
+	sm, err := CreateSiteMapWithOptions(context.Background(), u, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if len(sm.PageMaps) != 0 {
+		t.Errorf("Expected page maps to be discarded, got %d", len(sm.PageMaps))
+	} else if numPageMaps != 3 || numPages != 3 {
+		t.Errorf("Expected 3 pages to be processed, got %d page maps and %d pages", numPageMaps, numPages)
+	} else if len(sm.BrokenFragments) != 3 {
+		t.Errorf("Expected a broken fragment from each page, got %d", len(sm.BrokenFragments))
+	}
+
+	opts.OnCheckpoint = func(cp *Checkpoint) {}
+	_, err = CreateSiteMapWithOptions(context.Background(), u, opts)
+	if err != errCheckpointDiscarded {
+		t.Errorf("Expected error %v, got %v", errCheckpointDiscarded, err)
+	}
 }
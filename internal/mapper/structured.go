@@ -0,0 +1,284 @@
+package mapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// StructuredData contains the JSON-LD, microdata and RDFa found on a page.
+// Errors lists the JSON-LD blocks that could not be parsed or are missing
+// required keys.
+type StructuredData struct {
+	JSONLD    []interface{}     `json:"jsonLd,omitempty"`
+	Microdata []*StructuredItem `json:"microdata,omitempty"`
+	RDFa      []*StructuredItem `json:"rdfa,omitempty"`
+	Errors    []string          `json:"errors,omitempty"`
+}
+
+// A StructuredItem is a microdata or RDFa item. Property values are either
+// strings or nested items.
+type StructuredItem struct {
+	Type       []string                 `json:"type,omitempty"`
+	ID         string                   `json:"id,omitempty"`
+	Properties map[string][]interface{} `json:"properties"`
+}
+
+// itemSyntax holds the attributes used by a syntax to mark up items.
+type itemSyntax struct {
+	scope, prop, typ string
+	ids              []string
+}
+
+var (
+	microdataSyntax = &itemSyntax{scope: "itemscope", prop: "itemprop", typ: "itemtype", ids: []string{"itemid"}}
+	rdfaSyntax      = &itemSyntax{scope: "typeof", prop: "property", typ: "typeof", ids: []string{"resource", "about"}}
+)
+
+// structuredLinkProps and structuredAssetProps are the properties whose
+// values are added to the links and assets of the page respectively.
+var (
+	structuredLinkProps  = map[string]bool{"url": true, "sameas": true, "mainentityofpage": true}
+	structuredAssetProps = map[string]bool{"image": true, "logo": true, "thumbnailurl": true, "contenturl": true, "embedurl": true}
+)
+
+func extractStructuredData(pm *PageMap, root *html.Node, opts *Options) {
+	sd := &StructuredData{}
+	processStructuredNode(sd, root)
+	if len(sd.JSONLD) == 0 && len(sd.Microdata) == 0 && len(sd.RDFa) == 0 && len(sd.Errors) == 0 {
+		return
+	}
+
+	for _, v := range sd.JSONLD {
+		addStructuredURLs(pm, "", v, opts)
+	}
+	for _, item := range sd.Microdata {
+		addStructuredURLs(pm, "", item, opts)
+	}
+	for _, item := range sd.RDFa {
+		addStructuredURLs(pm, "", item, opts)
+	}
+	pm.Structured = sd
+}
+
+func processStructuredNode(sd *StructuredData, n *html.Node) {
+	if n.Type == html.ElementNode {
+		if isJSONLDNode(n) {
+			addJSONLD(sd, getRawText(n))
+			return
+		}
+
+		if isTopLevelItem(n, microdataSyntax) {
+			sd.Microdata = append(sd.Microdata, createStructuredItem(n, microdataSyntax))
+		}
+		if isTopLevelItem(n, rdfaSyntax) {
+			sd.RDFa = append(sd.RDFa, createStructuredItem(n, rdfaSyntax))
+		}
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		processStructuredNode(sd, child)
+	}
+}
+
+func isJSONLDNode(n *html.Node) bool {
+	if getNodeType(n) != scriptNode {
+		return false
+	}
+
+	typ, err := getNodeAttrValue(n, "type")
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(strings.TrimSpace(typ), "application/ld+json")
+}
+
+func getRawText(n *html.Node) string {
+	var text string
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.TextNode {
+			text += child.Data
+		}
+	}
+	return text
+}
+
+func addJSONLD(sd *StructuredData, raw string) {
+	var v interface{}
+	err := json.Unmarshal([]byte(raw), &v)
+	if err != nil {
+		sd.Errors = append(sd.Errors, fmt.Sprintf("invalid JSON-LD: %v", err))
+		return
+	}
+
+	sd.JSONLD = append(sd.JSONLD, v)
+	sd.Errors = append(sd.Errors, validateJSONLD(v)...)
+}
+
+// validateJSONLD checks that each top level object of v declares a @context
+// and either a @type or a @graph.
+func validateJSONLD(v interface{}) []string {
+	var objs []interface{}
+	switch t := v.(type) {
+	case []interface{}:
+		objs = t
+	default:
+		objs = []interface{}{t}
+	}
+
+	var errs []string
+	for _, o := range objs {
+		obj, ok := o.(map[string]interface{})
+		if !ok {
+			errs = append(errs, fmt.Sprintf("JSON-LD value must be an object, got %T", o))
+			continue
+		}
+
+		if _, ok := obj["@context"]; !ok {
+			errs = append(errs, "JSON-LD object is missing @context")
+		}
+
+		_, hasType := obj["@type"]
+		_, hasGraph := obj["@graph"]
+		if !hasType && !hasGraph {
+			errs = append(errs, "JSON-LD object is missing @type")
+		}
+	}
+	return errs
+}
+
+// isTopLevelItem reports whether n starts an item that is not the property
+// value of another item.
+func isTopLevelItem(n *html.Node, syntax *itemSyntax) bool {
+	return hasNodeAttr(n, syntax.scope) && !hasNodeAttr(n, syntax.prop)
+}
+
+func createStructuredItem(n *html.Node, syntax *itemSyntax) *StructuredItem {
+	item := &StructuredItem{Properties: make(map[string][]interface{})}
+	if typ, err := getNodeAttrValue(n, syntax.typ); err == nil {
+		item.Type = strings.Fields(typ)
+	}
+	if id, err := getNodeAttrValues(n, syntax.ids); err == nil {
+		item.ID = id[0]
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		addItemProperties(item, child, syntax)
+	}
+	return item
+}
+
+func addItemProperties(item *StructuredItem, n *html.Node, syntax *itemSyntax) {
+	if n.Type != html.ElementNode {
+		return
+	}
+
+	props, err := getNodeAttrValue(n, syntax.prop)
+	isScope := hasNodeAttr(n, syntax.scope)
+	if err == nil {
+		var value interface{}
+		if isScope {
+			value = createStructuredItem(n, syntax)
+		} else {
+			value = getItemPropValue(n)
+		}
+
+		for _, prop := range strings.Fields(props) {
+			item.Properties[prop] = append(item.Properties[prop], value)
+		}
+	}
+
+	// A nested item owns the properties of its descendants.
+	if isScope {
+		return
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		addItemProperties(item, child, syntax)
+	}
+}
+
+func getItemPropValue(n *html.Node) string {
+	if content, err := getNodeAttrValue(n, "content"); err == nil {
+		return content
+	}
+
+	var keys []string
+	switch n.Data {
+	case "audio", "embed", "iframe", "img", "source", "track", "video":
+		keys = []string{"src"}
+	case "a", "area", "link":
+		keys = []string{"href"}
+	case "object":
+		keys = []string{"data"}
+	case "data", "meter":
+		keys = []string{"value"}
+	case "time":
+		keys = []string{"datetime"}
+	default:
+		keys = []string{"resource"}
+	}
+
+	if vals, err := getNodeAttrValues(n, keys); err == nil {
+		return vals[0]
+	}
+	return getNodeText(n)
+}
+
+// addStructuredURLs adds the urls found in the structured data value v,
+// held by property prop, to the links or assets of the page.
+func addStructuredURLs(pm *PageMap, prop string, v interface{}, opts *Options) {
+	switch t := v.(type) {
+	case string:
+		name := getLocalPropName(prop)
+		if structuredLinkProps[name] {
+			addLink(pm, t, opts)
+		} else if structuredAssetProps[name] {
+			addAsset(pm, t)
+		}
+	case []interface{}:
+		for _, e := range t {
+			addStructuredURLs(pm, prop, e, opts)
+		}
+	case map[string]interface{}:
+		addStructuredObjectURLs(pm, prop, t, opts)
+	case *StructuredItem:
+		props := make(map[string]interface{}, len(t.Properties))
+		for k, values := range t.Properties {
+			props[k] = values
+		}
+		addStructuredObjectURLs(pm, prop, props, opts)
+	}
+}
+
+// addStructuredObjectURLs adds the urls of an object held by property prop.
+// The url of an object held by an asset property, such as an ImageObject
+// held by image, is an asset rather than a link.
+func addStructuredObjectURLs(pm *PageMap, prop string, props map[string]interface{}, opts *Options) {
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	isAsset := structuredAssetProps[getLocalPropName(prop)]
+	for _, k := range keys {
+		if isAsset && getLocalPropName(k) == "url" {
+			addStructuredURLs(pm, prop, props[k], opts)
+		} else {
+			addStructuredURLs(pm, k, props[k], opts)
+		}
+	}
+}
+
+// getLocalPropName returns the lowercase name of prop without any vocabulary
+// IRI or prefix, such that "http://schema.org/sameAs" becomes "sameas".
+func getLocalPropName(prop string) string {
+	if i := strings.LastIndexAny(prop, "/#:"); i >= 0 {
+		prop = prop[i+1:]
+	}
+	return strings.ToLower(prop)
+}
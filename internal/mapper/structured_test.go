@@ -0,0 +1,143 @@
+package mapper
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+const structuredTestPage = `<html>
+	<head>
+		<script type="application/ld+json">
+		{
+			"@context": "https://schema.org",
+			"@type": "Organization",
+			"url": "/about",
+			"logo": {"@type": "ImageObject", "url": "/logo.png"},
+			"sameAs": ["https://twitter.com/foo"]
+		}
+		</script>
+		<script type="application/ld+json">{"@type": "Thing"}</script>
+		<script type="application/ld+json">{"broken": </script>
+	</head>
+	<body>
+		<div itemscope itemtype="https://schema.org/Product">
+			<span itemprop="name">Widget</span>
+			<img itemprop="image" src="widget.png">
+			<div itemprop="offers" itemscope itemtype="https://schema.org/Offer">
+				<meta itemprop="price" content="9.99">
+				<a itemprop="url" href="/buy">Buy</a>
+			</div>
+		</div>
+		<div vocab="https://schema.org/" typeof="Person">
+			<span property="name">Jane</span>
+			<a property="sameAs" href="https://jane.example.com">Home</a>
+		</div>
+	</body>
+</html>`
+
+func TestExtractStructuredData(t *testing.T) {
+	u, err := url.Parse("https://foo.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	root, err := html.Parse(strings.NewReader(structuredTestPage))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	pm := PageMap{URL: u}
+	extractStructuredData(&pm, root, DefaultOptions(1))
+
+	sd := pm.Structured
+	if sd == nil {
+		t.Fatalf("Expected structured data")
+	}
+
+	if len(sd.JSONLD) != 2 {
+		t.Errorf("Expected 2 JSON-LD blocks, got %d", len(sd.JSONLD))
+	}
+	if len(sd.Errors) != 2 {
+		t.Errorf("Expected 2 JSON-LD errors, got %v", sd.Errors)
+	}
+
+	if len(sd.Microdata) != 1 {
+		t.Fatalf("Expected 1 microdata item, got %d", len(sd.Microdata))
+	}
+	product := sd.Microdata[0]
+	if product.Properties["name"][0] != "Widget" {
+		t.Errorf("Expected name to be Widget, got %v", product.Properties["name"])
+	}
+	offer, ok := product.Properties["offers"][0].(*StructuredItem)
+	if !ok {
+		t.Fatalf("Expected offers to be a nested item")
+	} else if offer.Properties["price"][0] != "9.99" {
+		t.Errorf("Expected price to be 9.99, got %v", offer.Properties["price"])
+	} else if _, ok := product.Properties["price"]; ok {
+		t.Errorf("Expected price to belong to the nested item only")
+	}
+
+	if len(sd.RDFa) != 1 {
+		t.Fatalf("Expected 1 RDFa item, got %d", len(sd.RDFa))
+	} else if sd.RDFa[0].Type[0] != "Person" || sd.RDFa[0].Properties["name"][0] != "Jane" {
+		t.Errorf("Unexpected RDFa item %+v", sd.RDFa[0])
+	}
+
+	expectedLinks := map[string]bool{
+		"https://foo.com/about":    true,
+		"https://twitter.com/foo":  true,
+		"https://foo.com/buy":      true,
+		"https://jane.example.com": true,
+	}
+	if len(pm.Links) != len(expectedLinks) {
+		t.Errorf("Expected %d links, got %v", len(expectedLinks), pm.Links)
+	}
+	for _, link := range pm.Links {
+		if !expectedLinks[link.String()] {
+			t.Errorf("Unexpected link %q", link)
+		}
+	}
+
+	expectedAssets := map[string]bool{
+		"https://foo.com/logo.png":   true,
+		"https://foo.com/widget.png": true,
+	}
+	if len(pm.Assets) != len(expectedAssets) {
+		t.Errorf("Expected %d assets, got %v", len(expectedAssets), pm.Assets)
+	}
+	for _, asset := range pm.Assets {
+		if !expectedAssets[asset.String()] {
+			t.Errorf("Unexpected asset %q", asset)
+		}
+	}
+}
+
+func TestExtractStructuredDataNone(t *testing.T) {
+	root, err := html.Parse(strings.NewReader("<p>Nothing structured</p>"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	pm := PageMap{}
+	extractStructuredData(&pm, root, DefaultOptions(1))
+	if pm.Structured != nil {
+		t.Errorf("Expected no structured data, got %+v", pm.Structured)
+	}
+}
+
+func TestGetLocalPropName(t *testing.T) {
+	testName := func(prop, expected string) {
+		name := getLocalPropName(prop)
+		if name != expected {
+			t.Errorf("Expected local name of %q to be %q, got %q", prop, expected, name)
+		}
+	}
+
+	testName("sameAs", "sameas")
+	testName("http://schema.org/sameAs", "sameas")
+	testName("schema:image", "image")
+	testName("http://xmlns.com/foaf/0.1/#logo", "logo")
+}
@@ -104,7 +104,7 @@ func TestGetUniqueURLs(t *testing.T) {
 		seen := make(map[string]bool)
 		for _, u := range unique {
 			if seen[u.String()] {
-				t.Errorf("Duplicate url %q", u.String)
+				t.Errorf("Duplicate url %q", u.String())
 			} else {
 				seen[u.String()] = true
 			}
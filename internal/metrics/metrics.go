@@ -0,0 +1,174 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Crawl records the measurements of crawls as Prometheus metrics. It
+// implements mapper.Metrics, and may be shared by concurrent crawls.
+type Crawl struct {
+	pages   *prometheus.CounterVec
+	latency prometheus.Histogram
+	bytes   prometheus.Counter
+	queue   prometheus.Gauge
+	workers prometheus.Gauge
+	errors  *prometheus.CounterVec
+}
+
+// NewCrawl returns crawl metrics registered with reg.
+func NewCrawl(reg prometheus.Registerer) (*Crawl, error) {
+	c := &Crawl{
+		pages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "sitemapper_pages_fetched_total",
+			Help: "Pages fetched and parsed, by class of status code.",
+		}, []string{"status_class"}),
+		latency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "sitemapper_fetch_duration_seconds",
+			Help:    "Time taken to fetch and parse a page.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		bytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "sitemapper_downloaded_bytes_total",
+			Help: "Bytes of page bodies downloaded.",
+		}),
+		queue: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "sitemapper_queue_depth",
+			Help: "Urls queued to be crawled but not yet taken by a worker.",
+		}),
+		workers: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "sitemapper_active_workers",
+			Help: "Workers currently fetching a page.",
+		}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "sitemapper_fetch_errors_total",
+			Help: "Pages that could not be fetched or parsed, by type of error.",
+		}, []string{"type"}),
+	}
+
+	for _, collector := range []prometheus.Collector{c.pages, c.latency, c.bytes, c.queue, c.workers, c.errors} {
+		err := reg.Register(collector)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *Crawl) QueueChanged(delta int) {
+	c.queue.Add(float64(delta))
+}
+
+func (c *Crawl) WorkersChanged(delta int) {
+	c.workers.Add(float64(delta))
+}
+
+func (c *Crawl) PageFetched(status int, latency time.Duration, bytes int64) {
+	c.pages.WithLabelValues(getStatusClass(status)).Inc()
+	c.latency.Observe(latency.Seconds())
+	c.bytes.Add(float64(bytes))
+}
+
+func (c *Crawl) PageFailed(errType string) {
+	c.errors.WithLabelValues(errType).Inc()
+}
+
+func getStatusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return fmt.Sprintf("%dxx", status/100)
+}
+
+// WriteSummary writes the metrics gathered by g as one line per metric,
+// with histograms summarized by their count, mean and estimated quantiles.
+func WriteSummary(w io.Writer, g prometheus.Gatherer) error {
+	families, err := g.Gather()
+	if err != nil {
+		return err
+	}
+
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			name := family.GetName() + getLabels(m)
+
+			var value string
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				value = formatValue(m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				value = formatValue(m.GetGauge().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				value = summarizeHistogram(m.GetHistogram())
+			default:
+				continue
+			}
+
+			_, err = fmt.Fprintf(w, "%s %s\n", name, value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func getLabels(m *dto.Metric) string {
+	if len(m.GetLabel()) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(m.GetLabel()))
+	for _, lp := range m.GetLabel() {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", lp.GetName(), lp.GetValue()))
+	}
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	return fmt.Sprintf("%g", v)
+}
+
+func summarizeHistogram(h *dto.Histogram) string {
+	count := h.GetSampleCount()
+	if count == 0 {
+		return "count=0"
+	}
+
+	mean := h.GetSampleSum() / float64(count)
+	return fmt.Sprintf("count=%d mean=%s p50=%s p95=%s",
+		count, formatValue(mean), formatValue(estimateQuantile(h, 0.5)), formatValue(estimateQuantile(h, 0.95)))
+}
+
+// estimateQuantile estimates a quantile of a histogram by interpolating
+// within the bucket it falls in, as Prometheus' histogram_quantile does.
+func estimateQuantile(h *dto.Histogram, q float64) float64 {
+	rank := q * float64(h.GetSampleCount())
+	lower := 0.0
+	var below uint64
+	for _, b := range h.GetBucket() {
+		upper := b.GetUpperBound()
+		cumulative := b.GetCumulativeCount()
+		if float64(cumulative) >= rank {
+			if math.IsInf(upper, 1) {
+				return lower
+			}
+			inBucket := float64(cumulative - below)
+			if inBucket == 0 {
+				return upper
+			}
+			return lower + (upper-lower)*(rank-float64(below))/inBucket
+		}
+		lower = upper
+		below = cumulative
+	}
+	return lower
+}
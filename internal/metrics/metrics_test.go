@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func createTestCrawl(t *testing.T) (*Crawl, *prometheus.Registry) {
+	reg := prometheus.NewRegistry()
+	c, err := NewCrawl(reg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return c, reg
+}
+
+func TestCrawl(t *testing.T) {
+	c, _ := createTestCrawl(t)
+
+	c.QueueChanged(3)
+	c.QueueChanged(-1)
+	c.WorkersChanged(1)
+	c.PageFetched(200, 100*time.Millisecond, 1000)
+	c.PageFetched(204, 200*time.Millisecond, 500)
+	c.PageFetched(404, 300*time.Millisecond, 10)
+	c.PageFailed("timeout")
+
+	testValue := func(name string, collector prometheus.Collector, expected float64) {
+		if v := testutil.ToFloat64(collector); v != expected {
+			t.Errorf("Expected %s to be %g, got %g", name, expected, v)
+		}
+	}
+
+	testValue("queue", c.queue, 2)
+	testValue("workers", c.workers, 1)
+	testValue("bytes", c.bytes, 1510)
+	testValue("2xx pages", c.pages.WithLabelValues("2xx"), 2)
+	testValue("4xx pages", c.pages.WithLabelValues("4xx"), 1)
+	testValue("timeouts", c.errors.WithLabelValues("timeout"), 1)
+
+	if n := testutil.CollectAndCount(c.latency); n != 1 {
+		t.Errorf("Expected 1 latency histogram, got %d", n)
+	}
+}
+
+func TestNewCrawlRegistered(t *testing.T) {
+	_, reg := createTestCrawl(t)
+	_, err := NewCrawl(reg)
+	if err == nil {
+		t.Errorf("Expected error registering crawl metrics twice")
+	}
+}
+
+func TestGetStatusClass(t *testing.T) {
+	testGetStatusClass := func(status int, expected string) {
+		if class := getStatusClass(status); class != expected {
+			t.Errorf("Expected status %d to have class %q, got %q", status, expected, class)
+		}
+	}
+
+	testGetStatusClass(200, "2xx")
+	testGetStatusClass(301, "3xx")
+	testGetStatusClass(503, "5xx")
+	testGetStatusClass(0, "unknown")
+	testGetStatusClass(999, "unknown")
+}
+
+func TestWriteSummary(t *testing.T) {
+	c, reg := createTestCrawl(t)
+	c.PageFetched(200, 10*time.Millisecond, 100)
+	c.PageFetched(200, 30*time.Millisecond, 100)
+	c.PageFailed("dns")
+
+	var buf bytes.Buffer
+	err := WriteSummary(&buf, reg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	summary := buf.String()
+	for _, line := range []string{
+		`sitemapper_pages_fetched_total{status_class="2xx"} 2`,
+		`sitemapper_downloaded_bytes_total 200`,
+		`sitemapper_fetch_errors_total{type="dns"} 1`,
+		`sitemapper_fetch_duration_seconds count=2 mean=0.02 p50=0.01 p95=0.0475`,
+		`sitemapper_queue_depth 0`,
+	} {
+		if !strings.Contains(summary, line+"\n") {
+			t.Errorf("Expected summary to contain %q, got:\n%s", line, summary)
+		}
+	}
+}
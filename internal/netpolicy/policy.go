@@ -0,0 +1,162 @@
+package netpolicy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// A Policy decides which hosts and addresses may be connected to. Addresses
+// are checked when dialing, after DNS resolution, so the policy also applies
+// to redirects and to hosts whose DNS records change between requests.
+//
+// A host matching DenyHosts is always blocked and a host matching AllowHosts
+// is always allowed. Otherwise, an address in DenyNets is blocked and an
+// address in AllowNets is allowed. Any other loopback, private, shared
+// (carrier-grade NAT), link-local, multicast or unspecified address is
+// blocked. Host patterns match a host
+// exactly, or any subdomain when prefixed with "*.".
+type Policy struct {
+	AllowNets  []*net.IPNet
+	DenyNets   []*net.IPNet
+	AllowHosts []string
+	DenyHosts  []string
+}
+
+// A BlockedError is returned when dialing a host or address the policy does
+// not allow.
+type BlockedError struct {
+	Host string
+	IP   net.IP
+}
+
+func (be *BlockedError) Error() string {
+	if be.IP == nil {
+		return fmt.Sprintf("host %s is blocked by network policy", be.Host)
+	}
+	return fmt.Sprintf("address %s of host %s is blocked by network policy", be.IP, be.Host)
+}
+
+// Client returns an http client whose connections are restricted by the
+// policy. Proxies are not used, as they would be dialed instead of the
+// target.
+func (p *Policy) Client() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = p.DialContext(dialer)
+	return &http.Client{Transport: transport}
+}
+
+// DialContext returns a dial function that uses dialer to connect, but only
+// to hosts and addresses allowed by the policy.
+func (p *Policy) DialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		if matchesHost(p.DenyHosts, host) {
+			return nil, &BlockedError{Host: host}
+		} else if matchesHost(p.AllowHosts, host) {
+			return dialer.DialContext(ctx, network, addr)
+		}
+
+		checked := *dialer
+		checked.Control = func(network, address string, c syscall.RawConn) error {
+			ipStr, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			ip := net.ParseIP(ipStr)
+			if ip == nil || !p.allowsIP(ip) {
+				return &BlockedError{Host: host, IP: ip}
+			}
+			return nil
+		}
+		return checked.DialContext(ctx, network, addr)
+	}
+}
+
+func (p *Policy) allowsIP(ip net.IP) bool {
+	for _, n := range p.DenyNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	for _, n := range p.AllowNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return !isInternalIP(ip)
+}
+
+// sharedNet is the shared address space of carrier-grade NAT, which cloud
+// providers also use for internal services, but which IsPrivate excludes.
+var sharedNet = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func isInternalIP(ip net.IP) bool {
+	return ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		sharedNet.Contains(ip) ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified()
+}
+
+func matchesHost(patterns []string, host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(strings.ToLower(pattern), ".")
+		if strings.HasPrefix(pattern, "*.") {
+			if strings.HasSuffix(host, pattern[1:]) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseNets parses a list of CIDRs, such as "10.0.0.0/8". A single address
+// is treated as a network containing only that address.
+func ParseNets(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", cidr)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
@@ -0,0 +1,135 @@
+package netpolicy
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAllowsIP(t *testing.T) {
+	parseNets := func(cidrs ...string) []*net.IPNet {
+		nets, err := ParseNets(cidrs)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return nets
+	}
+
+	p := &Policy{
+		AllowNets: parseNets("10.1.0.0/16", "127.0.0.2"),
+		DenyNets:  parseNets("10.1.2.0/24", "93.184.216.0/24"),
+	}
+
+	testAllowsIP := func(ipStr string, expected bool) {
+		ip := net.ParseIP(ipStr)
+		if ip == nil {
+			t.Fatalf("Invalid test address %q", ipStr)
+		}
+		if p.allowsIP(ip) != expected {
+			t.Errorf("Expected %s allowed to be %t", ipStr, expected)
+		}
+	}
+
+	testAllowsIP("8.8.8.8", true)
+	testAllowsIP("2001:4860:4860::8888", true)
+	testAllowsIP("93.184.216.34", false)
+	testAllowsIP("127.0.0.1", false)
+	testAllowsIP("127.0.0.2", true)
+	testAllowsIP("::1", false)
+	testAllowsIP("::ffff:127.0.0.1", false)
+	testAllowsIP("10.0.0.1", false)
+	testAllowsIP("10.1.0.1", true)
+	testAllowsIP("10.1.2.1", false)
+	testAllowsIP("172.16.0.1", false)
+	testAllowsIP("192.168.1.1", false)
+	testAllowsIP("100.64.0.1", false)
+	testAllowsIP("100.127.255.254", false)
+	testAllowsIP("::ffff:100.100.100.200", false)
+	testAllowsIP("100.128.0.1", true)
+	testAllowsIP("169.254.169.254", false)
+	testAllowsIP("fe80::1", false)
+	testAllowsIP("fd00::1", false)
+	testAllowsIP("224.0.0.1", false)
+	testAllowsIP("ff02::1", false)
+	testAllowsIP("0.0.0.0", false)
+}
+
+func TestMatchesHost(t *testing.T) {
+	patterns := []string{"foo.com", "*.bar.com", "Baz.com."}
+
+	testMatchesHost := func(host string, expected bool) {
+		if matchesHost(patterns, host) != expected {
+			t.Errorf("Expected %q match to be %t", host, expected)
+		}
+	}
+
+	testMatchesHost("foo.com", true)
+	testMatchesHost("FOO.com.", true)
+	testMatchesHost("www.foo.com", false)
+	testMatchesHost("www.bar.com", true)
+	testMatchesHost("a.b.bar.com", true)
+	testMatchesHost("bar.com", false)
+	testMatchesHost("foobar.com", false)
+	testMatchesHost("baz.com", true)
+}
+
+func TestParseNets(t *testing.T) {
+	nets, err := ParseNets([]string{"10.0.0.0/8", "192.168.1.1", "::1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{"10.0.0.0/8", "192.168.1.1/32", "::1/128"}
+	if len(nets) != len(expected) {
+		t.Fatalf("Expected %d nets, got %d", len(expected), len(nets))
+	}
+	for i, n := range nets {
+		if n.String() != expected[i] {
+			t.Errorf("Expected net %q, got %q", expected[i], n)
+		}
+	}
+
+	_, err = ParseNets([]string{"10.0.0.0/33"})
+	if err == nil {
+		t.Errorf("Expected error for invalid cidr")
+	}
+
+	_, err = ParseNets([]string{"foo"})
+	if err == nil {
+		t.Errorf("Expected error for invalid address")
+	}
+}
+
+func TestClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "http://localhost:1/", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	loopback, err := ParseNets([]string{"127.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	testClient := func(p *Policy, path string, expectBlocked bool) {
+		resp, err := p.Client().Get(server.URL + path)
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		var be *BlockedError
+		if blocked := errors.As(err, &be); blocked != expectBlocked {
+			t.Errorf("Expected %s blocked to be %t with policy %+v, got %v", path, expectBlocked, p, err)
+		}
+	}
+
+	testClient(&Policy{}, "/", true)
+	testClient(&Policy{AllowNets: loopback}, "/", false)
+	testClient(&Policy{AllowHosts: []string{"127.0.0.1"}}, "/", false)
+	testClient(&Policy{AllowNets: loopback, DenyHosts: []string{"127.0.0.1"}}, "/", true)
+	testClient(&Policy{AllowHosts: []string{"127.0.0.1"}}, "/redirect", true)
+}
@@ -0,0 +1,243 @@
+package report
+
+import (
+	"bufio"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jordanpotter/sitemapper/internal/mapper"
+)
+
+// maxSlowestPages is the number of pages listed as the slowest.
+const maxSlowestPages = 10
+
+//go:embed templates static
+var files embed.FS
+
+var funcs = template.FuncMap{
+	"ms":          func(d time.Duration) int64 { return int64(d / time.Millisecond) },
+	"size":        formatSize,
+	"statusClass": statusClass,
+}
+
+var (
+	indexTemplate = template.Must(template.New("").Funcs(funcs).ParseFS(files, "templates/layout.html", "templates/index.html"))
+	pageTemplate  = template.Must(template.New("").Funcs(funcs).ParseFS(files, "templates/layout.html", "templates/page.html"))
+)
+
+// A report is the data rendered into the pages of a report.
+type report struct {
+	Site        string
+	Generated   time.Time
+	Pages       []*page
+	Statuses    []*count
+	Depths      []*count
+	BrokenLinks []*link
+	Redirects   []*page
+	Slowest     []*page
+	NumErrors   int
+}
+
+// A page is a page of the site map, along with its links, the links to it
+// from other pages, and its assets. Path is the path of its detail page.
+type page struct {
+	*mapper.PageMap
+	Path       string
+	Outbound   []*link
+	Inbound    []*link
+	PageAssets []*asset
+}
+
+// A link is a link from Source to Target. Page is the page linked to, if it
+// was crawled.
+type link struct {
+	Source     *page
+	Target     string
+	Page       *page
+	AnchorText string
+}
+
+type asset struct {
+	URL  string
+	Kind string
+}
+
+// A count is the number of pages with a value, such as a status or depth,
+// along with their percentage of every page.
+type count struct {
+	Value   int
+	Count   int
+	Percent float64
+}
+
+// templateData is the data a page of a report is executed with. Root is the
+// path from the page to the root of the report.
+type templateData struct {
+	Root   string
+	Report *report
+	Page   *page
+}
+
+// Write writes a static HTML report of sm to dir, which is created if it does
+// not exist. The report consists of index.html, with a summary of the crawl
+// and a table of every page, a detail page for each page within the pages
+// directory, and the stylesheet and script they share.
+func Write(dir string, sm *mapper.SiteMap) error {
+	r := createReport(sm)
+
+	err := os.MkdirAll(filepath.Join(dir, "pages"), 0755)
+	if err != nil {
+		return err
+	}
+
+	err = writeStatic(dir)
+	if err != nil {
+		return err
+	}
+
+	err = writeTemplate(filepath.Join(dir, "index.html"), indexTemplate, &templateData{Report: r})
+	if err != nil {
+		return err
+	}
+
+	for _, p := range r.Pages {
+		err = writeTemplate(filepath.Join(dir, filepath.FromSlash(p.Path)), pageTemplate, &templateData{Root: "../", Report: r, Page: p})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createReport summarises sm, linking each page to the pages it links to.
+func createReport(sm *mapper.SiteMap) *report {
+	r := &report{Generated: time.Now()}
+	if len(sm.PageMaps) > 0 {
+		r.Site = sm.PageMaps[0].URL.String()
+	}
+
+	pages := make(map[string]*page, len(sm.PageMaps))
+	for i, pm := range sm.PageMaps {
+		p := &page{PageMap: pm, Path: path.Join("pages", strconv.Itoa(i)+".html")}
+		r.Pages = append(r.Pages, p)
+		pages[pm.URL.String()] = p
+	}
+
+	statuses := make(map[int]int)
+	depths := make(map[int]int)
+	for _, p := range r.Pages {
+		statuses[p.StatusCode]++
+		depths[p.Depth]++
+		if p.StatusCode >= 400 {
+			r.NumErrors++
+		}
+		if p.RedirectURL != nil {
+			r.Redirects = append(r.Redirects, p)
+		}
+
+		for _, u := range p.Links {
+			str := u.String()
+			l := &link{Source: p, Target: str, Page: pages[str], AnchorText: p.LinkText[str]}
+			p.Outbound = append(p.Outbound, l)
+			if l.Page != nil {
+				l.Page.Inbound = append(l.Page.Inbound, l)
+				if l.Page.StatusCode >= 400 {
+					r.BrokenLinks = append(r.BrokenLinks, l)
+				}
+			}
+		}
+		for _, u := range p.Assets {
+			p.PageAssets = append(p.PageAssets, &asset{URL: u.String(), Kind: p.AssetKinds[u.String()]})
+		}
+	}
+
+	r.Statuses = createCounts(statuses, len(r.Pages))
+	r.Depths = createCounts(depths, len(r.Pages))
+
+	r.Slowest = append([]*page(nil), r.Pages...)
+	sort.SliceStable(r.Slowest, func(i, j int) bool {
+		return r.Slowest[i].Latency > r.Slowest[j].Latency
+	})
+	if len(r.Slowest) > maxSlowestPages {
+		r.Slowest = r.Slowest[:maxSlowestPages]
+	}
+	return r
+}
+
+// createCounts returns the counts of each value, ordered by value.
+func createCounts(counts map[int]int, total int) []*count {
+	keys := make([]int, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	cs := make([]*count, 0, len(keys))
+	for _, k := range keys {
+		cs = append(cs, &count{
+			Value:   k,
+			Count:   counts[k],
+			Percent: 100 * float64(counts[k]) / float64(total),
+		})
+	}
+	return cs
+}
+
+// writeStatic copies the stylesheet and script of the report to dir.
+func writeStatic(dir string) error {
+	return fs.WalkDir(files, "static", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		b, err := files.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dir, path.Base(name)), b, 0644)
+	})
+}
+
+func writeTemplate(filename string, t *template.Template, data *templateData) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(f)
+	err = t.ExecuteTemplate(bw, "layout", data)
+	if err == nil {
+		err = bw.Flush()
+	}
+	closeErr := f.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// statusClass returns the CSS class of a status code, such as s2xx.
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "sunknown"
+	}
+	return fmt.Sprintf("s%dxx", status/100)
+}
@@ -0,0 +1,125 @@
+package report
+
+import (
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jordanpotter/sitemapper/internal/mapper"
+)
+
+func createTestSiteMap(t *testing.T) *mapper.SiteMap {
+	parse := func(str string) *url.URL {
+		u, err := url.Parse(str)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return u
+	}
+
+	return &mapper.SiteMap{PageMaps: []*mapper.PageMap{
+		{
+			URL:        parse("https://foo.com"),
+			StatusCode: 200,
+			Latency:    20 * time.Millisecond,
+			Links:      []*url.URL{parse("https://foo.com/about"), parse("https://foo.com/old"), parse("https://bar.com")},
+			Assets:     []*url.URL{parse("https://foo.com/logo.png")},
+			Metadata:   &mapper.PageMetadata{Title: "<Foo>"},
+			LinkText:   map[string]string{"https://foo.com/about": "About us"},
+			AssetKinds: map[string]string{"https://foo.com/logo.png": "image"},
+		},
+		{
+			URL:        parse("https://foo.com/about"),
+			StatusCode: 404,
+			Latency:    50 * time.Millisecond,
+			Depth:      1,
+		},
+		{
+			URL:         parse("https://foo.com/old"),
+			StatusCode:  200,
+			Latency:     10 * time.Millisecond,
+			Depth:       1,
+			RedirectURL: parse("https://foo.com/new"),
+		},
+	}}
+}
+
+func TestCreateReport(t *testing.T) {
+	r := createReport(createTestSiteMap(t))
+
+	if r.Site != "https://foo.com" {
+		t.Errorf("Unexpected site %q", r.Site)
+	}
+	if len(r.Pages) != 3 || r.Pages[1].Path != "pages/1.html" {
+		t.Fatalf("Unexpected pages %v", r.Pages)
+	}
+	if r.NumErrors != 1 {
+		t.Errorf("Expected 1 error page, got %d", r.NumErrors)
+	}
+
+	if len(r.Statuses) != 2 || r.Statuses[0].Value != 200 || r.Statuses[0].Count != 2 || r.Statuses[1].Value != 404 {
+		t.Errorf("Unexpected statuses %+v %+v", r.Statuses[0], r.Statuses[1])
+	}
+	if len(r.Depths) != 2 || r.Depths[1].Value != 1 || r.Depths[1].Count != 2 {
+		t.Errorf("Unexpected depths %v", r.Depths)
+	}
+
+	if len(r.BrokenLinks) != 1 || r.BrokenLinks[0].Target != "https://foo.com/about" || r.BrokenLinks[0].AnchorText != "About us" {
+		t.Errorf("Unexpected broken links %v", r.BrokenLinks)
+	}
+	if len(r.Redirects) != 1 || r.Redirects[0].URL.String() != "https://foo.com/old" {
+		t.Errorf("Unexpected redirects %v", r.Redirects)
+	}
+	if len(r.Slowest) != 3 || r.Slowest[0].URL.String() != "https://foo.com/about" || r.Slowest[2].URL.String() != "https://foo.com/old" {
+		t.Errorf("Unexpected slowest pages %v", r.Slowest)
+	}
+
+	root := r.Pages[0]
+	if len(root.Outbound) != 3 || root.Outbound[2].Page != nil {
+		t.Errorf("Unexpected links %v", root.Outbound)
+	}
+	if about := r.Pages[1]; len(about.Inbound) != 1 || about.Inbound[0].Source != root {
+		t.Errorf("Unexpected inbound links %v", about.Inbound)
+	}
+	if len(root.PageAssets) != 1 || root.PageAssets[0].Kind != "image" {
+		t.Errorf("Unexpected assets %v", root.PageAssets)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "report")
+	err := Write(dir, createTestSiteMap(t))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	testCases := []struct {
+		filename string
+		contains []string
+	}{
+		{"index.html", []string{`href="report.css"`, `href="pages/1.html"`, "&lt;Foo&gt;", "https://foo.com/new"}},
+		{"pages/0.html", []string{`href="../report.css"`, `href="../pages/1.html"`, "About us", "not crawled", "image"}},
+		{"pages/1.html", []string{"404", `href="../pages/0.html"`}},
+		{"report.css", []string{".sortable"}},
+		{"report.js", []string{"sortable"}},
+	}
+
+	for _, tc := range testCases {
+		b, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(tc.filename)))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		for _, s := range tc.contains {
+			if !strings.Contains(string(b), s) {
+				t.Errorf("Expected %s to contain %q", tc.filename, s)
+			}
+		}
+		if strings.Contains(string(b), "<Foo>") {
+			t.Errorf("Expected %s to escape the page title", tc.filename)
+		}
+	}
+}
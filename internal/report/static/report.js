@@ -0,0 +1,52 @@
+"use strict";
+
+// Sorts the rows of a sortable table when a column header is clicked,
+// numerically for columns with a data-type of number. Cells with a
+// data-value are sorted by it rather than by their text.
+document.querySelectorAll("table.sortable").forEach(function (table) {
+	var headers = table.querySelectorAll("thead th");
+	headers.forEach(function (th, column) {
+		th.addEventListener("click", function () {
+			var ascending = th.getAttribute("aria-sort") !== "ascending";
+			headers.forEach(function (other) {
+				other.removeAttribute("aria-sort");
+			});
+			th.setAttribute("aria-sort", ascending ? "ascending" : "descending");
+
+			var numeric = th.dataset.type === "number";
+			var value = function (row) {
+				var cell = row.cells[column];
+				var v = cell.dataset.value !== undefined ? cell.dataset.value : cell.textContent.trim();
+				if (numeric) {
+					var n = parseFloat(v);
+					return isNaN(n) ? -Infinity : n;
+				}
+				return v.toLowerCase();
+			};
+
+			var tbody = table.tBodies[0];
+			var rows = Array.prototype.slice.call(tbody.rows);
+			rows.sort(function (a, b) {
+				var va = value(a);
+				var vb = value(b);
+				var cmp = va < vb ? -1 : va > vb ? 1 : 0;
+				return ascending ? cmp : -cmp;
+			});
+			rows.forEach(function (row) {
+				tbody.appendChild(row);
+			});
+		});
+	});
+});
+
+// Hides the rows of a table that do not contain the text typed into its
+// filter.
+document.querySelectorAll("input.filter").forEach(function (input) {
+	var table = document.getElementById(input.dataset.table);
+	input.addEventListener("input", function () {
+		var text = input.value.toLowerCase();
+		Array.prototype.forEach.call(table.tBodies[0].rows, function (row) {
+			row.hidden = text !== "" && row.textContent.toLowerCase().indexOf(text) === -1;
+		});
+	});
+});
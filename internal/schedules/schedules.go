@@ -0,0 +1,452 @@
+package schedules
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/jordanpotter/sitemapper/internal/crawlconfig"
+	"github.com/jordanpotter/sitemapper/internal/jobs"
+)
+
+// DefaultKeep and MaxKeep bound the number of runs whose jobs are kept for
+// each schedule.
+const (
+	DefaultKeep = 10
+	MaxKeep     = 100
+)
+
+var (
+	// ErrScheduleNotFound is returned when no schedule exists with the
+	// requested id.
+	ErrScheduleNotFound = errors.New("schedule not found")
+
+	// ErrInvalidCron is returned when creating a schedule with a malformed
+	// cron expression.
+	ErrInvalidCron = errors.New("invalid cron expression")
+
+	// ErrInvalidKeep is returned when creating a schedule that keeps fewer
+	// than 1 or more than MaxKeep runs.
+	ErrInvalidKeep = fmt.Errorf("runs kept must be between 1 and %d", MaxKeep)
+
+	errJobMissing = errors.New("job of run no longer exists")
+)
+
+// A Schedule is a crawl run repeatedly at the times matched by a cron
+// expression. Only one run of a schedule is in progress at once, and a run
+// that is due while the previous run is still in progress is skipped.
+type Schedule struct {
+	ID      string              `json:"id"`
+	Cron    string              `json:"cron"`
+	Keep    int                 `json:"keep"`
+	Config  *crawlconfig.Config `json:"config"`
+	Owner   string              `json:"owner,omitempty"`
+	Created time.Time           `json:"created"`
+
+	NextRun     *time.Time `json:"nextRun,omitempty"`
+	LastRun     *time.Time `json:"lastRun,omitempty"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	LastFailure *time.Time `json:"lastFailure,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	Skipped     int        `json:"skipped"`
+
+	// Runs lists the most recent runs, oldest first, up to Keep runs.
+	Runs []*Run `json:"runs"`
+}
+
+// A Run is a crawl job started by a schedule. A run that could not be
+// started has no job id.
+type Run struct {
+	JobID    string      `json:"jobId,omitempty"`
+	Status   jobs.Status `json:"status"`
+	Error    string      `json:"error,omitempty"`
+	Started  time.Time   `json:"started"`
+	Finished *time.Time  `json:"finished,omitempty"`
+}
+
+func (s *Schedule) copy() *Schedule {
+	c := *s
+	c.Runs = make([]*Run, 0, len(s.Runs))
+	for _, run := range s.Runs {
+		r := *run
+		c.Runs = append(c.Runs, &r)
+	}
+	return &c
+}
+
+// finishRun records the final status of the job of a run.
+func (s *Schedule) finishRun(run *Run, js *jobs.JobStatus) {
+	finished := time.Now()
+	if js.Finished != nil {
+		finished = *js.Finished
+	}
+
+	run.Status = js.Status
+	run.Error = js.Error
+	run.Finished = &finished
+	if js.Status == jobs.Done {
+		s.LastSuccess = &finished
+		return
+	}
+
+	s.LastFailure = &finished
+	s.LastError = js.Error
+	if s.LastError == "" {
+		s.LastError = "job " + string(js.Status)
+	}
+}
+
+// ParseCron parses a standard cron expression of five fields, or a
+// descriptor such as @daily, optionally preceded by CRON_TZ= and a time zone.
+// Times are in UTC otherwise.
+func ParseCron(expr string) (cron.Schedule, error) {
+	c, err := cron.ParseStandard(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCron, err)
+	}
+	return c, nil
+}
+
+// StartFunc starts the job of a run of a schedule.
+type StartFunc func(s *Schedule) (*jobs.Job, error)
+
+// A Scheduler starts the runs of schedules as they fall due.
+type Scheduler struct {
+	store Store
+	jobs  *jobs.Manager
+	start StartFunc
+	parse func(expr string) (cron.Schedule, error)
+
+	m        sync.Mutex
+	entries  map[string]*entry
+	closed   bool
+	watchers sync.WaitGroup
+}
+
+type entry struct {
+	schedule *Schedule
+	cron     cron.Schedule
+	job      *jobs.Job
+	stop     chan struct{}
+}
+
+// NewScheduler returns a scheduler that starts runs with start and deletes
+// the jobs of runs no longer kept from mgr. Schedules are saved to store, or
+// kept in memory if store is nil. Schedules in the store resume running, and
+// runs that were in progress when the process stopped are updated from the
+// status of their jobs.
+func NewScheduler(store Store, mgr *jobs.Manager, start StartFunc) (*Scheduler, error) {
+	if store == nil {
+		store = newMemoryStore()
+	}
+
+	sc := &Scheduler{
+		store:   store,
+		jobs:    mgr,
+		start:   start,
+		parse:   ParseCron,
+		entries: make(map[string]*entry),
+	}
+
+	saved, err := store.Schedules()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range saved {
+		c, err := sc.parse(s.Cron)
+		if err != nil {
+			return nil, err
+		}
+
+		err = sc.reconcile(s)
+		if err != nil {
+			return nil, err
+		}
+
+		e := &entry{schedule: s, cron: c, stop: make(chan struct{})}
+		sc.entries[s.ID] = e
+		go sc.loop(e)
+	}
+	return sc, nil
+}
+
+// reconcile records the final status of runs that had not finished when the
+// process stopped.
+func (sc *Scheduler) reconcile(s *Schedule) error {
+	changed := false
+	for _, run := range s.Runs {
+		if run.Status.IsFinished() {
+			continue
+		}
+
+		js, err := sc.jobs.Status(run.JobID)
+		if err == jobs.ErrJobNotFound {
+			js = &jobs.JobStatus{Status: jobs.Failed, Error: errJobMissing.Error()}
+		} else if err != nil {
+			return err
+		}
+		if js.Status.IsFinished() {
+			s.finishRun(run, js)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	return sc.store.SaveSchedule(s)
+}
+
+// Create saves a schedule and starts running it. The id, creation time and
+// run history of s are set by the scheduler.
+func (sc *Scheduler) Create(s *Schedule) (*Schedule, error) {
+	c, err := sc.parse(s.Cron)
+	if err != nil {
+		return nil, err
+	} else if s.Keep < 1 || s.Keep > MaxKeep {
+		return nil, ErrInvalidKeep
+	}
+
+	id, err := createID()
+	if err != nil {
+		return nil, err
+	}
+
+	s = s.copy()
+	s.ID = id
+	s.Created = time.Now()
+	s.Runs = []*Run{}
+	next := c.Next(time.Now().UTC())
+	s.NextRun = &next
+
+	err = sc.store.SaveSchedule(s)
+	if err != nil {
+		return nil, err
+	}
+
+	created := s.copy()
+	e := &entry{schedule: s, cron: c, stop: make(chan struct{})}
+	sc.m.Lock()
+	sc.entries[id] = e
+	sc.m.Unlock()
+
+	go sc.loop(e)
+	return created, nil
+}
+
+// Get returns the schedule with the specified id.
+func (sc *Scheduler) Get(id string) (*Schedule, error) {
+	sc.m.Lock()
+	defer sc.m.Unlock()
+
+	e, ok := sc.entries[id]
+	if !ok {
+		return nil, ErrScheduleNotFound
+	}
+	return e.schedule.copy(), nil
+}
+
+// List returns every schedule, oldest first.
+func (sc *Scheduler) List() []*Schedule {
+	sc.m.Lock()
+	defer sc.m.Unlock()
+
+	schedules := make([]*Schedule, 0, len(sc.entries))
+	for _, e := range sc.entries {
+		schedules = append(schedules, e.schedule.copy())
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		if schedules[i].Created.Equal(schedules[j].Created) {
+			return schedules[i].ID < schedules[j].ID
+		}
+		return schedules[i].Created.Before(schedules[j].Created)
+	})
+	return schedules
+}
+
+// Delete stops and deletes the schedule with the specified id. A run in
+// progress is left to finish, and the jobs of past runs are kept.
+func (sc *Scheduler) Delete(id string) error {
+	sc.m.Lock()
+	e, ok := sc.entries[id]
+	if ok {
+		delete(sc.entries, id)
+		if !sc.closed {
+			close(e.stop)
+		}
+	}
+	sc.m.Unlock()
+
+	if !ok {
+		return ErrScheduleNotFound
+	}
+	return sc.store.DeleteSchedule(id)
+}
+
+// Retains reports whether js is the job of a run kept by a schedule, so
+// should not be pruned.
+func (sc *Scheduler) Retains(js *jobs.JobStatus) bool {
+	sc.m.Lock()
+	defer sc.m.Unlock()
+
+	for _, e := range sc.entries {
+		for _, run := range e.schedule.Runs {
+			if run.JobID == js.ID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Stop stops starting runs, then waits for the runs in progress to be
+// recorded. The jobs of runs in progress must finish for Stop to return.
+func (sc *Scheduler) Stop() {
+	sc.m.Lock()
+	if !sc.closed {
+		sc.closed = true
+		for _, e := range sc.entries {
+			close(e.stop)
+		}
+	}
+	sc.m.Unlock()
+
+	sc.watchers.Wait()
+}
+
+func (sc *Scheduler) loop(e *entry) {
+	for {
+		sc.m.Lock()
+		next := e.cron.Next(time.Now().UTC())
+		e.schedule.NextRun = &next
+		sc.m.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+			sc.run(e)
+		case <-e.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// run starts a run of a schedule, unless the previous run is still in
+// progress. The job is started without holding sc.m, as starting it may
+// block on quotas and the job manager.
+func (sc *Scheduler) run(e *entry) {
+	sc.m.Lock()
+	s := e.schedule
+	if sc.closed || sc.entries[s.ID] != e {
+		sc.m.Unlock()
+		return
+	}
+
+	if e.job != nil {
+		s.Skipped++
+		log.Printf("Skipped run of schedule %s, as job %s is still in progress", s.ID, e.job.ID)
+		sc.save(s)
+		sc.m.Unlock()
+		return
+	}
+
+	// Stop waits for the run to be recorded once its job has started.
+	now := time.Now()
+	run := &Run{Status: jobs.Queued, Started: now}
+	started := s.copy()
+	sc.watchers.Add(1)
+	sc.m.Unlock()
+
+	j, err := sc.start(started)
+
+	sc.m.Lock()
+	defer sc.m.Unlock()
+
+	if err == jobs.ErrShuttingDown {
+		sc.watchers.Done()
+		return
+	} else if err != nil {
+		sc.watchers.Done()
+	} else {
+		run.JobID = j.ID
+		e.job = j
+		go sc.watch(e, run, j)
+	}
+
+	// A schedule deleted while its job was starting keeps the jobs of its
+	// past runs.
+	if sc.entries[s.ID] != e {
+		return
+	}
+
+	s.LastRun = &now
+	if err != nil {
+		run.Status = jobs.Failed
+		run.Error = err.Error()
+		run.Finished = &now
+		s.LastFailure = &now
+		s.LastError = err.Error()
+	}
+	sc.addRun(s, run)
+	sc.save(s)
+}
+
+// watch records the final status of a run once its job has finished.
+func (sc *Scheduler) watch(e *entry, run *Run, j *jobs.Job) {
+	defer sc.watchers.Done()
+	<-j.Done()
+	js := j.Status()
+
+	sc.m.Lock()
+	defer sc.m.Unlock()
+
+	e.job = nil
+	e.schedule.finishRun(run, js)
+	if sc.entries[e.schedule.ID] == e {
+		sc.save(e.schedule)
+	}
+}
+
+// addRun appends a run to the history of a schedule, deleting the jobs of
+// runs beyond those kept. It must be called with sc.m held.
+func (sc *Scheduler) addRun(s *Schedule, run *Run) {
+	s.Runs = append(s.Runs, run)
+	for len(s.Runs) > s.Keep {
+		old := s.Runs[0]
+		s.Runs = s.Runs[1:]
+		if old.JobID == "" {
+			continue
+		}
+
+		err := sc.jobs.Delete(old.JobID)
+		if err != nil && err != jobs.ErrJobNotFound {
+			log.Printf("Failed to delete job %s of schedule %s: %v", old.JobID, s.ID, err)
+		}
+	}
+}
+
+// save saves a schedule to the store. A failure is logged rather than
+// returned, as the schedule keeps running.
+func (sc *Scheduler) save(s *Schedule) {
+	err := sc.store.SaveSchedule(s)
+	if err != nil {
+		log.Printf("Failed to save schedule %s: %v", s.ID, err)
+	}
+}
+
+func createID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,324 @@
+package schedules
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/jordanpotter/sitemapper/internal/crawlconfig"
+	"github.com/jordanpotter/sitemapper/internal/jobs"
+	"github.com/jordanpotter/sitemapper/internal/mapper"
+)
+
+// every is a schedule falling due at a fixed interval.
+type every time.Duration
+
+func (d every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(d))
+}
+
+func createTestScheduler(t *testing.T, handler http.HandlerFunc) (*Scheduler, *jobs.Manager) {
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	mgr, err := jobs.NewManager(1, 10, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	sc, err := NewScheduler(nil, mgr, func(s *Schedule) (*jobs.Job, error) {
+		return mgr.Start(u, mapper.DefaultOptions(1), "")
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sc.parse = func(expr string) (cron.Schedule, error) {
+		return every(20 * time.Millisecond), nil
+	}
+	return sc, mgr
+}
+
+func createTestSchedule(t *testing.T, sc *Scheduler, keep int) *Schedule {
+	s, err := sc.Create(&Schedule{
+		Cron:   "* * * * *",
+		Keep:   keep,
+		Config: &crawlconfig.Config{Seeds: []string{"https://foo.com"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return s
+}
+
+func waitForSchedule(t *testing.T, sc *Scheduler, id string, cond func(s *Schedule) bool) *Schedule {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s, err := sc.Get(id)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		} else if cond(s) {
+			return s
+		} else if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for schedule %+v", s)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func countFinished(s *Schedule) int {
+	n := 0
+	for _, run := range s.Runs {
+		if run.Status.IsFinished() {
+			n++
+		}
+	}
+	return n
+}
+
+func TestParseCron(t *testing.T) {
+	for _, expr := range []string{"0 2 * * *", "*/15 * * * 1-5", "@daily", "CRON_TZ=UTC 30 6 * * *"} {
+		_, err := ParseCron(expr)
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", expr, err)
+		}
+	}
+
+	for _, expr := range []string{"", "61 * * * *", "* * * *", "@fortnightly"} {
+		_, err := ParseCron(expr)
+		if !errors.Is(err, ErrInvalidCron) {
+			t.Errorf("Expected error %v for %q, got %v", ErrInvalidCron, expr, err)
+		}
+	}
+}
+
+func TestSchedulerCreateInvalid(t *testing.T) {
+	mgr, err := jobs.NewManager(1, 10, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sc, err := NewScheduler(nil, mgr, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err = sc.Create(&Schedule{Cron: "every night", Keep: 1})
+	if !errors.Is(err, ErrInvalidCron) {
+		t.Errorf("Expected error %v, got %v", ErrInvalidCron, err)
+	}
+
+	_, err = sc.Create(&Schedule{Cron: "@daily", Keep: 0})
+	if err != ErrInvalidKeep {
+		t.Errorf("Expected error %v, got %v", ErrInvalidKeep, err)
+	}
+
+	if len(sc.List()) != 0 {
+		t.Errorf("Expected no schedules to be created")
+	}
+}
+
+func TestSchedulerRuns(t *testing.T) {
+	sc, mgr := createTestScheduler(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html></html>"))
+	})
+	defer sc.Stop()
+
+	s := createTestSchedule(t, sc, 1)
+	if s.ID == "" || s.NextRun == nil || len(s.Runs) != 0 {
+		t.Fatalf("Unexpected created schedule %+v", s)
+	}
+
+	first := waitForSchedule(t, sc, s.ID, func(s *Schedule) bool { return countFinished(s) == 1 })
+	firstJobID := first.Runs[0].JobID
+	if first.Runs[0].Status != jobs.Done || first.LastSuccess == nil || first.LastFailure != nil {
+		t.Errorf("Expected run to succeed, got %+v", first.Runs[0])
+	}
+
+	waitForSchedule(t, sc, s.ID, func(s *Schedule) bool { return s.Runs[0].JobID != firstJobID })
+	_, err := mgr.Status(firstJobID)
+	if err != jobs.ErrJobNotFound {
+		t.Errorf("Expected job of run no longer kept to be deleted, got %v", err)
+	}
+}
+
+func TestSchedulerSkipsOverlappingRuns(t *testing.T) {
+	release := make(chan struct{})
+	sc, _ := createTestScheduler(t, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("<html></html>"))
+	})
+	defer sc.Stop()
+
+	s := createTestSchedule(t, sc, 5)
+	s = waitForSchedule(t, sc, s.ID, func(s *Schedule) bool { return s.Skipped >= 2 })
+	if len(s.Runs) != 1 {
+		t.Errorf("Expected a single run while it is in progress, got %d", len(s.Runs))
+	}
+
+	close(release)
+	waitForSchedule(t, sc, s.ID, func(s *Schedule) bool { return countFinished(s) >= 1 })
+}
+
+func TestSchedulerStartFailure(t *testing.T) {
+	mgr, err := jobs.NewManager(1, 10, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	startErr := errors.New("quota exceeded")
+	sc, err := NewScheduler(nil, mgr, func(s *Schedule) (*jobs.Job, error) {
+		return nil, startErr
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sc.parse = func(expr string) (cron.Schedule, error) {
+		return every(10 * time.Millisecond), nil
+	}
+	defer sc.Stop()
+
+	s := createTestSchedule(t, sc, 2)
+	s = waitForSchedule(t, sc, s.ID, func(s *Schedule) bool { return len(s.Runs) == 2 })
+	if s.LastFailure == nil || s.LastError != startErr.Error() || s.LastSuccess != nil {
+		t.Errorf("Expected schedule to record the failure, got %+v", s)
+	} else if s.Runs[0].Status != jobs.Failed || s.Runs[0].JobID != "" {
+		t.Errorf("Expected failed run without a job, got %+v", s.Runs[0])
+	}
+}
+
+func TestSchedulerBlockedStart(t *testing.T) {
+	mgr, err := jobs.NewManager(1, 10, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	starting := make(chan struct{}, 1)
+	unblock := make(chan struct{})
+	startErr := errors.New("start failed")
+	sc, err := NewScheduler(nil, mgr, func(s *Schedule) (*jobs.Job, error) {
+		select {
+		case starting <- struct{}{}:
+		default:
+		}
+		<-unblock
+		return nil, startErr
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sc.parse = func(expr string) (cron.Schedule, error) {
+		return every(10 * time.Millisecond), nil
+	}
+	defer sc.Stop()
+
+	s := createTestSchedule(t, sc, 2)
+	select {
+	case <-starting:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected a run to start")
+	}
+
+	// Schedules can be listed, created and deleted while a job is starting.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sc.List()
+		other := createTestSchedule(t, sc, 1)
+		sc.Delete(other.ID)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected schedules not to be blocked by a starting job")
+	}
+
+	close(unblock)
+	s = waitForSchedule(t, sc, s.ID, func(s *Schedule) bool { return len(s.Runs) >= 1 })
+	if s.Runs[0].Status != jobs.Failed || s.LastError != startErr.Error() {
+		t.Errorf("Expected failed run to be recorded, got %+v", s)
+	}
+}
+
+func TestSchedulerDelete(t *testing.T) {
+	sc, _ := createTestScheduler(t, func(w http.ResponseWriter, r *http.Request) {})
+	defer sc.Stop()
+
+	s := createTestSchedule(t, sc, 1)
+	err := sc.Delete(s.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err = sc.Get(s.ID)
+	if err != ErrScheduleNotFound {
+		t.Errorf("Expected error %v, got %v", ErrScheduleNotFound, err)
+	}
+	err = sc.Delete(s.ID)
+	if err != ErrScheduleNotFound {
+		t.Errorf("Expected error %v, got %v", ErrScheduleNotFound, err)
+	}
+}
+
+func TestNewSchedulerResumes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	mgr, err := jobs.NewManager(1, 10, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	j, err := mgr.Start(u, mapper.DefaultOptions(1), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	<-j.Done()
+
+	store := newMemoryStore()
+	started := time.Now()
+	err = store.SaveSchedule(&Schedule{
+		ID:   "nightly",
+		Cron: "@daily",
+		Keep: 5,
+		Runs: []*Run{
+			{JobID: j.ID, Status: jobs.Running, Started: started},
+			{JobID: "gone", Status: jobs.Queued, Started: started},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	sc, err := NewScheduler(store, mgr, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer sc.Stop()
+
+	s, err := sc.Get("nightly")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if s.Runs[0].Status != jobs.Done || s.Runs[1].Status != jobs.Failed {
+		t.Errorf("Expected runs to be updated from their jobs, got %+v and %+v", s.Runs[0], s.Runs[1])
+	} else if s.LastSuccess == nil || s.LastFailure == nil || s.LastError != errJobMissing.Error() {
+		t.Errorf("Unexpected schedule %+v", s)
+	}
+
+	if !sc.Retains(&jobs.JobStatus{ID: j.ID}) {
+		t.Errorf("Expected job of run to be retained")
+	} else if sc.Retains(&jobs.JobStatus{ID: "other"}) {
+		t.Errorf("Expected other job not to be retained")
+	}
+}
@@ -0,0 +1,50 @@
+package schedules
+
+import (
+	"sync"
+)
+
+// A Store persists schedules, so that they keep running after the process
+// has restarted.
+type Store interface {
+	SaveSchedule(s *Schedule) error
+	Schedules() ([]*Schedule, error)
+	DeleteSchedule(id string) error
+}
+
+// memoryStore keeps schedules only for the lifetime of the process.
+type memoryStore struct {
+	m         sync.Mutex
+	schedules map[string]*Schedule
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{schedules: make(map[string]*Schedule)}
+}
+
+func (ms *memoryStore) SaveSchedule(s *Schedule) error {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	ms.schedules[s.ID] = s.copy()
+	return nil
+}
+
+func (ms *memoryStore) Schedules() ([]*Schedule, error) {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	schedules := make([]*Schedule, 0, len(ms.schedules))
+	for _, s := range ms.schedules {
+		schedules = append(schedules, s.copy())
+	}
+	return schedules, nil
+}
+
+func (ms *memoryStore) DeleteSchedule(id string) error {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	delete(ms.schedules, id)
+	return nil
+}
@@ -0,0 +1,168 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/jordanpotter/sitemapper/internal/jobs"
+	"github.com/jordanpotter/sitemapper/internal/schedules"
+)
+
+var (
+	statusesBucket  = []byte("statuses")
+	resultsBucket   = []byte("results")
+	schedulesBucket = []byte("schedules")
+)
+
+// A BoltStore saves the status and result of each job, along with each
+// schedule, in a BoltDB database.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore returns a store saving jobs in the database file at path,
+// which is created if it does not exist. The store must be closed once it is
+// no longer needed.
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{statusesBucket, resultsBucket, schedulesBucket} {
+			_, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// Close closes the database.
+func (bs *BoltStore) Close() error {
+	return bs.db.Close()
+}
+
+func (bs *BoltStore) SaveStatus(js *jobs.JobStatus) error {
+	b, err := json.Marshal(js)
+	if err != nil {
+		return err
+	}
+
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(statusesBucket).Put([]byte(js.ID), b)
+	})
+}
+
+func (bs *BoltStore) Status(id string) (*jobs.JobStatus, error) {
+	var js *jobs.JobStatus
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(statusesBucket).Get([]byte(id))
+		if b == nil {
+			return jobs.ErrJobNotFound
+		}
+		return json.Unmarshal(b, &js)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return js, nil
+}
+
+func (bs *BoltStore) Statuses() ([]*jobs.JobStatus, error) {
+	var statuses []*jobs.JobStatus
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(statusesBucket).ForEach(func(k, v []byte) error {
+			var js jobs.JobStatus
+			err := json.Unmarshal(v, &js)
+			if err != nil {
+				return err
+			}
+			statuses = append(statuses, &js)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+func (bs *BoltStore) SaveResult(id string, result []byte) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(resultsBucket).Put([]byte(id), result)
+	})
+}
+
+func (bs *BoltStore) Result(id string) ([]byte, error) {
+	var result []byte
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(resultsBucket).Get([]byte(id))
+		if b == nil {
+			return jobs.ErrResultNotReady
+		}
+
+		// Values are only valid for the life of the transaction.
+		result = append([]byte(nil), b...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (bs *BoltStore) Delete(id string) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(resultsBucket).Delete([]byte(id))
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(statusesBucket).Delete([]byte(id))
+	})
+}
+
+func (bs *BoltStore) SaveSchedule(s *schedules.Schedule) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(schedulesBucket).Put([]byte(s.ID), b)
+	})
+}
+
+func (bs *BoltStore) Schedules() ([]*schedules.Schedule, error) {
+	var saved []*schedules.Schedule
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(schedulesBucket).ForEach(func(k, v []byte) error {
+			var s schedules.Schedule
+			err := json.Unmarshal(v, &s)
+			if err != nil {
+				return err
+			}
+			saved = append(saved, &s)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+func (bs *BoltStore) DeleteSchedule(id string) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(schedulesBucket).Delete([]byte(id))
+	})
+}
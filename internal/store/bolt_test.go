@@ -0,0 +1,34 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestBoltStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.db")
+	bs, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testStore(t, bs)
+	testScheduleStore(t, bs)
+
+	err = bs.Close()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	bs, err = NewBoltStore(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer bs.Close()
+
+	statuses, err := bs.Statuses()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if len(statuses) != 1 || statuses[0].ID != "def456" {
+		t.Errorf("Expected status to survive reopening, got %v", statuses)
+	}
+}
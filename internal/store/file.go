@@ -0,0 +1,208 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/jordanpotter/sitemapper/internal/jobs"
+	"github.com/jordanpotter/sitemapper/internal/schedules"
+)
+
+var validIDRegexp = regexp.MustCompile(`^[0-9A-Za-z_-]+$`)
+
+// A FileStore saves the status and result of each job, along with each
+// schedule, as JSON files within a directory.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore returns a store saving jobs within dir, which is created if
+// it does not exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	fst := &FileStore{dir: dir}
+	for _, sub := range []string{"statuses", "results", "schedules"} {
+		err := os.MkdirAll(filepath.Join(dir, sub), 0700)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fst, nil
+}
+
+func (fst *FileStore) SaveStatus(js *jobs.JobStatus) error {
+	b, err := json.Marshal(js)
+	if err != nil {
+		return err
+	}
+	return fst.writeFile("statuses", js.ID, b)
+}
+
+func (fst *FileStore) Status(id string) (*jobs.JobStatus, error) {
+	b, err := fst.readFile("statuses", id)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, jobs.ErrJobNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var js jobs.JobStatus
+	err = json.Unmarshal(b, &js)
+	if err != nil {
+		return nil, err
+	}
+	return &js, nil
+}
+
+func (fst *FileStore) Statuses() ([]*jobs.JobStatus, error) {
+	ids, err := fst.ids("statuses")
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*jobs.JobStatus, 0, len(ids))
+	for _, id := range ids {
+		js, err := fst.Status(id)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, js)
+	}
+	return statuses, nil
+}
+
+func (fst *FileStore) SaveResult(id string, result []byte) error {
+	return fst.writeFile("results", id, result)
+}
+
+func (fst *FileStore) Result(id string) ([]byte, error) {
+	b, err := fst.readFile("results", id)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, jobs.ErrResultNotReady
+	}
+	return b, err
+}
+
+func (fst *FileStore) Delete(id string) error {
+	for _, sub := range []string{"results", "statuses"} {
+		path, err := fst.path(sub, id)
+		if err != nil {
+			return err
+		}
+
+		err = os.Remove(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fst *FileStore) SaveSchedule(s *schedules.Schedule) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return fst.writeFile("schedules", s.ID, b)
+}
+
+func (fst *FileStore) Schedules() ([]*schedules.Schedule, error) {
+	ids, err := fst.ids("schedules")
+	if err != nil {
+		return nil, err
+	}
+
+	saved := make([]*schedules.Schedule, 0, len(ids))
+	for _, id := range ids {
+		b, err := fst.readFile("schedules", id)
+		if err != nil {
+			return nil, err
+		}
+
+		var s schedules.Schedule
+		err = json.Unmarshal(b, &s)
+		if err != nil {
+			return nil, err
+		}
+		saved = append(saved, &s)
+	}
+	return saved, nil
+}
+
+func (fst *FileStore) DeleteSchedule(id string) error {
+	path, err := fst.path("schedules", id)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// ids returns the ids of the JSON files within a subdirectory.
+func (fst *FileStore) ids(sub string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(fst.dir, sub))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		id := strings.TrimSuffix(entry.Name(), ".json")
+		if entry.IsDir() || id == entry.Name() || !validIDRegexp.MatchString(id) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (fst *FileStore) path(sub, id string) (string, error) {
+	if !validIDRegexp.MatchString(id) {
+		return "", fmt.Errorf("invalid id %q", id)
+	}
+	return filepath.Join(fst.dir, sub, id+".json"), nil
+}
+
+func (fst *FileStore) readFile(sub, id string) ([]byte, error) {
+	path, err := fst.path(sub, id)
+	if err != nil {
+		return nil, fs.ErrNotExist
+	}
+	return os.ReadFile(path)
+}
+
+// writeFile replaces a file by renaming a temporary file over it, so that a
+// crash never leaves a partially written file behind.
+func (fst *FileStore) writeFile(sub, id string, b []byte) error {
+	path, err := fst.path(sub, id)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
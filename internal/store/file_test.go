@@ -0,0 +1,26 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/jordanpotter/sitemapper/internal/jobs"
+)
+
+func TestFileStore(t *testing.T) {
+	fst, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testStore(t, fst)
+	testScheduleStore(t, fst)
+
+	_, err = fst.Status("../secret")
+	if err != jobs.ErrJobNotFound {
+		t.Errorf("Expected error %v, got %v", jobs.ErrJobNotFound, err)
+	}
+
+	err = fst.SaveStatus(&jobs.JobStatus{ID: "../secret"})
+	if err == nil {
+		t.Errorf("Expected error saving invalid id")
+	}
+}
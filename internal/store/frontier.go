@@ -0,0 +1,176 @@
+package store
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/jordanpotter/sitemapper/internal/mapper"
+)
+
+var (
+	seenBucket   = []byte("seen")
+	queueBucket  = []byte("queue")
+	poppedBucket = []byte("popped")
+)
+
+// A BoltFrontier keeps the queue of pages to crawl, along with every page
+// queued or visited, in a BoltDB database, so that memory does not grow with
+// the size of the site.
+type BoltFrontier struct {
+	db *bolt.DB
+}
+
+// NewBoltFrontier returns a frontier kept in the database file at path,
+// which is created if it does not exist. Any frontier already in the file is
+// cleared. Writes are not synced to disk, as the frontier is only needed
+// while the crawl runs. The frontier must be closed once the crawl has
+// finished.
+func NewBoltFrontier(path string) (*BoltFrontier, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	db.NoSync = true
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{seenBucket, queueBucket, poppedBucket} {
+			err := tx.DeleteBucket(name)
+			if err != nil && err != bolt.ErrBucketNotFound {
+				return err
+			}
+			_, err = tx.CreateBucket(name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltFrontier{db: db}, nil
+}
+
+// Close closes the database.
+func (bf *BoltFrontier) Close() error {
+	return bf.db.Close()
+}
+
+// Queue appends u to the queue, keyed by a sequence number so that pages are
+// popped in the order they were queued.
+func (bf *BoltFrontier) Queue(u *url.URL, depth int) (bool, error) {
+	var added bool
+	err := bf.db.Update(func(tx *bolt.Tx) error {
+		key := []byte(u.String())
+		seen := tx.Bucket(seenBucket)
+		if seen.Get(key) != nil {
+			return nil
+		}
+		err := seen.Put(key, []byte{})
+		if err != nil {
+			return err
+		}
+
+		queue := tx.Bucket(queueBucket)
+		seq, err := queue.NextSequence()
+		if err != nil {
+			return err
+		}
+		var seqKey [8]byte
+		binary.BigEndian.PutUint64(seqKey[:], seq)
+		added = true
+		return queue.Put(seqKey[:], encodeQueuedURL(u, depth))
+	})
+	return added, err
+}
+
+func (bf *BoltFrontier) Pop() (*mapper.QueuedURL, error) {
+	var qu *mapper.QueuedURL
+	err := bf.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(queueBucket).Cursor()
+		k, v := c.First()
+		if k == nil {
+			return nil
+		}
+
+		var err error
+		qu, err = decodeQueuedURL(v)
+		if err != nil {
+			return err
+		}
+		err = c.Delete()
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(poppedBucket).Put([]byte(qu.URL.String()), v)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return qu, nil
+}
+
+func (bf *BoltFrontier) Visit(u *url.URL) error {
+	return bf.db.Update(func(tx *bolt.Tx) error {
+		key := []byte(u.String())
+		err := tx.Bucket(seenBucket).Put(key, []byte{})
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(poppedBucket).Delete(key)
+	})
+}
+
+func (bf *BoltFrontier) Pending() ([]*mapper.QueuedURL, error) {
+	var pending []*mapper.QueuedURL
+	err := bf.db.View(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{queueBucket, poppedBucket} {
+			err := tx.Bucket(name).ForEach(func(k, v []byte) error {
+				qu, err := decodeQueuedURL(v)
+				if err != nil {
+					return err
+				}
+				pending = append(pending, qu)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pending, nil
+}
+
+// encodeQueuedURL returns the depth and url of a queued page, separated by a
+// space.
+func encodeQueuedURL(u *url.URL, depth int) []byte {
+	return []byte(strconv.Itoa(depth) + " " + u.String())
+}
+
+func decodeQueuedURL(b []byte) (*mapper.QueuedURL, error) {
+	fields := strings.SplitN(string(b), " ", 2)
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("invalid queued url %q", b)
+	}
+
+	depth, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(fields[1])
+	if err != nil {
+		return nil, err
+	}
+	return &mapper.QueuedURL{URL: u, Depth: depth}, nil
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"net/url"
+	"path/filepath"
+	"testing"
+)
+
+func TestBoltFrontier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "frontier.db")
+	bf, err := NewBoltFrontier(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var urls []*url.URL
+	for _, str := range []string{"https://foo.com", "https://foo.com/a", "https://foo.com/b"} {
+		u, err := url.Parse(str)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		urls = append(urls, u)
+	}
+
+	for i, depth := range []int{0, 2, 1} {
+		added, err := bf.Queue(urls[i], depth)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		} else if !added {
+			t.Errorf("Expected %s to be added", urls[i])
+		}
+	}
+	if added, _ := bf.Queue(urls[1], 1); added {
+		t.Errorf("Expected queued page not to be added again")
+	}
+
+	qu, err := bf.Pop()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if qu.URL.String() != urls[0].String() || qu.Depth != 0 {
+		t.Errorf("Expected %s to be popped first, got %+v", urls[0], qu)
+	}
+	err = bf.Visit(urls[0])
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if added, _ := bf.Queue(urls[0], 1); added {
+		t.Errorf("Expected visited page not to be added again")
+	}
+
+	qu, err = bf.Pop()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if qu.URL.String() != urls[1].String() || qu.Depth != 2 {
+		t.Errorf("Expected %s to be popped next, got %+v", urls[1], qu)
+	}
+
+	pending, err := bf.Pending()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if len(pending) != 2 || pending[0].URL.String() != urls[2].String() || pending[1].URL.String() != urls[1].String() {
+		t.Errorf("Expected queued then popped pages to be pending, got %v", pending)
+	}
+
+	bf.Pop()
+	qu, err = bf.Pop()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if qu != nil {
+		t.Errorf("Expected empty queue, got %+v", qu)
+	}
+
+	err = bf.Close()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	bf, err = NewBoltFrontier(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer bf.Close()
+
+	if added, err := bf.Queue(urls[0], 0); err != nil || !added {
+		t.Errorf("Expected frontier to be cleared when reopened, got %t and %v", added, err)
+	}
+}
@@ -0,0 +1,129 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jordanpotter/sitemapper/internal/crawlconfig"
+	"github.com/jordanpotter/sitemapper/internal/jobs"
+	"github.com/jordanpotter/sitemapper/internal/schedules"
+)
+
+var (
+	_ jobs.Store      = &FileStore{}
+	_ jobs.Store      = &BoltStore{}
+	_ schedules.Store = &FileStore{}
+	_ schedules.Store = &BoltStore{}
+)
+
+func testStore(t *testing.T, s jobs.Store) {
+	created := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	js := &jobs.JobStatus{ID: "abc123", Site: "https://foo.com", Status: jobs.Running, Pages: 3, Created: created}
+
+	_, err := s.Status(js.ID)
+	if err != jobs.ErrJobNotFound {
+		t.Errorf("Expected error %v, got %v", jobs.ErrJobNotFound, err)
+	}
+
+	err = s.SaveStatus(js)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	js.Status = jobs.Done
+	err = s.SaveStatus(js)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	saved, err := s.Status(js.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if saved.Status != jobs.Done || saved.Pages != 3 || !saved.Created.Equal(created) {
+		t.Errorf("Unexpected saved status %+v", saved)
+	}
+
+	err = s.SaveStatus(&jobs.JobStatus{ID: "def456", Status: jobs.Queued})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	statuses, err := s.Statuses()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if len(statuses) != 2 {
+		t.Errorf("Expected 2 statuses, got %d", len(statuses))
+	}
+
+	_, err = s.Result(js.ID)
+	if err != jobs.ErrResultNotReady {
+		t.Errorf("Expected error %v, got %v", jobs.ErrResultNotReady, err)
+	}
+
+	err = s.SaveResult(js.ID, []byte(`{"pages":[]}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	result, err := s.Result(js.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if string(result) != `{"pages":[]}` {
+		t.Errorf("Unexpected result %s", result)
+	}
+
+	err = s.Delete(js.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err = s.Status(js.ID)
+	if err != jobs.ErrJobNotFound {
+		t.Errorf("Expected error %v, got %v", jobs.ErrJobNotFound, err)
+	}
+
+	_, err = s.Result(js.ID)
+	if err != jobs.ErrResultNotReady {
+		t.Errorf("Expected error %v, got %v", jobs.ErrResultNotReady, err)
+	}
+}
+
+func testScheduleStore(t *testing.T, s schedules.Store) {
+	finished := time.Date(2016, 1, 1, 2, 5, 0, 0, time.UTC)
+	sch := &schedules.Schedule{
+		ID:          "nightly",
+		Cron:        "0 2 * * *",
+		Keep:        5,
+		Config:      &crawlconfig.Config{Seeds: []string{"https://foo.com"}, Workers: 4},
+		LastSuccess: &finished,
+		Runs:        []*schedules.Run{{JobID: "abc123", Status: jobs.Done, Finished: &finished}},
+	}
+
+	err := s.SaveSchedule(sch)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = s.SaveSchedule(&schedules.Schedule{ID: "weekly", Cron: "@weekly", Keep: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	err = s.DeleteSchedule("weekly")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	saved, err := s.Schedules()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if len(saved) != 1 {
+		t.Fatalf("Expected 1 schedule, got %d", len(saved))
+	}
+
+	got := saved[0]
+	if got.ID != "nightly" || got.Cron != "0 2 * * *" || got.Config.Workers != 4 || !got.LastSuccess.Equal(finished) {
+		t.Errorf("Unexpected saved schedule %+v", got)
+	} else if len(got.Runs) != 1 || got.Runs[0].JobID != "abc123" || got.Runs[0].Status != jobs.Done {
+		t.Errorf("Unexpected saved runs %+v", got.Runs)
+	}
+}
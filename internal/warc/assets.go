@@ -0,0 +1,100 @@
+package warc
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// An AssetFetcher fetches assets through a client whose transport archives
+// them, as the crawler itself only fetches pages. Each asset is fetched once,
+// however many pages load it.
+type AssetFetcher struct {
+	ctx     context.Context
+	client  *http.Client
+	headers http.Header
+	queue   chan *url.URL
+	wg      sync.WaitGroup
+
+	m    sync.Mutex
+	seen map[string]bool
+}
+
+// NewAssetFetcher returns a fetcher of assets with client, adding headers to
+// every request, using numWorkers workers. Assets are no longer fetched once
+// ctx is done. The fetcher must be closed once every asset has been queued.
+func NewAssetFetcher(ctx context.Context, client *http.Client, headers http.Header, numWorkers int) *AssetFetcher {
+	af := &AssetFetcher{
+		ctx:     ctx,
+		client:  client,
+		headers: headers,
+		queue:   make(chan *url.URL, numWorkers),
+		seen:    make(map[string]bool),
+	}
+
+	af.wg.Add(numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		go func() {
+			defer af.wg.Done()
+			for u := range af.queue {
+				af.fetch(u)
+			}
+		}()
+	}
+	return af
+}
+
+// Fetch queues the assets that have not already been fetched, blocking while
+// the workers are busy. Assets that are not fetched over HTTP, such as data
+// urls, are skipped.
+func (af *AssetFetcher) Fetch(urls []*url.URL) {
+	for _, u := range urls {
+		if u.Scheme != "http" && u.Scheme != "https" {
+			continue
+		}
+
+		af.m.Lock()
+		seen := af.seen[u.String()]
+		af.seen[u.String()] = true
+		af.m.Unlock()
+
+		if !seen {
+			af.queue <- u
+		}
+	}
+}
+
+// Close waits for the queued assets to be fetched.
+func (af *AssetFetcher) Close() {
+	close(af.queue)
+	af.wg.Wait()
+}
+
+func (af *AssetFetcher) fetch(u *url.URL) {
+	if af.ctx.Err() != nil {
+		return
+	}
+
+	req, err := http.NewRequestWithContext(af.ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		log.Printf("Failed to archive asset %s: %v", u, err)
+		return
+	}
+	for key, vals := range af.headers {
+		for _, val := range vals {
+			req.Header.Add(key, val)
+		}
+	}
+
+	resp, err := af.client.Do(req)
+	if err != nil {
+		log.Printf("Failed to archive asset %s: %v", u, err)
+		return
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+}
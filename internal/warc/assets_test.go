@@ -0,0 +1,44 @@
+package warc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+func TestAssetFetcher(t *testing.T) {
+	var m sync.Mutex
+	fetched := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		fetched[r.URL.Path]++
+		m.Unlock()
+
+		if r.Header.Get("User-Agent") != "sitemapper" {
+			t.Errorf("Expected user agent to be set, got %q", r.Header.Get("User-Agent"))
+		}
+		w.Write([]byte("asset"))
+	}))
+	defer ts.Close()
+
+	parse := func(str string) *url.URL {
+		u, err := url.Parse(str)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return u
+	}
+
+	headers := http.Header{"User-Agent": []string{"sitemapper"}}
+	af := NewAssetFetcher(context.Background(), http.DefaultClient, headers, 2)
+	af.Fetch([]*url.URL{parse(ts.URL + "/a.png"), parse(ts.URL + "/b.css"), parse("data:image/png;base64,AAAA")})
+	af.Fetch([]*url.URL{parse(ts.URL + "/a.png")})
+	af.Close()
+
+	if len(fetched) != 2 || fetched["/a.png"] != 1 || fetched["/b.css"] != 1 {
+		t.Errorf("Expected each asset to be fetched once, got %v", fetched)
+	}
+}
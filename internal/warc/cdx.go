@@ -0,0 +1,110 @@
+package warc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// cdxHeader names the fields of each line of a CDX index: the SURT key, the
+// timestamp, the original url, the media type, the status, the payload
+// digest, the redirect location, meta tags, the compressed length and offset
+// of the record, and the WARC file name.
+const cdxHeader = " CDX N b a m s k r M S V g"
+
+// A cdxEntry is the line of a CDX index locating a response record.
+type cdxEntry struct {
+	key       string
+	timestamp string
+	url       string
+	mediaType string
+	status    int
+	digest    string
+	redirect  string
+	length    int64
+	offset    int64
+	filename  string
+}
+
+func (e *cdxEntry) String() string {
+	return strings.Join([]string{
+		e.key,
+		e.timestamp,
+		cdxField(e.url),
+		cdxField(e.mediaType),
+		fmt.Sprint(e.status),
+		e.digest,
+		cdxField(e.redirect),
+		"-",
+		fmt.Sprint(e.length),
+		fmt.Sprint(e.offset),
+		cdxField(e.filename),
+	}, " ")
+}
+
+// WriteCDX writes a CDX index of the response records written so far, sorted
+// so that it can be searched by tools replaying the archive.
+func (ww *Writer) WriteCDX(w io.Writer) error {
+	ww.m.Lock()
+	lines := make([]string, 0, len(ww.index))
+	for _, e := range ww.index {
+		lines = append(lines, e.String())
+	}
+	ww.m.Unlock()
+	sort.Strings(lines)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, cdxHeader)
+	for _, line := range lines {
+		fmt.Fprintln(bw, line)
+	}
+	return bw.Flush()
+}
+
+// cdxField returns s as a field of a CDX line, in which fields are separated
+// by spaces and missing fields are written as -.
+func cdxField(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.ReplaceAll(s, " ", "%20")
+}
+
+// surt returns the Sort-friendly URI Reordering Transform of u, by which CDX
+// indexes are sorted. The scheme and any leading www are dropped, the labels
+// of the host are reversed, the query parameters are sorted and the result is
+// lowercased, so that https://www.foo.com/Bar?b=2&a=1 becomes
+// com,foo)/bar?a=1&b=2. IP addresses are not reversed.
+func surt(u *url.URL) string {
+	host := strings.ToLower(u.Hostname())
+	if net.ParseIP(host) == nil {
+		labels := strings.Split(host, ".")
+		if len(labels) > 2 && strings.HasPrefix(labels[0], "www") && strings.TrimLeft(labels[0][len("www"):], "0123456789") == "" {
+			labels = labels[1:]
+		}
+		for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+			labels[i], labels[j] = labels[j], labels[i]
+		}
+		host = strings.Join(labels, ",")
+	}
+
+	if port := u.Port(); port != "" && !(u.Scheme == "http" && port == "80") && !(u.Scheme == "https" && port == "443") {
+		host += ":" + port
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	key := host + ")" + path
+	if u.RawQuery != "" {
+		params := strings.Split(u.RawQuery, "&")
+		sort.Strings(params)
+		key += "?" + strings.Join(params, "&")
+	}
+	return strings.ToLower(key)
+}
@@ -0,0 +1,53 @@
+package warc
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+)
+
+func TestSURT(t *testing.T) {
+	testCases := []struct {
+		url      string
+		expected string
+	}{
+		{"https://foo.com", "com,foo)/"},
+		{"https://www.foo.com/Bar", "com,foo)/bar"},
+		{"http://www2.foo.com/", "com,foo)/"},
+		{"https://www.com/", "com,www)/"},
+		{"https://blog.foo.co.uk/a?b=2&a=1", "uk,co,foo,blog)/a?a=1&b=2"},
+		{"http://foo.com:80/", "com,foo)/"},
+		{"https://foo.com:8443/", "com,foo:8443)/"},
+		{"http://127.0.0.1:8080/a", "127.0.0.1:8080)/a"},
+	}
+
+	for _, tc := range testCases {
+		u, err := url.Parse(tc.url)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if key := surt(u); key != tc.expected {
+			t.Errorf("Expected SURT of %s to be %q, got %q", tc.url, tc.expected, key)
+		}
+	}
+}
+
+func TestWriteCDX(t *testing.T) {
+	ww := &Writer{index: []*cdxEntry{
+		{key: "com,foo)/b", timestamp: "20261019000000", url: "https://foo.com/b", status: 301, digest: "B", redirect: "https://foo.com/c", length: 10, offset: 20, filename: "crawl.warc.gz"},
+		{key: "com,foo)/a", timestamp: "20261019000000", url: "https://foo.com/a", mediaType: "text/html", status: 200, digest: "A", length: 30, offset: 40, filename: "crawl.warc.gz"},
+	}}
+
+	var buf bytes.Buffer
+	err := ww.WriteCDX(&buf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := " CDX N b a m s k r M S V g\n" +
+		"com,foo)/a 20261019000000 https://foo.com/a text/html 200 A - - 30 40 crawl.warc.gz\n" +
+		"com,foo)/b 20261019000000 https://foo.com/b - 301 B https://foo.com/c - 10 20 crawl.warc.gz\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected CDX:\n%s", buf.String())
+	}
+}
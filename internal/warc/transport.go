@@ -0,0 +1,83 @@
+package warc
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// baseTransport is used by a Transport without a Base. Unlike
+// http.DefaultTransport, it never negotiates HTTP/2 and never requests
+// compression, so that exchanges are archived as HTTP/1.1 messages with the
+// bodies the site sent.
+var baseTransport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	MaxIdleConns:          100,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ExpectContinueTimeout: time.Second,
+	DisableCompression:    true,
+	TLSNextProto:          make(map[string]func(string, *tls.Conn) http.RoundTripper),
+}
+
+// A Transport archives every exchange made through Base to Writer. A response
+// is archived once its body is closed, with the body read so far and any of
+// it left unread. Base defaults to a transport using only HTTP/1.1 without
+// compression, and any other Base must do the same for the archive to hold
+// what was sent.
+type Transport struct {
+	Base   http.RoundTripper
+	Writer *Writer
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = baseTransport
+	}
+
+	date := time.Now()
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = &recordingBody{
+		ReadCloser: resp.Body,
+		record: func(body []byte) {
+			t.Writer.WriteExchange(req, resp, body, date)
+		},
+	}
+	return resp, nil
+}
+
+// A recordingBody keeps every byte read from a response body, passing them
+// to record once the body is closed.
+type recordingBody struct {
+	io.ReadCloser
+	buf    bytes.Buffer
+	record func(body []byte)
+	once   sync.Once
+}
+
+func (rb *recordingBody) Read(p []byte) (int, error) {
+	n, err := rb.ReadCloser.Read(p)
+	rb.buf.Write(p[:n])
+	return n, err
+}
+
+func (rb *recordingBody) Close() error {
+	rb.once.Do(func() {
+		io.Copy(&rb.buf, rb.ReadCloser)
+		rb.record(rb.buf.Bytes())
+	})
+	return rb.ReadCloser.Close()
+}
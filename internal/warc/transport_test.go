@@ -0,0 +1,138 @@
+package warc
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTransport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html>" + strings.Repeat("x", 100) + "</html>"))
+	}))
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	ww, err := NewWriter(&buf, "crawl.warc.gz")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	client := &http.Client{Transport: &Transport{Writer: ww}}
+
+	resp, err := client.Get(ts.URL + "/old")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Only part of the body is read, but all of it is archived.
+	resp.Body.Read(make([]byte, 10))
+	resp.Body.Close()
+
+	if ww.Err() != nil {
+		t.Fatalf("Unexpected error: %v", ww.Err())
+	}
+
+	headers, blocks := readRecords(t, buf.Bytes())
+	if len(headers) != 5 {
+		t.Fatalf("Expected 5 records, got %d", len(headers))
+	}
+
+	if uri := headers[2].Get("WARC-Target-URI"); uri != ts.URL+"/old" || !strings.HasPrefix(string(blocks[2]), "HTTP/1.1 301") {
+		t.Errorf("Expected redirect from %s to be archived, got %s", ts.URL+"/old", uri)
+	}
+	if uri := headers[4].Get("WARC-Target-URI"); uri != ts.URL+"/new" {
+		t.Errorf("Expected response of %s to be archived, got %s", ts.URL+"/new", uri)
+	}
+	if !bytes.HasSuffix(blocks[4], []byte(strings.Repeat("x", 100)+"</html>")) {
+		t.Errorf("Expected whole body to be archived, got %q", blocks[4])
+	}
+
+	var cdx bytes.Buffer
+	err = ww.WriteCDX(&cdx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSuffix(cdx.String(), "\n"), "\n"); len(lines) != 3 {
+		t.Errorf("Expected 2 CDX lines, got %q", lines[1:])
+	}
+}
+
+func TestTransportSent(t *testing.T) {
+	body := "<html>" + strings.Repeat("x", 100) + "</html>"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+		}
+		w.Write([]byte(body[:50]))
+		w.(http.Flusher).Flush()
+		w.Write([]byte(body[50:]))
+	}))
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	ww, err := NewWriter(&buf, "crawl.warc.gz")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	client := &http.Client{Transport: &Transport{Writer: ww}}
+
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	headers, blocks := readRecords(t, buf.Bytes())
+	if len(headers) != 3 {
+		t.Fatalf("Expected 3 records, got %d", len(headers))
+	}
+
+	if request := string(blocks[1]); strings.Contains(request, "Accept-Encoding") || !strings.Contains(request, "User-Agent: "+defaultUserAgent+"\r\n") {
+		t.Errorf("Unexpected request block %q", request)
+	}
+	expected := fmt.Sprintf("Transfer-Encoding: chunked\r\n\r\n%x\r\n%s\r\n0\r\n\r\n", len(body), body)
+	if response := string(blocks[2]); !strings.HasPrefix(response, "HTTP/1.1 200 OK\r\n") || !strings.HasSuffix(response, expected) || strings.Contains(response, "Content-Encoding") {
+		t.Errorf("Unexpected response block %q", response)
+	}
+	if headers[2].Get("WARC-Payload-Digest") != digest([]byte(body)) {
+		t.Errorf("Unexpected payload digest %s", headers[2].Get("WARC-Payload-Digest"))
+	}
+}
+
+func TestTransportHTTP1(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	base := baseTransport.Clone()
+	base.TLSClientConfig = &tls.Config{RootCAs: ts.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs}
+
+	var buf bytes.Buffer
+	ww, err := NewWriter(&buf, "crawl.warc.gz")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	client := &http.Client{Transport: &Transport{Base: base, Writer: ww}}
+
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	_, blocks := readRecords(t, buf.Bytes())
+	if response := string(blocks[2]); !strings.HasPrefix(response, "HTTP/1.1 200 OK\r\n") || !strings.HasSuffix(response, "HTTP/1.1") {
+		t.Errorf("Unexpected response block %q", response)
+	}
+}
@@ -0,0 +1,236 @@
+package warc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// warcDateFormat is the format of WARC-Date headers, in UTC.
+const warcDateFormat = "2006-01-02T15:04:05Z"
+
+// defaultUserAgent is the User-Agent sent by Go when a request has none.
+const defaultUserAgent = "Go-http-client/1.1"
+
+// A Writer writes WARC 1.1 records, compressing each record as a separate
+// gzip member so that records can be read without decompressing the whole
+// file. It is safe for concurrent use. Once a write fails, every later write
+// returns the same error.
+type Writer struct {
+	m        sync.Mutex
+	w        io.Writer
+	filename string
+	offset   int64
+	index    []*cdxEntry
+	err      error
+}
+
+// NewWriter returns a writer of WARC records to w, after writing a warcinfo
+// record describing the file. Filename is the name of the file written to,
+// which is recorded in the warcinfo record and the CDX index.
+func NewWriter(w io.Writer, filename string) (*Writer, error) {
+	ww := &Writer{w: w, filename: filename}
+
+	fields := "software: sitemapper\r\n" +
+		"format: WARC File Format 1.1\r\n" +
+		"conformsTo: http://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/\r\n"
+	headers := []header{
+		{"WARC-Type", "warcinfo"},
+		{"WARC-Record-ID", newRecordID()},
+		{"WARC-Date", time.Now().UTC().Format(warcDateFormat)},
+		{"WARC-Filename", filename},
+		{"Content-Type", "application/warc-fields"},
+	}
+	_, _, err := ww.writeRecord(headers, []byte(fields))
+	if err != nil {
+		return nil, err
+	}
+	return ww, nil
+}
+
+// WriteExchange writes a request record for req and a response record for
+// resp, whose body has been read into body, as made at date. The response is
+// added to the CDX index.
+func (ww *Writer) WriteExchange(req *http.Request, resp *http.Response, body []byte, date time.Time) error {
+	ww.m.Lock()
+	defer ww.m.Unlock()
+	if ww.err != nil {
+		return ww.err
+	}
+
+	requestID := newRecordID()
+	responseID := newRecordID()
+	warcDate := date.UTC().Format(warcDateFormat)
+	target := req.URL.String()
+
+	reqBlock := requestBlock(req)
+	_, _, err := ww.writeRecord([]header{
+		{"WARC-Type", "request"},
+		{"WARC-Record-ID", requestID},
+		{"WARC-Date", warcDate},
+		{"WARC-Target-URI", target},
+		{"WARC-Concurrent-To", responseID},
+		{"WARC-Block-Digest", digest(reqBlock)},
+		{"Content-Type", "application/http;msgtype=request"},
+	}, reqBlock)
+	if err != nil {
+		ww.err = err
+		return err
+	}
+
+	payloadDigest := digest(body)
+	respBlock := responseBlock(resp, body)
+	offset, length, err := ww.writeRecord([]header{
+		{"WARC-Type", "response"},
+		{"WARC-Record-ID", responseID},
+		{"WARC-Date", warcDate},
+		{"WARC-Target-URI", target},
+		{"WARC-Block-Digest", digest(respBlock)},
+		{"WARC-Payload-Digest", payloadDigest},
+		{"Content-Type", "application/http;msgtype=response"},
+	}, respBlock)
+	if err != nil {
+		ww.err = err
+		return err
+	}
+
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType = ""
+	}
+	ww.index = append(ww.index, &cdxEntry{
+		key:       surt(req.URL),
+		timestamp: date.UTC().Format("20060102150405"),
+		url:       target,
+		mediaType: mediaType,
+		status:    resp.StatusCode,
+		digest:    payloadDigest[len("sha1:"):],
+		redirect:  resp.Header.Get("Location"),
+		length:    length,
+		offset:    offset,
+		filename:  ww.filename,
+	})
+	return nil
+}
+
+// Err returns the error that stopped the writer, if any.
+func (ww *Writer) Err() error {
+	ww.m.Lock()
+	defer ww.m.Unlock()
+	return ww.err
+}
+
+type header struct {
+	name  string
+	value string
+}
+
+// writeRecord writes a record with headers and block as a gzip member,
+// returning the offset and compressed length of the member.
+func (ww *Writer) writeRecord(headers []header, block []byte) (offset, length int64, err error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+
+	fmt.Fprint(zw, "WARC/1.1\r\n")
+	for _, h := range headers {
+		fmt.Fprintf(zw, "%s: %s\r\n", h.name, h.value)
+	}
+	fmt.Fprintf(zw, "Content-Length: %d\r\n\r\n", len(block))
+	zw.Write(block)
+	fmt.Fprint(zw, "\r\n\r\n")
+	err = zw.Close()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	offset = ww.offset
+	n, err := ww.w.Write(buf.Bytes())
+	ww.offset += int64(n)
+	return offset, int64(n), err
+}
+
+// requestBlock returns the HTTP/1.1 request message of req, with the
+// headers that the transport sends. Besides Host, the transport only adds
+// User-Agent, as the base transport of Transport does not request
+// compression.
+func requestBlock(req *http.Request) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s HTTP/1.1\r\n", req.Method, req.URL.RequestURI())
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	fmt.Fprintf(&buf, "Host: %s\r\n", host)
+
+	userAgent := defaultUserAgent
+	if vals, ok := req.Header["User-Agent"]; ok && len(vals) > 0 {
+		userAgent = vals[0]
+	}
+	if userAgent != "" {
+		fmt.Fprintf(&buf, "User-Agent: %s\r\n", userAgent)
+	}
+	if req.Close {
+		buf.WriteString("Connection: close\r\n")
+	}
+	req.Header.WriteSubset(&buf, map[string]bool{"User-Agent": true})
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+// responseBlock returns the HTTP response message of resp with body. Go
+// removes the framing of chunked bodies, along with their Transfer-Encoding
+// header, so these are restored with the body sent as a single chunk.
+func responseBlock(resp *http.Response, body []byte) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s\r\n", resp.Proto, resp.Status)
+
+	h := resp.Header
+	chunked := len(resp.TransferEncoding) > 0 && resp.TransferEncoding[len(resp.TransferEncoding)-1] == "chunked"
+	if chunked {
+		h = h.Clone()
+		h.Set("Transfer-Encoding", strings.Join(resp.TransferEncoding, ", "))
+	}
+	h.Write(&buf)
+	buf.WriteString("\r\n")
+
+	if !chunked {
+		buf.Write(body)
+		return buf.Bytes()
+	}
+	if len(body) > 0 {
+		fmt.Fprintf(&buf, "%x\r\n", len(body))
+		buf.Write(body)
+		buf.WriteString("\r\n")
+	}
+	buf.WriteString("0\r\n\r\n")
+	return buf.Bytes()
+}
+
+// digest returns the SHA-1 digest of b in the base32 form used by WARC
+// digest headers.
+func digest(b []byte) string {
+	sum := sha1.Sum(b)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// newRecordID returns a random version 4 UUID as a WARC record id.
+func newRecordID() string {
+	var b [16]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,158 @@
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readRecords returns the headers and blocks of the records in b, checking
+// that each record is a separate gzip member.
+func readRecords(t *testing.T, b []byte) ([]textproto.MIMEHeader, [][]byte) {
+	var headers []textproto.MIMEHeader
+	var blocks [][]byte
+
+	r := bytes.NewReader(b)
+	for r.Len() > 0 {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		zr.Multistream(false)
+		record, err := ioutil.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		tr := textproto.NewReader(bufio.NewReader(bytes.NewReader(record)))
+		version, err := tr.ReadLine()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		} else if version != "WARC/1.1" {
+			t.Fatalf("Unexpected version %q", version)
+		}
+		h, err := tr.ReadMIMEHeader()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		n, err := strconv.Atoi(h.Get("Content-Length"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		block := make([]byte, n+4)
+		_, err = io.ReadFull(tr.R, block)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		} else if string(block[n:]) != "\r\n\r\n" {
+			t.Fatalf("Expected record to end with two CRLFs, got %q", block[n:])
+		}
+
+		headers = append(headers, h)
+		blocks = append(blocks, block[:n])
+	}
+	return headers, blocks
+}
+
+func TestWriteExchange(t *testing.T) {
+	var buf bytes.Buffer
+	ww, err := NewWriter(&buf, "crawl.warc.gz")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "https://foo.com/about?a=1", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	req.Header.Set("User-Agent", "sitemapper")
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		Status:     "200 OK",
+		StatusCode: 200,
+		Header:     http.Header{"Content-Type": []string{"text/html; charset=utf-8"}},
+	}
+	body := []byte("<html></html>")
+	date := time.Date(2026, 10, 19, 12, 30, 0, 0, time.UTC)
+
+	err = ww.WriteExchange(req, resp, body, date)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	headers, blocks := readRecords(t, buf.Bytes())
+	if len(headers) != 3 {
+		t.Fatalf("Expected 3 records, got %d", len(headers))
+	}
+
+	info, request, response := headers[0], headers[1], headers[2]
+	if info.Get("WARC-Type") != "warcinfo" || info.Get("WARC-Filename") != "crawl.warc.gz" {
+		t.Errorf("Unexpected warcinfo record %v", info)
+	}
+
+	if request.Get("WARC-Type") != "request" || request.Get("WARC-Target-URI") != "https://foo.com/about?a=1" {
+		t.Errorf("Unexpected request record %v", request)
+	} else if request.Get("WARC-Concurrent-To") != response.Get("WARC-Record-ID") {
+		t.Errorf("Expected request to be concurrent to %s, got %s", response.Get("WARC-Record-ID"), request.Get("WARC-Concurrent-To"))
+	} else if request.Get("WARC-Date") != "2026-10-19T12:30:00Z" {
+		t.Errorf("Unexpected date %s", request.Get("WARC-Date"))
+	}
+	expectedRequest := "GET /about?a=1 HTTP/1.1\r\nHost: foo.com\r\nUser-Agent: sitemapper\r\n\r\n"
+	if string(blocks[1]) != expectedRequest {
+		t.Errorf("Unexpected request block %q", blocks[1])
+	}
+
+	expectedResponse := "HTTP/1.1 200 OK\r\nContent-Type: text/html; charset=utf-8\r\n\r\n<html></html>"
+	if response.Get("WARC-Type") != "response" || response.Get("Content-Type") != "application/http;msgtype=response" {
+		t.Errorf("Unexpected response record %v", response)
+	} else if string(blocks[2]) != expectedResponse {
+		t.Errorf("Unexpected response block %q", blocks[2])
+	}
+	if response.Get("WARC-Block-Digest") != digest(blocks[2]) || response.Get("WARC-Payload-Digest") != digest(body) {
+		t.Errorf("Unexpected digests %s and %s", response.Get("WARC-Block-Digest"), response.Get("WARC-Payload-Digest"))
+	}
+
+	var cdx bytes.Buffer
+	err = ww.WriteCDX(&cdx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(cdx.String(), "\n"), "\n")
+	if len(lines) != 2 || lines[0] != cdxHeader {
+		t.Fatalf("Unexpected CDX %q", cdx.String())
+	}
+	fields := strings.Split(lines[1], " ")
+	expected := []string{"com,foo)/about?a=1", "20261019123000", "https://foo.com/about?a=1", "text/html", "200", digest(body)[len("sha1:"):], "-", "-"}
+	for i, f := range expected {
+		if fields[i] != f {
+			t.Errorf("Expected CDX field %d to be %q, got %q", i, f, fields[i])
+		}
+	}
+	if offset := fields[9]; offset == "0" || fields[10] != "crawl.warc.gz" {
+		t.Errorf("Unexpected CDX line %q", lines[1])
+	}
+}
+
+func TestDigest(t *testing.T) {
+	if d := digest([]byte("hello")); d != "sha1:VL2MMHO4YXUKFWV63YHTWSBM3GXKSQ2N" {
+		t.Errorf("Unexpected digest %s", d)
+	}
+}
+
+func TestNewRecordID(t *testing.T) {
+	id := newRecordID()
+	if len(id) != len("<urn:uuid:00000000-0000-4000-8000-000000000000>") || !strings.HasPrefix(id, "<urn:uuid:") || id[24] != '4' {
+		t.Errorf("Unexpected record id %s", id)
+	}
+	if newRecordID() == id {
+		t.Errorf("Expected record ids to be unique")
+	}
+}
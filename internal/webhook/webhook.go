@@ -0,0 +1,133 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// EventHeader names the event a webhook was sent for.
+	EventHeader = "X-Sitemapper-Event"
+
+	// SignatureHeader holds the signature of a webhook's body, as returned
+	// by Sign.
+	SignatureHeader = "X-Sitemapper-Signature"
+)
+
+// signaturePrefix identifies the algorithm of a signature.
+const signaturePrefix = "sha256="
+
+// maxResponseBytes is the most of a response body read before the
+// connection is reused.
+const maxResponseBytes = 64 << 10
+
+// A StatusError is returned when a webhook receiver responds with a status
+// code other than 2xx.
+type StatusError struct {
+	StatusCode int
+}
+
+func (se *StatusError) Error() string {
+	return fmt.Sprintf("webhook receiver responded with status %d", se.StatusCode)
+}
+
+// Sign returns the signature of body using secret, as "sha256=" followed by
+// the hex encoded HMAC-SHA256 digest.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the signature of body using secret.
+func Verify(secret, body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, body)))
+}
+
+// A Sender delivers signed webhooks, retrying failed deliveries with
+// exponential backoff.
+type Sender struct {
+	Client *http.Client
+	Secret []byte
+
+	// MaxAttempts is the most times a webhook is sent, including the first.
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry, doubled for every retry
+	// after.
+	Backoff time.Duration
+}
+
+// Send POSTs the JSON body to url as the specified event. Deliveries that
+// fail with a network error, a 408, 429 or 5xx status are retried until
+// MaxAttempts is reached or ctx is done. If onAttempt is not nil, it is
+// called after every attempt with the attempt's number and error, which is
+// nil once delivered.
+func (s *Sender) Send(ctx context.Context, url, event string, body []byte, onAttempt func(attempt int, err error)) error {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	backoff := s.Backoff
+	for attempt := 1; ; attempt++ {
+		err := s.send(ctx, client, url, event, body)
+		if onAttempt != nil {
+			onAttempt(attempt, err)
+		}
+		if err == nil || !isRetryable(err) || attempt >= s.MaxAttempts {
+			return err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+func (s *Sender) send(ctx context.Context, client *http.Client, url, event string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(SignatureHeader, Sign(s.Secret, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxResponseBytes))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// isRetryable reports whether a delivery that failed with err may succeed
+// if sent again.
+func isRetryable(err error) bool {
+	se, ok := err.(*StatusError)
+	if !ok {
+		return true
+	}
+	return se.StatusCode == http.StatusRequestTimeout || se.StatusCode == http.StatusTooManyRequests || se.StatusCode >= 500
+}
@@ -0,0 +1,128 @@
+package webhook
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	secret := []byte("s3cret")
+	body := []byte(`{"event":"job.done"}`)
+
+	signature := Sign(secret, body)
+	if signature != "sha256=d178f25eb2fa0423b0c0b54e9ec923794ab52a3fc470469d4139bf644fa21e0a" {
+		t.Fatalf("Unexpected signature %q", signature)
+	}
+
+	if !Verify(secret, body, signature) {
+		t.Errorf("Expected signature to be verified")
+	}
+	if Verify([]byte("other"), body, signature) {
+		t.Errorf("Expected signature with another secret to be rejected")
+	}
+	if Verify(secret, []byte(`{}`), signature) {
+		t.Errorf("Expected signature of another body to be rejected")
+	}
+	if Verify(secret, body, signature[len(signaturePrefix):]) {
+		t.Errorf("Expected signature without prefix to be rejected")
+	}
+}
+
+func TestSend(t *testing.T) {
+	secret := []byte("s3cret")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		if r.Header.Get(EventHeader) != "job.done" {
+			t.Errorf("Unexpected event %q", r.Header.Get(EventHeader))
+		}
+		if !Verify(secret, body, r.Header.Get(SignatureHeader)) {
+			t.Errorf("Expected webhook to be signed")
+		}
+	}))
+	defer ts.Close()
+
+	s := &Sender{Secret: secret, MaxAttempts: 3}
+	err := s.Send(context.Background(), ts.URL, "job.done", []byte(`{"event":"job.done"}`), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestSendRetries(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	var attempts []int
+	var errs []error
+	s := &Sender{MaxAttempts: 5, Backoff: time.Millisecond}
+	err := s.Send(context.Background(), ts.URL, "job.done", []byte(`{}`), func(attempt int, err error) {
+		attempts = append(attempts, attempt)
+		errs = append(errs, err)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(attempts) != 3 || attempts[2] != 3 {
+		t.Fatalf("Expected 3 attempts, got %v", attempts)
+	}
+	if se, ok := errs[0].(*StatusError); !ok || se.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected first attempt to fail with status 503, got %v", errs[0])
+	} else if errs[2] != nil {
+		t.Errorf("Expected last attempt to succeed, got %v", errs[2])
+	}
+}
+
+func TestSendGivesUp(t *testing.T) {
+	testSendGivesUp := func(status int, expectedRequests int32) {
+		var requests int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.WriteHeader(status)
+		}))
+		defer ts.Close()
+
+		s := &Sender{MaxAttempts: 3, Backoff: time.Millisecond}
+		err := s.Send(context.Background(), ts.URL, "job.failed", []byte(`{}`), nil)
+		if se, ok := err.(*StatusError); !ok || se.StatusCode != status {
+			t.Errorf("Expected status error %d, got %v", status, err)
+		}
+		if requests != expectedRequests {
+			t.Errorf("Expected %d requests for status %d, got %d", expectedRequests, status, requests)
+		}
+	}
+
+	testSendGivesUp(http.StatusInternalServerError, 3)
+	testSendGivesUp(http.StatusTooManyRequests, 3)
+	testSendGivesUp(http.StatusBadRequest, 1)
+	testSendGivesUp(http.StatusGone, 1)
+}
+
+func TestSendCancelled(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Sender{MaxAttempts: 5, Backoff: time.Hour}
+	err := s.Send(ctx, ts.URL, "job.done", []byte(`{}`), func(attempt int, err error) {
+		cancel()
+	})
+	if err != context.Canceled {
+		t.Errorf("Expected error %v, got %v", context.Canceled, err)
+	}
+}